@@ -0,0 +1,341 @@
+package main
+
+import (
+	"app/internal/database"
+	"app/internal/reconcile"
+	"app/internal/risk"
+	"app/internal/tamper"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// command is a `parkproof <name>` invocation. run returns the exit code.
+type command struct {
+	run     func(args []string) int
+	offline bool // doesn't need MongoDB
+}
+
+var commands = map[string]command{
+	"verify-chain":  {run: verifyChain},
+	"checkpoint":    {run: checkpoint},
+	"export-bundle": {run: exportBundle},
+	"verify-bundle": {run: verifyBundle, offline: true},
+	"reconcile":     {run: reconcileLogs},
+	"risk":          {run: riskCommand},
+}
+
+// parkproof verify-chain [-lot <parkingLotId>]
+func verifyChain(args []string) int {
+	fs := flag.NewFlagSet("verify-chain", flag.ExitOnError)
+	lot := fs.String("lot", "", "only verify this parking lot's chain")
+	fs.Parse(args)
+
+	var lots []string
+	if *lot != "" {
+		lots = append(lots, *lot)
+	}
+
+	report, err := tamper.Verify(lots...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to verify tamper log:", err)
+		return 2
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if !report.Valid {
+		for _, r := range report.Chains {
+			if !r.Valid {
+				fmt.Fprintf(os.Stderr, "Chain %q BROKEN at position %d (%s)\n", r.ChainID, r.FirstBroken.Position, r.FirstBroken.Kind)
+			}
+		}
+		if cp := report.Checkpoints.FirstBroken; cp != nil {
+			fmt.Fprintf(os.Stderr, "Checkpoints BROKEN at position %d (%s)\n", cp.Position, cp.Kind)
+		}
+		if b := report.Batches.FirstBroken; b != nil {
+			fmt.Fprintf(os.Stderr, "Batches BROKEN at position %d (%s)\n", b.Position, b.Kind)
+		}
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "OK: %d chains, %d checkpoints, %d batches\n", len(report.Chains), report.Checkpoints.Checked, report.Batches.Checked)
+	return 0
+}
+
+// parkproof checkpoint: seal finished time windows into Merkle batches, then
+// checkpoint every chain head and send the checkpoint to the witnesses. It
+// takes the scheduler's lease, so it doesn't race a running server.
+func checkpoint(args []string) int {
+	code := 0
+	ok, err := tamper.WithCheckpointLease(context.Background(), func() { code = checkpointNow() })
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to take the checkpoint lock:", err)
+		return 2
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Another instance is checkpointing; try again later")
+		return 1
+	}
+	return code
+}
+
+func checkpointNow() int {
+	batches, err := tamper.SealBatches()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to seal batches:", err)
+		return 2
+	}
+	for _, b := range batches {
+		fmt.Fprintf(os.Stderr, "Batch %d: %d records, root %s\n", b.Seq, b.Size, b.Root)
+	}
+
+	cp, err := tamper.Checkpoint()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create checkpoint:", err)
+		return 2
+	}
+	if cp == nil {
+		fmt.Fprintln(os.Stderr, "No chain changed since the last checkpoint")
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Checkpoint %d: %s\n", cp.Seq, cp.Hash)
+	tamper.WitnessCheckpoint(*cp)
+	return 0
+}
+
+// parkproof export-bundle -lot <parkingLotId> -from <date> -to <date> [-out file]
+func exportBundle(args []string) int {
+	fs := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	lot := fs.String("lot", "", "parking lot ID (required)")
+	fromArg := fs.String("from", "", "start date, YYYY-MM-DD or RFC 3339 (required)")
+	toArg := fs.String("to", "", "end date, inclusive if YYYY-MM-DD (required)")
+	out := fs.String("out", "", "write the bundle here instead of stdout")
+	fs.Parse(args)
+
+	if *lot == "" || *fromArg == "" || *toArg == "" {
+		fs.Usage()
+		return 2
+	}
+	from, err := tamper.ParseRangeTime(*fromArg, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	to, err := tamper.ParseRangeTime(*toArg, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	bundle, err := tamper.Export(*lot, from, to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to export bundle:", err)
+		return 2
+	}
+
+	data, _ := json.MarshalIndent(bundle, "", "  ")
+	if *out == "" {
+		fmt.Println(string(data))
+	} else if err := os.WriteFile(*out, data, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write bundle:", err)
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d records and %d legacy records (%d with inclusion proofs)\n", len(bundle.Records), len(bundle.Legacy), len(bundle.Proofs))
+	if bundle.Checkpoint == nil {
+		fmt.Fprintln(os.Stderr, "Warning: no checkpoint yet, so the end of the range can't be vouched for")
+	}
+	return 0
+}
+
+// parkproof verify-bundle <file>
+func verifyBundle(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: parkproof verify-bundle <file>")
+		return 2
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read bundle:", err)
+		return 2
+	}
+	var bundle tamper.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to parse bundle:", err)
+		return 2
+	}
+
+	report := tamper.VerifyBundle(bundle)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// parkproof reconcile -from <date> -to <date> [-lot <parkingLotId>] [-save]
+func reconcileLogs(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	lot := fs.String("lot", "", "only reconcile this parking lot")
+	fromArg := fs.String("from", "", "start date, YYYY-MM-DD or RFC 3339 (required)")
+	toArg := fs.String("to", "", "end date, inclusive if YYYY-MM-DD (required)")
+	save := fs.Bool("save", false, "store the report alongside the scheduled ones")
+	fs.Parse(args)
+
+	if *fromArg == "" || *toArg == "" {
+		fs.Usage()
+		return 2
+	}
+	from, err := tamper.ParseRangeTime(*fromArg, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	to, err := tamper.ParseRangeTime(*toArg, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	report, err := reconcile.Run(*lot, from, to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to reconcile:", err)
+		return 2
+	}
+	if *save {
+		if err := database.SaveReconciliationReport(report); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to save report:", err)
+			return 2
+		}
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	fmt.Fprintf(os.Stderr, "%d discrepancies\n", len(report.Discrepancies))
+	return 0
+}
+
+// parkproof risk <subcommand>
+func riskCommand(args []string) int {
+	if len(args) == 0 || args[0] != "backtest" {
+		fmt.Fprintln(os.Stderr, "usage: parkproof risk backtest [flags]")
+		return 2
+	}
+	return riskBacktest(args[1:])
+}
+
+// parkproof risk backtest -from <date> -to <date> [-lot <parkingLotId>]
+// [-step 1h] [-policy file] [-compare file] [-v]
+//
+// Replays the analyzer at each step without saving anything. With -compare
+// both policies are replayed and the lots they disagree on are listed.
+func riskBacktest(args []string) int {
+	fs := flag.NewFlagSet("risk backtest", flag.ExitOnError)
+	lot := fs.String("lot", "", "only replay this parking lot")
+	fromArg := fs.String("from", "", "start date, YYYY-MM-DD or RFC 3339 (required)")
+	toArg := fs.String("to", "", "end date, inclusive if YYYY-MM-DD (required)")
+	step := fs.Duration("step", time.Hour, "time between replayed runs")
+	policyPath := fs.String("policy", "", "policy file to replay (default: the one in force)")
+	comparePath := fs.String("compare", "", "second policy file to replay and diff against")
+	verbose := fs.Bool("v", false, "keep the analyzer's per-rule logging")
+	fs.Parse(args)
+
+	if *fromArg == "" || *toArg == "" || *step <= 0 {
+		fs.Usage()
+		return 2
+	}
+	from, err := tamper.ParseRangeTime(*fromArg, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	to, err := tamper.ParseRangeTime(*toArg, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if !from.Before(to) {
+		fmt.Fprintln(os.Stderr, "from must be before to")
+		return 2
+	}
+
+	base := risk.Policies()
+	if *policyPath != "" {
+		if base, err = risk.ReadPolicyFile(*policyPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	var compare *risk.PolicySet
+	if *comparePath != "" {
+		if compare, err = risk.ReadPolicyFile(*comparePath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	lots, err := database.GetAllParkingLots(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to get parking lots:", err)
+		return 2
+	}
+	if *lot != "" {
+		var only []database.ParkingLot
+		for _, l := range lots {
+			if l.ID.Hex() == *lot {
+				only = append(only, l)
+			}
+		}
+		if len(only) == 0 {
+			fmt.Fprintln(os.Stderr, "No such parking lot:", *lot)
+			return 2
+		}
+		lots = only
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	out := struct {
+		Base    risk.BacktestResult  `json:"base"`
+		Compare *risk.BacktestResult `json:"compare,omitempty"`
+		Diff    []risk.BacktestDiff  `json:"diff,omitempty"`
+	}{}
+	if out.Base, err = risk.Backtest(context.Background(), lots, base, from, to, *step); err != nil {
+		fmt.Fprintln(os.Stderr, "Backtest failed:", err)
+		return 2
+	}
+	if compare != nil {
+		res, err := risk.Backtest(context.Background(), lots, compare, from, to, *step)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Backtest failed:", err)
+			return 2
+		}
+		out.Compare = &res
+		out.Diff = risk.DiffBacktests(out.Base, res)
+	}
+
+	data, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(data))
+
+	flagged := 0
+	for _, s := range out.Base.Lots {
+		if s.FirstHigh != nil {
+			flagged++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Replayed %d lots from %s to %s: %d reached HIGH under %s\n",
+		len(lots), from.Format(time.RFC3339), to.Format(time.RFC3339), flagged, out.Base.PolicyVersion)
+	if compare != nil {
+		fmt.Fprintf(os.Stderr, "%s and %s disagree on %d lots\n", out.Base.PolicyVersion, out.Compare.PolicyVersion, len(out.Diff))
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// LotAudit is a physical inspection of a parking lot
+type LotAudit struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	ParkingLotID bson.ObjectID `bson:"parkingLotId" json:"parkingLotId"`
+	AuditedAt    time.Time     `bson:"auditedAt" json:"auditedAt"`
+	Auditor      string        `bson:"auditor" json:"auditor"`
+	Outcome      string        `bson:"outcome,omitempty" json:"outcome,omitempty"`
+	Notes        string        `bson:"notes,omitempty" json:"notes,omitempty"`
+}
+
+func ensureAuditIndexes() error {
+	_, err := lotAuditCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "parkingLotId", Value: 1}, {Key: "auditedAt", Value: -1}},
+		Options: options.Index().SetName("lot_auditedAt"),
+	})
+	return err
+}
+
+func InsertLotAudit(a LotAudit) error {
+	_, err := lotAuditCollection.InsertOne(context.TODO(), a)
+	return err
+}
+
+// GetLotAudits returns a lot's audits, newest first
+func GetLotAudits(parkingLotID string, limit int64) ([]LotAudit, error) {
+	objID, err := bson.ObjectIDFromHex(parkingLotID)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "auditedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := lotAuditCollection.Find(context.TODO(), bson.D{{Key: "parkingLotId", Value: objID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	audits := []LotAudit{}
+	if err := cursor.All(context.TODO(), &audits); err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+// GetLastAuditTimes returns when each lot was last audited; lots never
+// audited are missing from the map
+func GetLastAuditTimes(ctx context.Context) (map[bson.ObjectID]time.Time, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$parkingLotId"},
+			{Key: "last", Value: bson.D{{Key: "$max", Value: "$auditedAt"}}},
+		}}},
+	}
+	cursor, err := lotAuditCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	last := make(map[bson.ObjectID]time.Time)
+	for cursor.Next(ctx) {
+		var row struct {
+			Lot  bson.ObjectID `bson:"_id"`
+			Last time.Time     `bson:"last"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		last[row.Lot] = row.Last
+	}
+	return last, cursor.Err()
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Scopes of a RiskBaseline
+const (
+	BaselineScopeLot  = "lot"  // Key is the lot's ObjectID hex
+	BaselineScopeArea = "area" // Key is ParkingLot.Area
+)
+
+// HourStat summarises one hour of the week over the baseline's weeks. Rate
+// fields are per parking slot; area baselines only have those.
+type HourStat struct {
+	N          int     `bson:"n" json:"n"`
+	Mean       float64 `bson:"mean" json:"mean"`
+	StdDev     float64 `bson:"stdDev" json:"stdDev"`
+	RateMean   float64 `bson:"rateMean" json:"rateMean"`
+	RateStdDev float64 `bson:"rateStdDev" json:"rateStdDev"`
+}
+
+// RiskBaseline is the rolling per-hour-of-week history of one metric for a
+// lot or an area. Hours are indexed by local weekday*24 + hour, Sunday
+// first.
+type RiskBaseline struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Scope      string        `bson:"scope" json:"scope"`
+	Key        string        `bson:"key" json:"key"`
+	Metric     string        `bson:"metric" json:"metric"`
+	Weeks      int           `bson:"weeks" json:"weeks"`
+	Capacity   int           `bson:"capacity,omitempty" json:"capacity,omitempty"`
+	Through    time.Time     `bson:"through" json:"through"` // data up to this hour, exclusive
+	Hours      []HourStat    `bson:"hours" json:"hours"`
+	ComputedAt time.Time     `bson:"computedAt" json:"computedAt"`
+}
+
+func ensureRiskBaselineIndexes() error {
+	_, err := riskBaselineCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "scope", Value: 1}, {Key: "key", Value: 1}, {Key: "metric", Value: 1}},
+		Options: options.Index().SetName("scope_key_metric_unique").SetUnique(true),
+	})
+	return err
+}
+
+// GetRiskBaseline returns the stored baseline if it covers data up to
+// through at the latest, or nil
+func GetRiskBaseline(ctx context.Context, scope, key, metric string, through time.Time) (*RiskBaseline, error) {
+	var b RiskBaseline
+	filter := bson.D{
+		{Key: "scope", Value: scope},
+		{Key: "key", Value: key},
+		{Key: "metric", Value: metric},
+		{Key: "through", Value: bson.D{{Key: "$lte", Value: through}}},
+	}
+	err := riskBaselineCollection.FindOne(ctx, filter).Decode(&b)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SaveRiskBaseline replaces the stored baseline unless that one already
+// covers later data
+func SaveRiskBaseline(ctx context.Context, b RiskBaseline) error {
+	filter := bson.D{
+		{Key: "scope", Value: b.Scope},
+		{Key: "key", Value: b.Key},
+		{Key: "metric", Value: b.Metric},
+		{Key: "through", Value: bson.D{{Key: "$lte", Value: b.Through}}},
+	}
+	b.ID = bson.ObjectID{}
+	_, err := riskBaselineCollection.ReplaceOne(ctx, filter, b, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// A newer baseline is stored; the upsert lost to the unique index
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func ensureTamperBatchIndexes() error {
+	_, err := tamperCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "batchSeq", Value: 1}},
+			Options: options.Index().SetName("batchSeq"),
+		},
+		{
+			Keys:    bson.D{{Key: "batchSeq", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("batchSeq_createdAt"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tamperBatchCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "seq", Value: 1}},
+			Options: options.Index().SetName("seq_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "logIds", Value: 1}},
+			Options: options.Index().SetName("logIds"),
+		},
+	})
+	return err
+}
+
+func unbatchedFilter() bson.D {
+	return bson.D{{Key: "batchSeq", Value: bson.D{{Key: "$exists", Value: false}}}}
+}
+
+// GetOldestUnbatchedTamperLog returns the earliest created record not yet
+// sealed into a Merkle batch, or nil
+func GetOldestUnbatchedTamperLog() (*TamperLog, error) {
+	var l TamperLog
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	err := tamperCollection.FindOne(context.TODO(), unbatchedFilter(), opts).Decode(&l)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetUnbatchedTamperLogs returns up to limit records created in [from, to)
+// and not yet sealed into a Merkle batch, oldest first
+func GetUnbatchedTamperLogs(from, to time.Time, limit int64) ([]TamperLog, error) {
+	filter := append(unbatchedFilter(), bson.E{Key: "createdAt", Value: bson.D{
+		{Key: "$gte", Value: from},
+		{Key: "$lt", Value: to},
+	}})
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := tamperCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var logs []TamperLog
+	if err := cursor.All(context.TODO(), &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// MarkTamperLogsBatched records which batch the given records were sealed in
+func MarkTamperLogsBatched(ids []bson.ObjectID, batchSeq int64) error {
+	filter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}},
+		{Key: "batchSeq", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "batchSeq", Value: batchSeq}}}}
+	_, err := tamperCollection.UpdateMany(context.TODO(), filter, update)
+	return err
+}
+
+func GetTamperLogByID(id bson.ObjectID) (*TamperLog, error) {
+	var l TamperLog
+	err := tamperCollection.FindOne(context.TODO(), bson.D{{Key: "_id", Value: id}}).Decode(&l)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+func GetLastTamperBatch() (*TamperBatch, error) {
+	var b TamperBatch
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+	err := tamperBatchCollection.FindOne(context.TODO(), bson.D{}, opts).Decode(&b)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+func GetTamperBatch(seq int64) (*TamperBatch, error) {
+	var b TamperBatch
+	err := tamperBatchCollection.FindOne(context.TODO(), bson.D{{Key: "seq", Value: seq}}).Decode(&b)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+func InsertTamperBatch(b TamperBatch) error {
+	_, err := tamperBatchCollection.InsertOne(context.TODO(), b)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTamperLogConflict
+	}
+	return err
+}
+
+// EachTamperBatch walks the batch chain in order
+func EachTamperBatch(fn func(TamperBatch) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := tamperBatchCollection.Find(context.TODO(), bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var b TamperBatch
+		if err := cursor.Decode(&b); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// GetTamperBatches returns the most recent batch roots, newest first, without
+// their leaves
+func GetTamperBatches(limit int64) ([]TamperBatch, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.D{{Key: "logIds", Value: 0}, {Key: "leaves", Value: 0}})
+	cursor, err := tamperBatchCollection.Find(context.TODO(), bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var batches []TamperBatch
+	if err := cursor.All(context.TODO(), &batches); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
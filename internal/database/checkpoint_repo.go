@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func GetLastTamperCheckpoint() (*TamperCheckpoint, error) {
+	var cp TamperCheckpoint
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+	err := tamperCheckpointCollection.FindOne(context.TODO(), bson.D{}, opts).Decode(&cp)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func InsertTamperCheckpoint(cp TamperCheckpoint) error {
+	_, err := tamperCheckpointCollection.InsertOne(context.TODO(), cp)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTamperLogConflict
+	}
+	return err
+}
+
+// EachTamperCheckpoint walks the checkpoint chain in order
+func EachTamperCheckpoint(fn func(TamperCheckpoint) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := tamperCheckpointCollection.Find(context.TODO(), bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var cp TamperCheckpoint
+		if err := cursor.Decode(&cp); err != nil {
+			return err
+		}
+		if err := fn(cp); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// GetTamperCheckpoints returns the most recent checkpoints, newest first
+func GetTamperCheckpoints(limit int64) ([]TamperCheckpoint, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(limit)
+	cursor, err := tamperCheckpointCollection.Find(context.TODO(), bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var cps []TamperCheckpoint
+	if err := cursor.All(context.TODO(), &cps); err != nil {
+		return nil, err
+	}
+	return cps, nil
+}
+
+// GetTamperCheckpointCovering returns the first checkpoint made at or after
+// t, falling back to the latest one, or nil if there are none
+func GetTamperCheckpointCovering(t time.Time) (*TamperCheckpoint, error) {
+	var cp TamperCheckpoint
+	filter := bson.D{{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: t}}}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "seq", Value: 1}})
+	err := tamperCheckpointCollection.FindOne(context.TODO(), filter, opts).Decode(&cp)
+	if err == mongo.ErrNoDocuments {
+		return GetLastTamperCheckpoint()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
@@ -14,7 +14,17 @@ var parkingLotCollection *mongo.Collection
 var imageCollection *mongo.Collection
 var reportCollection *mongo.Collection
 var riskScoreCollection *mongo.Collection
+var riskHistoryCollection *mongo.Collection
+var riskBaselineCollection *mongo.Collection
+var lotAuditCollection *mongo.Collection
+var riskRunCollection *mongo.Collection
+var lockCollection *mongo.Collection
 var tamperCollection *mongo.Collection
+var tamperCheckpointCollection *mongo.Collection
+var tamperBatchCollection *mongo.Collection
+var witnessedHeadCollection *mongo.Collection
+var parkingSessionCollection *mongo.Collection
+var reconciliationCollection *mongo.Collection
 
 var MongoDBURI string
 
@@ -41,7 +51,54 @@ func MongoDB() {
 	reportCollection = coll
 	coll = client.Database("parkproof_db").Collection("riskScores")
 	riskScoreCollection = coll
+	coll = client.Database("parkproof_db").Collection("riskHistory")
+	riskHistoryCollection = coll
+	coll = client.Database("parkproof_db").Collection("riskBaselines")
+	riskBaselineCollection = coll
+	coll = client.Database("parkproof_db").Collection("lotAudits")
+	lotAuditCollection = coll
+	coll = client.Database("parkproof_db").Collection("riskRuns")
+	riskRunCollection = coll
+	coll = client.Database("parkproof_db").Collection("locks")
+	lockCollection = coll
 	coll = client.Database("parkproof_db").Collection("tamperLogs")
 	tamperCollection = coll
+	coll = client.Database("parkproof_db").Collection("tamperCheckpoints")
+	tamperCheckpointCollection = coll
+	coll = client.Database("parkproof_db").Collection("tamperBatches")
+	tamperBatchCollection = coll
+	coll = client.Database("parkproof_db").Collection("witnessedHeads")
+	witnessedHeadCollection = coll
+	coll = client.Database("parkproof_db").Collection("parkingSessions")
+	parkingSessionCollection = coll
+	coll = client.Database("parkproof_db").Collection("reconciliationReports")
+	reconciliationCollection = coll
+	if err := ensureTamperIndexes(); err != nil {
+		log.Fatalf("Failed to create tamper log indexes: %v", err)
+	}
+	if err := ensureTamperQueryIndexes(); err != nil {
+		log.Fatalf("Failed to create tamper query indexes: %v", err)
+	}
+	if err := ensureTamperBatchIndexes(); err != nil {
+		log.Fatalf("Failed to create tamper batch indexes: %v", err)
+	}
+	if err := ensureWitnessIndexes(); err != nil {
+		log.Fatalf("Failed to create witness indexes: %v", err)
+	}
+	if err := ensureRiskHistoryIndexes(); err != nil {
+		log.Fatalf("Failed to create risk history indexes: %v", err)
+	}
+	if err := ensureRiskBaselineIndexes(); err != nil {
+		log.Fatalf("Failed to create risk baseline indexes: %v", err)
+	}
+	if err := ensureAuditIndexes(); err != nil {
+		log.Fatalf("Failed to create lot audit indexes: %v", err)
+	}
+	if err := ensureRiskRunIndexes(); err != nil {
+		log.Fatalf("Failed to create risk run indexes: %v", err)
+	}
+	if err := ensureLockIndexes(); err != nil {
+		log.Fatalf("Failed to create lock indexes: %v", err)
+	}
 	log.Println("MongoDB connected")
 }
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Lock is a lease on a named job shared by every backend replica
+type Lock struct {
+	Name      string    `bson:"_id" json:"name"`
+	Owner     string    `bson:"owner" json:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// InstanceID identifies this process as a lock owner
+var InstanceID = func() string {
+	host, _ := os.Hostname()
+	return host + "-" + uuid.New().String()[:8]
+}()
+
+func ensureLockIndexes() error {
+	// Expired leases are free to take anyway; this only tidies them up
+	_, err := lockCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// AcquireLock takes or extends the lease on name for ttl. It returns false
+// if another owner holds an unexpired lease.
+func AcquireLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.D{
+		{Key: "_id", Value: name},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "owner", Value: owner}},
+			bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$lte", Value: now}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "owner", Value: owner},
+		{Key: "expiresAt", Value: now.Add(ttl)},
+	}}}
+	_, err := lockCollection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The upsert collided with someone else's live lease
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReleaseLock gives up owner's lease on name, if it still has it
+func ReleaseLock(ctx context.Context, name, owner string) error {
+	_, err := lockCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: name}, {Key: "owner", Value: owner}})
+	return err
+}
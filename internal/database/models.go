@@ -16,22 +16,97 @@ type Report struct {
 }
 
 type RiskScore struct {
-	ID           bson.ObjectID `bson:"_id,omitempty"`
-	ParkingLotID bson.ObjectID `bson:"parkingLotId"`
-	Score        int           `bson:"score"`
-	Reason       string        `bson:"reason"`
-	Level        string        `bson:"level,omitempty"`      // keeping as optional
-	AnalyzedAt   time.Time     `bson:"analyzedAt,omitempty"` // keeping as optional
+	ID            bson.ObjectID `bson:"_id,omitempty"`
+	ParkingLotID  bson.ObjectID `bson:"parkingLotId"`
+	Score         int           `bson:"score"`
+	Reason        string        `bson:"reason"`
+	Level         string        `bson:"level,omitempty"`      // keeping as optional
+	AnalyzedAt    time.Time     `bson:"analyzedAt,omitempty"` // keeping as optional
+	LevelSince    time.Time     `bson:"levelSince,omitempty"` // start of the unbroken run at Level
+	PolicyVersion string        `bson:"policyVersion,omitempty"`
+	RunID         string        `bson:"runId,omitempty"`
+	Factors       []RiskFactor  `bson:"factors"`
 }
 
 type TamperLog struct {
 	ID            bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	ChainID       string        `bson:"chainId,omitempty" json:"chainId"` // parking lot whose chain this belongs to
+	Seq           int64         `bson:"seq,omitempty" json:"seq"`         // position in the chain, starting at 1
 	VehicleNo     string        `bson:"vehicleNo" json:"vehicleNo"`
 	VehicleType   string        `bson:"vehicleType" json:"vehicleType"`
 	ParkingLotID  string        `bson:"parkingLotId" json:"parkingLotId"`
 	EntryExitTime time.Time     `bson:"entryExitTime" json:"entryExitTime"`
 	Hash          string        `bson:"hash" json:"hash"`
+	HashVersion   int           `bson:"hashVersion,omitempty" json:"hashVersion"` // 0 = legacy encoding
 	PrevHash      string        `bson:"prevHash" json:"prevHash"`
 	Action        string        `bson:"action" json:"action"` // "ENTRY" or "EXIT"
 	CreatedAt     time.Time     `bson:"createdAt" json:"createdAt"`
+	BatchSeq      int64         `bson:"batchSeq,omitempty" json:"batchSeq,omitempty"` // Merkle batch this was sealed in
+}
+
+// LegacyChainID identifies the single global chain all lots shared before
+// each parking lot got its own. Its records have no chainId.
+const LegacyChainID = ""
+
+type ChainHead struct {
+	ChainID string `bson:"chainId" json:"chainId"`
+	Seq     int64  `bson:"seq" json:"seq"`
+	Hash    string `bson:"hash" json:"hash"`
+}
+
+// TamperCheckpoint commits to the head of every tamper chain at a point in
+// time. Checkpoints form their own hash chain.
+type TamperCheckpoint struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Seq       int64         `bson:"seq" json:"seq"`
+	Heads     []ChainHead   `bson:"heads" json:"heads"` // sorted by ChainID
+	PrevHash  string        `bson:"prevHash" json:"prevHash"`
+	Hash      string        `bson:"hash" json:"hash"`
+	KeyID     string        `bson:"keyId,omitempty" json:"keyId,omitempty"`
+	Signature string        `bson:"signature,omitempty" json:"signature,omitempty"` // Ed25519 over Hash
+	CreatedAt time.Time     `bson:"createdAt" json:"createdAt"`
+
+	// Added after the checkpoint is stored, so not covered by Hash
+	Witnesses []WitnessReceipt `bson:"witnesses,omitempty" json:"witnesses,omitempty"`
+}
+
+// WitnessReceipt is what an external witness gave back for a checkpoint
+type WitnessReceipt struct {
+	Witness     string    `bson:"witness" json:"witness"` // e.g. "file:/var/log/parkproof-witness.log"
+	Receipt     string    `bson:"receipt" json:"receipt"` // witness-specific, see internal/tamper/witness*.go
+	WitnessedAt time.Time `bson:"witnessedAt" json:"witnessedAt"`
+}
+
+// WitnessedHead is a checkpoint another ParkProof instance sent us to witness
+type WitnessedHead struct {
+	ID            bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Origin        string        `bson:"origin" json:"origin"`
+	CheckpointSeq int64         `bson:"checkpointSeq" json:"checkpointSeq"`
+	Hash          string        `bson:"hash" json:"hash"`
+	KeyID         string        `bson:"keyId,omitempty" json:"keyId,omitempty"`
+	Signature     string        `bson:"signature,omitempty" json:"signature,omitempty"` // the checkpoint's, over Hash
+	AttestedBy    string        `bson:"attestedBy" json:"attestedBy"`                   // key ID of the attestation
+	Attestation   string        `bson:"attestation" json:"attestation"`                 // over origin, seq and hash
+	CreatedAt     time.Time     `bson:"createdAt" json:"createdAt"`                     // when the origin made the checkpoint
+	ReceivedAt    time.Time     `bson:"receivedAt" json:"receivedAt"`
+}
+
+// TamperBatch seals a group of tamper logs under a Merkle root. Batches form
+// their own hash chain.
+type TamperBatch struct {
+	ID  bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	Seq int64         `bson:"seq" json:"seq"`
+	// The window of CreatedAt the leaves fall in, [From, To). Batches sealed
+	// before batches had fixed windows span their leaves' CreatedAt instead.
+	From      time.Time       `bson:"from" json:"from"`
+	To        time.Time       `bson:"to" json:"to"`
+	Size      int             `bson:"size" json:"size"`
+	LogIDs    []bson.ObjectID `bson:"logIds,omitempty" json:"logIds,omitempty"` // leaf order
+	Leaves    []string        `bson:"leaves,omitempty" json:"leaves,omitempty"` // record hashes, leaf order
+	Root      string          `bson:"root" json:"root"`
+	PrevHash  string          `bson:"prevHash" json:"prevHash"`
+	Hash      string          `bson:"hash" json:"hash"`
+	KeyID     string          `bson:"keyId,omitempty" json:"keyId,omitempty"`
+	Signature string          `bson:"signature,omitempty" json:"signature,omitempty"` // Ed25519 over Hash
+	CreatedAt time.Time       `bson:"createdAt" json:"createdAt"`
 }
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"time"
 
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type QueryStatus string
@@ -28,9 +31,24 @@ type Query struct {
 	Reply            string      `json:"reply" bson:"reply"`
 	ReplyImage       string      `json:"reply_image" bson:"reply_image"`
 	RepliedAt        time.Time   `json:"replied_at" bson:"replied_at"`
+
+	// Set on queries the risk engine sent, to the run that sent them. Never
+	// sent to attendants; admins see it through the risk evidence endpoint.
+	RiskRunID string `json:"-" bson:"risk_run_id,omitempty"`
+}
+
+// CreateQuery gives q an ID, marks it open and stores it. Admin queries and
+// the risk engine's verification queries both go through here.
+func CreateQuery(ctx context.Context, q Query) (Query, error) {
+	q.ID = "query" + uuid.New().String()
+	q.Status = QueryStatusOpen
+	if q.Time.IsZero() {
+		q.Time = time.Now()
+	}
+	return q, AddQuery(ctx, q)
 }
 
-func AddQuery(q Query) error {
+func AddQuery(ctx context.Context, q Query) error {
 	if q.ToParkingLot == "" {
 		return errors.New("Parking Lot ID can't be Empty")
 	}
@@ -38,7 +56,6 @@ func AddQuery(q Query) error {
 		return errors.New("Query can't be Empty")
 	}
 
-	ctx := context.TODO()
 	_, err := queryCollection.InsertOne(ctx, q)
 	return err
 }
@@ -70,9 +87,7 @@ func GetQueryByID(id string) (Query, error) {
 	return q, nil
 }
 
-func GetQueryByParkingLot(id string) ([]Query, error) {
-	ctx := context.TODO()
-
+func GetQueryByParkingLot(ctx context.Context, id string) ([]Query, error) {
 	var q []Query
 	// Pass a filter document, not a string
 	res, err := queryCollection.Find(ctx, bson.M{"to_parking_lot": id})
@@ -85,3 +100,19 @@ func GetQueryByParkingLot(id string) ([]Query, error) {
 	}
 	return q, nil
 }
+
+// GetLastRiskQuery returns the newest query the risk engine sent to a lot
+func GetLastRiskQuery(ctx context.Context, lotID string) (*Query, error) {
+	filter := bson.M{"to_parking_lot": lotID, "risk_run_id": bson.M{"$exists": true}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "time", Value: -1}})
+
+	var q Query
+	err := queryCollection.FindOne(ctx, filter, opts).Decode(&q)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
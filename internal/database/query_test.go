@@ -0,0 +1,39 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Attendants get queries as JSON; which came from the risk engine is only
+// stored
+func TestQueryHidesRiskRun(t *testing.T) {
+	q := Query{ID: "query1", Query: "Photograph the entry board now", ToParkingLot: "lot", Type: "TEXT", RiskRunID: "run-42"}
+
+	out, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "run-42") || strings.Contains(string(out), "risk_run_id") {
+		t.Errorf("JSON shows the risk run: %s", out)
+	}
+
+	doc, err := bson.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := bson.Raw(doc).Lookup("risk_run_id").StringValueOK(); !ok || got != "run-42" {
+		t.Errorf("stored risk_run_id = %q, want run-42", got)
+	}
+	// An admin's query stores none, so the engine's cooldown ignores it
+	doc, err = bson.Marshal(Query{ID: "query2", Query: "Where is the attendant?", ToParkingLot: "lot", Type: "TEXT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bson.Raw(doc).LookupErr("risk_run_id"); err == nil {
+		t.Error("admin query stored a risk_run_id")
+	}
+}
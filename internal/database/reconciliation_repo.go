@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type Discrepancy struct {
+	Kind         string    `bson:"kind" json:"kind"`
+	ParkingLotID string    `bson:"parkingLotId" json:"parkingLotId"`
+	VehicleNo    string    `bson:"vehicleNo" json:"vehicleNo"`
+	At           time.Time `bson:"at" json:"at"`
+	LogID        string    `bson:"logId,omitempty" json:"logId,omitempty"`
+	SessionID    string    `bson:"sessionId,omitempty" json:"sessionId,omitempty"`
+	TicketID     string    `bson:"ticketId,omitempty" json:"ticketId,omitempty"`
+}
+
+// ReconciliationReport compares the tamper log against sessions and tickets
+// for a time window
+type ReconciliationReport struct {
+	ID              bson.ObjectID  `bson:"_id,omitempty" json:"id"`
+	ParkingLotID    string         `bson:"parkingLotId,omitempty" json:"parkingLotId,omitempty"` // empty = all lots
+	From            time.Time      `bson:"from" json:"from"`
+	To              time.Time      `bson:"to" json:"to"`
+	LogsChecked     int            `bson:"logsChecked" json:"logsChecked"`
+	SessionsChecked int            `bson:"sessionsChecked" json:"sessionsChecked"`
+	TicketsChecked  int            `bson:"ticketsChecked" json:"ticketsChecked"`
+	Counts          map[string]int `bson:"counts" json:"counts"` // discrepancies per kind
+	Discrepancies   []Discrepancy  `bson:"discrepancies" json:"discrepancies"`
+	GeneratedAt     time.Time      `bson:"generatedAt" json:"generatedAt"`
+}
+
+func SaveReconciliationReport(r ReconciliationReport) error {
+	_, err := reconciliationCollection.InsertOne(context.TODO(), r)
+	return err
+}
+
+// GetLastReconciliationReport returns the latest report covering all lots
+func GetLastReconciliationReport() (*ReconciliationReport, error) {
+	var r ReconciliationReport
+	filter := bson.D{{Key: "parkingLotId", Value: bson.D{{Key: "$exists", Value: false}}}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "to", Value: -1}})
+	err := reconciliationCollection.FindOne(context.TODO(), filter, opts).Decode(&r)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetReconciliationReports returns the latest reports, newest first
+func GetReconciliationReports(limit int64) ([]ReconciliationReport, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "to", Value: -1}}).SetLimit(limit)
+	cursor, err := reconciliationCollection.Find(context.TODO(), bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	reports := []ReconciliationReport{}
+	if err := cursor.All(context.TODO(), &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
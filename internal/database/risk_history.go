@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Resolutions of a RiskHistoryEntry
+const (
+	RiskResolutionRun = "run" // one analysis run, as recorded
+	RiskResolutionDay = "day" // all runs of a UTC day, folded together
+)
+
+// RiskEvidence points at a record a risk factor is based on. Link is the
+// API path that returns it.
+type RiskEvidence struct {
+	Kind string `bson:"kind" json:"kind"` // report, ticket, query, session or traffic
+	ID   string `bson:"id" json:"id"`
+	Link string `bson:"link,omitempty" json:"link,omitempty"`
+}
+
+// RiskFactor is what one rule added to a score, and why
+type RiskFactor struct {
+	Rule     string         `bson:"rule" json:"rule"`
+	Points   int            `bson:"points" json:"points"`
+	Message  string         `bson:"message" json:"message"`
+	Counts   map[string]int `bson:"counts,omitempty" json:"counts,omitempty"`
+	Evidence []RiskEvidence `bson:"evidence,omitempty" json:"evidence,omitempty"`
+	Fired    int            `bson:"fired,omitempty" json:"fired,omitempty"` // day entries: runs the rule fired in
+}
+
+// RiskHistoryEntry is an immutable record of one analysis run for a lot.
+// Old runs are folded into one entry per day (Resolution "day") whose Score
+// is the day's average and Level the worst level seen; its factors carry the
+// average points and the last run's counts and evidence.
+type RiskHistoryEntry struct {
+	ID            bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	RunID         string        `bson:"runId,omitempty" json:"runId,omitempty"`
+	ParkingLotID  bson.ObjectID `bson:"parkingLotId" json:"parkingLotId"`
+	Score         int           `bson:"score" json:"score"`
+	Level         string        `bson:"level" json:"level"`
+	Reason        string        `bson:"reason" json:"reason"`
+	PolicyVersion string        `bson:"policyVersion,omitempty" json:"policyVersion,omitempty"`
+	Factors       []RiskFactor  `bson:"factors" json:"factors"`
+	Historical    int           `bson:"historical" json:"historical"` // points carried over from the previous score
+	AnalyzedAt    time.Time     `bson:"analyzedAt" json:"analyzedAt"`
+	Resolution    string        `bson:"resolution" json:"resolution"`
+	Samples       int           `bson:"samples" json:"samples"`
+	MinScore      int           `bson:"minScore" json:"minScore"`
+	MaxScore      int           `bson:"maxScore" json:"maxScore"`
+}
+
+func ensureRiskHistoryIndexes() error {
+	_, err := riskHistoryCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "parkingLotId", Value: 1}, {Key: "analyzedAt", Value: 1}},
+			Options: options.Index().SetName("lot_analyzedAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "resolution", Value: 1}, {Key: "analyzedAt", Value: 1}},
+			Options: options.Index().SetName("resolution_analyzedAt"),
+		},
+	})
+	return err
+}
+
+func InsertRiskHistory(ctx context.Context, entry RiskHistoryEntry) error {
+	_, err := riskHistoryCollection.InsertOne(ctx, entry)
+	return err
+}
+
+// GetRiskHistory returns a lot's latest limit entries analyzed in
+// [from, to), oldest first
+func GetRiskHistory(ctx context.Context, parkingLotID string, from, to time.Time, limit int64) ([]RiskHistoryEntry, error) {
+	objID, err := bson.ObjectIDFromHex(parkingLotID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{
+		{Key: "parkingLotId", Value: objID},
+		{Key: "analyzedAt", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	}
+	// Newest first so the limit drops the oldest entries, then flipped
+	opts := options.Find().SetSort(bson.D{{Key: "analyzedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := riskHistoryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []RiskHistoryEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// EachRawRiskHistoryBefore calls fn with every per-run entry analyzed before
+// t, grouped by lot and oldest first
+func EachRawRiskHistoryBefore(ctx context.Context, t time.Time, fn func(RiskHistoryEntry) error) error {
+	filter := bson.D{
+		{Key: "resolution", Value: RiskResolutionRun},
+		{Key: "analyzedAt", Value: bson.D{{Key: "$lt", Value: t}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "parkingLotId", Value: 1}, {Key: "analyzedAt", Value: 1}})
+	cursor, err := riskHistoryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry RiskHistoryEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ReplaceRiskHistoryDay stores a day entry, replacing any earlier one for the
+// same lot and day, then removes the runs it was folded from
+func ReplaceRiskHistoryDay(ctx context.Context, day RiskHistoryEntry, runIDs []bson.ObjectID) error {
+	filter := bson.D{
+		{Key: "parkingLotId", Value: day.ParkingLotID},
+		{Key: "resolution", Value: RiskResolutionDay},
+		{Key: "analyzedAt", Value: day.AnalyzedAt},
+	}
+	day.ID = bson.ObjectID{}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := riskHistoryCollection.ReplaceOne(ctx, filter, day, opts); err != nil {
+		return err
+	}
+
+	_, err := riskHistoryCollection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: runIDs}}}})
+	return err
+}
+
+// DeleteRiskHistoryBefore drops every entry analyzed before t
+func DeleteRiskHistoryBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := riskHistoryCollection.DeleteMany(ctx, bson.D{{Key: "analyzedAt", Value: bson.D{{Key: "$lt", Value: t}}}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// GetRiskHistoryAt returns a lot's newest entry analyzed at or before t, or
+// nil if there is none
+func GetRiskHistoryAt(ctx context.Context, parkingLotID bson.ObjectID, t time.Time) (*RiskHistoryEntry, error) {
+	filter := bson.D{
+		{Key: "parkingLotId", Value: parkingLotID},
+		{Key: "analyzedAt", Value: bson.D{{Key: "$lte", Value: t}}},
+	}
+	return findOneRiskHistory(ctx, filter, -1)
+}
+
+// GetRiskHistoryScoresAt returns each lot's score as of t: that of its
+// newest entry analyzed at or before t, looking back at most lookBack.
+// Lots without one are left out.
+func GetRiskHistoryScoresAt(ctx context.Context, lotIDs []bson.ObjectID, t time.Time, lookBack time.Duration) (map[bson.ObjectID]int, error) {
+	cursor, err := riskHistoryCollection.Aggregate(ctx, scoresAtPipeline(lotIDs, t, lookBack))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	scores := make(map[bson.ObjectID]int)
+	for cursor.Next(ctx) {
+		var row struct {
+			Lot   bson.ObjectID `bson:"_id"`
+			Score int           `bson:"score"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		scores[row.Lot] = row.Score
+	}
+	return scores, cursor.Err()
+}
+
+// scoresAtPipeline picks each lot's newest entry in (t-lookBack, t]
+func scoresAtPipeline(lotIDs []bson.ObjectID, t time.Time, lookBack time.Duration) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "parkingLotId", Value: bson.D{{Key: "$in", Value: lotIDs}}},
+			{Key: "analyzedAt", Value: bson.D{{Key: "$gt", Value: t.Add(-lookBack)}, {Key: "$lte", Value: t}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "parkingLotId", Value: 1}, {Key: "analyzedAt", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$parkingLotId"},
+			{Key: "score", Value: bson.D{{Key: "$first", Value: "$score"}}},
+		}}},
+	}
+}
+
+// GetLevelStart returns when a lot's current unbroken run at level began:
+// the first entry after the last one at a different level. It's the zero
+// time if the lot has no history at level.
+func GetLevelStart(ctx context.Context, parkingLotID bson.ObjectID, level string) (time.Time, error) {
+	filter := bson.D{{Key: "parkingLotId", Value: parkingLotID}}
+	other, err := findOneRiskHistory(ctx, append(filter, bson.E{Key: "level", Value: bson.D{{Key: "$ne", Value: level}}}), -1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if other != nil {
+		filter = append(filter, bson.E{Key: "analyzedAt", Value: bson.D{{Key: "$gt", Value: other.AnalyzedAt}}})
+	}
+	first, err := findOneRiskHistory(ctx, filter, 1)
+	if err != nil || first == nil {
+		return time.Time{}, err
+	}
+	return first.AnalyzedAt, nil
+}
+
+func findOneRiskHistory(ctx context.Context, filter bson.D, order int) (*RiskHistoryEntry, error) {
+	var entry RiskHistoryEntry
+	opts := options.FindOne().SetSort(bson.D{{Key: "analyzedAt", Value: order}})
+	err := riskHistoryCollection.FindOne(ctx, filter, opts).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestScoresAtPipeline(t *testing.T) {
+	at := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	lots := []bson.ObjectID{bson.NewObjectID(), bson.NewObjectID()}
+	p := scoresAtPipeline(lots, at, 48*time.Hour)
+	if len(p) != 3 {
+		t.Fatalf("got %d stages, want match, sort and group", len(p))
+	}
+
+	// Entries in (at-48h, at]: an entry exactly lookBack old is too old,
+	// one exactly at t counts
+	match := bson.D{
+		{Key: "parkingLotId", Value: bson.D{{Key: "$in", Value: lots}}},
+		{Key: "analyzedAt", Value: bson.D{{Key: "$gt", Value: at.Add(-48 * time.Hour)}, {Key: "$lte", Value: at}}},
+	}
+	if got := p[0][0]; got.Key != "$match" || !reflect.DeepEqual(got.Value, match) {
+		t.Errorf("match stage = %v, want %v", got, match)
+	}
+	// Newest first within each lot, so $first is the score as of t
+	sort := bson.D{{Key: "parkingLotId", Value: 1}, {Key: "analyzedAt", Value: -1}}
+	if got := p[1][0]; got.Key != "$sort" || !reflect.DeepEqual(got.Value, sort) {
+		t.Errorf("sort stage = %v, want %v", got, sort)
+	}
+	group := bson.D{{Key: "_id", Value: "$parkingLotId"}, {Key: "score", Value: bson.D{{Key: "$first", Value: "$score"}}}}
+	if got := p[2][0]; got.Key != "$group" || !reflect.DeepEqual(got.Value, group) {
+		t.Errorf("group stage = %v, want %v", got, group)
+	}
+}
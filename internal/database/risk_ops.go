@@ -5,11 +5,13 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-// GetReportsLast48Hours returns reports for a parking lot in the last 48 hours
-func GetReportsLast48Hours(parkingLotID string) ([]Report, error) {
+// GetReportsLastWindow returns reports for a parking lot in the duration
+// window ending at asOf, oldest first
+func GetReportsLastWindow(ctx context.Context, parkingLotID string, asOf time.Time, duration time.Duration) ([]Report, error) {
 	objID, err := bson.ObjectIDFromHex(parkingLotID)
 	if err != nil {
 		return nil, err
@@ -17,24 +19,27 @@ func GetReportsLast48Hours(parkingLotID string) ([]Report, error) {
 
 	filter := bson.D{
 		{Key: "parkingLotId", Value: objID},
-		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: time.Now().Add(-48 * time.Hour)}}},
+		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: asOf.Add(-duration)}, {Key: "$lt", Value: asOf}}},
 	}
 
-	cursor, err := reportCollection.Find(context.TODO(), filter)
+	// Rule 1 counts a user's reports 24h apart, so it needs them in order
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := reportCollection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	var reports []Report
-	if err := cursor.All(context.TODO(), &reports); err != nil {
+	if err := cursor.All(ctx, &reports); err != nil {
 		return nil, err
 	}
 	return reports, nil
 }
 
-// GetTicketsLastWindow returns tickets created in the last duration window
-func GetTicketsLastWindow(parkingLotID string, duration time.Duration) ([]Ticket, error) {
+// GetTicketsLastWindow returns tickets created in the duration window
+// ending at asOf
+func GetTicketsLastWindow(ctx context.Context, parkingLotID string, asOf time.Time, duration time.Duration) ([]Ticket, error) {
 	objID, err := bson.ObjectIDFromHex(parkingLotID)
 	if err != nil {
 		return nil, err
@@ -42,55 +47,62 @@ func GetTicketsLastWindow(parkingLotID string, duration time.Duration) ([]Ticket
 
 	filter := bson.D{
 		{Key: "parkingLotId", Value: objID},
-		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: time.Now().Add(-duration)}}},
+		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: asOf.Add(-duration)}, {Key: "$lt", Value: asOf}}},
 	}
 
-	cursor, err := ticketCollection.Find(context.TODO(), filter)
+	cursor, err := ticketCollection.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	var tickets []Ticket
-	if err := cursor.All(context.TODO(), &tickets); err != nil {
+	if err := cursor.All(ctx, &tickets); err != nil {
 		return nil, err
 	}
 	return tickets, nil
 }
 
-// GetAllParkingLotIDs returns all parking lot IDs
-func GetAllParkingLotIDs() ([]string, error) {
-	cursor, err := parkingLotCollection.Find(context.TODO(), bson.D{})
+// GetAllParkingLots returns all parking lots
+func GetAllParkingLots(ctx context.Context) ([]ParkingLot, error) {
+	cursor, err := parkingLotCollection.Find(ctx, bson.D{})
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	defer cursor.Close(ctx)
 
 	var lots []ParkingLot
-	if err := cursor.All(context.TODO(), &lots); err != nil {
+	if err := cursor.All(ctx, &lots); err != nil {
 		return nil, err
 	}
+	return lots, nil
+}
 
-	var ids []string
-	for _, lot := range lots {
-		ids = append(ids, lot.ID.Hex())
+// GetParkingLot returns one parking lot by ID
+func GetParkingLot(ctx context.Context, id string) (ParkingLot, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return ParkingLot{}, err
 	}
-	return ids, nil
+
+	var lot ParkingLot
+	err = parkingLotCollection.FindOne(ctx, bson.D{{Key: "_id", Value: objID}}).Decode(&lot)
+	return lot, err
 }
 
-// SaveRiskScore saves the risk analysis result
-// SaveRiskScore updates or inserts the risk analysis result
-func SaveRiskScore(score RiskScore) error {
+// SaveRiskScore updates or inserts the latest risk analysis result. The
+// full series is kept in riskHistory (see InsertRiskHistory).
+func SaveRiskScore(ctx context.Context, score RiskScore) error {
 	filter := bson.D{{Key: "parkingLotId", Value: score.ParkingLotID}}
 	update := bson.D{{Key: "$set", Value: score}}
 	opts := options.UpdateOne().SetUpsert(true)
 
-	_, err := riskScoreCollection.UpdateOne(context.TODO(), filter, update, opts)
+	_, err := riskScoreCollection.UpdateOne(ctx, filter, update, opts)
 	return err
 }
 
 // GetRiskScore returns the current risk score for a parking lot
-func GetRiskScore(parkingLotID string) (RiskScore, error) {
+func GetRiskScore(ctx context.Context, parkingLotID string) (RiskScore, error) {
 	objID, err := bson.ObjectIDFromHex(parkingLotID)
 	if err != nil {
 		return RiskScore{}, err
@@ -98,9 +110,122 @@ func GetRiskScore(parkingLotID string) (RiskScore, error) {
 
 	var score RiskScore
 	filter := bson.D{{Key: "parkingLotId", Value: objID}}
-	err = riskScoreCollection.FindOne(context.TODO(), filter).Decode(&score)
+	err = riskScoreCollection.FindOne(ctx, filter).Decode(&score)
 	if err != nil {
 		return RiskScore{}, err
 	}
 	return score, nil
 }
+
+// GetReportByID returns a single citizen report
+func GetReportByID(ctx context.Context, id string) (Report, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+	err = reportCollection.FindOne(ctx, bson.D{{Key: "_id", Value: objID}}).Decode(&report)
+	return report, err
+}
+
+// GetTicketByID returns a single ticket
+func GetTicketByID(ctx context.Context, id string) (Ticket, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	var ticket Ticket
+	err = ticketCollection.FindOne(ctx, bson.D{{Key: "_id", Value: objID}}).Decode(&ticket)
+	return ticket, err
+}
+
+// GetParkingLotsByArea returns every parking lot in an area
+func GetParkingLotsByArea(ctx context.Context, area string) ([]ParkingLot, error) {
+	cursor, err := parkingLotCollection.Find(ctx, bson.D{{Key: "area", Value: area}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var lots []ParkingLot
+	if err := cursor.All(ctx, &lots); err != nil {
+		return nil, err
+	}
+	return lots, nil
+}
+
+// CountEntriesByLot counts session entries per lot in [from, to)
+func CountEntriesByLot(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error) {
+	return sumByLot(ctx, parkingSessionCollection, "entryTime", 1, lotIDs, from, to)
+}
+
+// CountTicketsByLot counts tickets created per lot in [from, to)
+func CountTicketsByLot(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error) {
+	return sumByLot(ctx, ticketCollection, "createdAt", 1, lotIDs, from, to)
+}
+
+// SumTicketRevenueByLot adds up ticket amounts per lot in [from, to)
+func SumTicketRevenueByLot(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error) {
+	return sumByLot(ctx, ticketCollection, "createdAt", "$amount", lotIDs, from, to)
+}
+
+// CountReportsByHour counts citizen reports made in [from, to) per lot and
+// hour, like CountEntriesByHour
+func CountReportsByHour(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time, tz string) (map[bson.ObjectID]map[time.Time]int, error) {
+	return countByHour(ctx, reportCollection, "createdAt", lotIDs, from, to, tz)
+}
+
+// CountReportsByLot counts citizen reports per lot in [from, to)
+func CountReportsByLot(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error) {
+	return sumByLot(ctx, reportCollection, "createdAt", 1, lotIDs, from, to)
+}
+
+func sumByLot(ctx context.Context, coll *mongo.Collection, timeField string, sum any, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error) {
+	match := bson.D{
+		{Key: "parkingLotId", Value: bson.D{{Key: "$in", Value: lotIDs}}},
+		{Key: timeField, Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$parkingLotId"},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: sum}}},
+		}}},
+	}
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	totals := make(map[bson.ObjectID]float64)
+	for cursor.Next(ctx) {
+		var row struct {
+			Lot   bson.ObjectID `bson:"_id"`
+			Total float64       `bson:"total"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		totals[row.Lot] = row.Total
+	}
+	return totals, cursor.Err()
+}
+
+// GetAllRiskScores returns the latest score of every lot
+func GetAllRiskScores(ctx context.Context) ([]RiskScore, error) {
+	cursor, err := riskScoreCollection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var scores []RiskScore
+	if err := cursor.All(ctx, &scores); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Risk run statuses
+const (
+	RiskRunRunning   = "running"
+	RiskRunCompleted = "completed"
+	RiskRunCancelled = "cancelled"
+	RiskRunFailed    = "failed" // couldn't list the lots, or its server stopped mid-run
+)
+
+// RiskRunStatuses are every status a run can have
+var RiskRunStatuses = []string{RiskRunRunning, RiskRunCompleted, RiskRunCancelled, RiskRunFailed}
+
+// maxRunFailures caps the failures kept on a run; Failed stays exact
+const maxRunFailures = 100
+
+// RiskRun is one analysis pass, over every lot or a single one. Its ID is
+// the run ID stamped on the scores and history it wrote.
+type RiskRun struct {
+	ID           string    `bson:"_id" json:"id"`
+	Trigger      string    `bson:"trigger" json:"trigger"` // schedule or manual
+	ParkingLotID string    `bson:"parkingLotId,omitempty" json:"parkingLotId,omitempty"`
+	Status       string    `bson:"status" json:"status"`
+	Owner        string    `bson:"owner" json:"owner"` // InstanceID of the server running it
+	StartedAt    time.Time `bson:"startedAt" json:"startedAt"`
+	HeartbeatAt  time.Time `bson:"heartbeatAt" json:"heartbeatAt"` // renewed while running
+	// Set when asked to stop; the owner sees it on its next heartbeat
+	CancelRequestedAt *time.Time       `bson:"cancelRequestedAt,omitempty" json:"cancelRequestedAt,omitempty"`
+	EndedAt           *time.Time       `bson:"endedAt,omitempty" json:"endedAt,omitempty"`
+	DurationMs        int64            `bson:"durationMs" json:"durationMs"`
+	Lots              int              `bson:"lots" json:"lots"`           // lots the run set out to analyze
+	Processed         int              `bson:"processed" json:"processed"` // including failed ones
+	Failed            int              `bson:"failed" json:"failed"`
+	Failures          []RiskRunFailure `bson:"failures,omitempty" json:"failures,omitempty"`
+	Error             string           `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// RiskRunFailure is a lot a run couldn't score
+type RiskRunFailure struct {
+	ParkingLotID string `bson:"parkingLotId" json:"parkingLotId"`
+	Error        string `bson:"error" json:"error"`
+}
+
+func ensureRiskRunIndexes() error {
+	_, err := riskRunCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "startedAt", Value: -1}},
+		Options: options.Index().SetName("startedAt"),
+	})
+	return err
+}
+
+func InsertRiskRun(run RiskRun) error {
+	_, err := riskRunCollection.InsertOne(context.TODO(), run)
+	return err
+}
+
+// SetRiskRunLots records how many lots a run is going to analyze
+func SetRiskRunLots(id string, lots int) error {
+	_, err := riskRunCollection.UpdateOne(context.TODO(),
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "lots", Value: lots}}}},
+	)
+	return err
+}
+
+// AddRiskRunProgress counts one more lot done, and its failure if it failed
+func AddRiskRunProgress(id string, failure *RiskRunFailure) error {
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "processed", Value: 1}}}}
+	if failure != nil {
+		update = bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "processed", Value: 1}, {Key: "failed", Value: 1}}},
+			{Key: "$push", Value: bson.D{{Key: "failures", Value: bson.D{
+				{Key: "$each", Value: bson.A{failure}},
+				{Key: "$slice", Value: maxRunFailures},
+			}}}},
+		}
+	}
+	_, err := riskRunCollection.UpdateOne(context.TODO(), bson.D{{Key: "_id", Value: id}}, update)
+	return err
+}
+
+// TouchRiskRun renews a running run's heartbeat and reports whether it
+// has been asked to stop
+func TouchRiskRun(id string) (bool, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.D{{Key: "cancelRequestedAt", Value: 1}})
+	var run RiskRun
+	err := riskRunCollection.FindOneAndUpdate(context.TODO(),
+		bson.D{{Key: "_id", Value: id}, {Key: "status", Value: RiskRunRunning}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "heartbeatAt", Value: time.Now()}}}},
+		opts,
+	).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return run.CancelRequestedAt != nil, nil
+}
+
+// RequestRiskRunCancel asks the server running a run to stop it. It
+// returns false if the run isn't running.
+func RequestRiskRunCancel(id string) (bool, error) {
+	res, err := riskRunCollection.UpdateOne(context.TODO(),
+		bson.D{{Key: "_id", Value: id}, {Key: "status", Value: RiskRunRunning}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "cancelRequestedAt", Value: time.Now()}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// FailStaleRiskRuns marks running runs whose heartbeat stopped before
+// before as failed: their server went away without finishing them. Runs
+// from before heartbeats were kept go by their start.
+func FailStaleRiskRuns(before time.Time) (int64, error) {
+	filter := bson.D{
+		{Key: "status", Value: RiskRunRunning},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "heartbeatAt", Value: bson.D{{Key: "$lt", Value: before}}}},
+			bson.D{
+				{Key: "heartbeatAt", Value: bson.D{{Key: "$exists", Value: false}}},
+				{Key: "startedAt", Value: bson.D{{Key: "$lt", Value: before}}},
+			},
+		}},
+	}
+	now := time.Now()
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: RiskRunFailed},
+		{Key: "error", Value: "abandoned: its server stopped before finishing it"},
+		{Key: "endedAt", Value: now},
+		{Key: "durationMs", Value: bson.D{{Key: "$subtract", Value: bson.A{now, "$startedAt"}}}},
+	}}}}
+	res, err := riskRunCollection.UpdateMany(context.TODO(), filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// FinishRiskRun sets a run's final status and duration
+func FinishRiskRun(id, status, runErr string, startedAt, endedAt time.Time) error {
+	set := bson.D{
+		{Key: "status", Value: status},
+		{Key: "endedAt", Value: endedAt},
+		{Key: "durationMs", Value: endedAt.Sub(startedAt).Milliseconds()},
+	}
+	if runErr != "" {
+		set = append(set, bson.E{Key: "error", Value: runErr})
+	}
+	_, err := riskRunCollection.UpdateOne(context.TODO(),
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	return err
+}
+
+func GetRiskRun(id string) (RiskRun, error) {
+	var run RiskRun
+	err := riskRunCollection.FindOne(context.TODO(), bson.D{{Key: "_id", Value: id}}).Decode(&run)
+	return run, err
+}
+
+// GetRiskRuns returns the latest runs, newest first, optionally only those
+// with a status
+func GetRiskRuns(status string, limit int64) ([]RiskRun, error) {
+	filter := bson.D{}
+	if status != "" {
+		filter = append(filter, bson.E{Key: "status", Value: status})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := riskRunCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	runs := []RiskRun{}
+	if err := cursor.All(context.TODO(), &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetLastRiskRun returns the newest run of every lot with a trigger, or nil
+func GetLastRiskRun(trigger string) (*RiskRun, error) {
+	filter := bson.D{
+		{Key: "trigger", Value: trigger},
+		{Key: "parkingLotId", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "startedAt", Value: -1}})
+
+	var run RiskRun
+	err := riskRunCollection.FindOne(context.TODO(), filter, opts).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ParkingSession is written by the Next.js app when an attendant logs a
+// vehicle in (and closed on exit)
+type ParkingSession struct {
+	ID            bson.ObjectID `bson:"_id"`
+	ParkingLotID  bson.ObjectID `bson:"parkingLotId"`
+	UserID        bson.ObjectID `bson:"userId,omitempty"`
+	VehicleNumber string        `bson:"vehicleNumber"`
+	EntryTime     time.Time     `bson:"entryTime"`
+	ExitTime      *time.Time    `bson:"exitTime,omitempty"` // nil while ACTIVE
+	EntryMethod   string        `bson:"entryMethod"`        // "QR" or "OFFLINE"
+	Status        string        `bson:"status"`             // "ACTIVE" or "CLOSED"
+	CreatedAt     time.Time     `bson:"createdAt"`
+}
+
+// lotFilter matches documents of one parking lot, or all if parkingLotID is ""
+func lotFilter(parkingLotID string) (bson.D, error) {
+	if parkingLotID == "" {
+		return bson.D{}, nil
+	}
+	objID, err := bson.ObjectIDFromHex(parkingLotID)
+	if err != nil {
+		return nil, err
+	}
+	return bson.D{{Key: "parkingLotId", Value: objID}}, nil
+}
+
+// GetSessionsBetween returns sessions that started or ended in [from, to)
+func GetSessionsBetween(parkingLotID string, from, to time.Time) ([]ParkingSession, error) {
+	filter, err := lotFilter(parkingLotID)
+	if err != nil {
+		return nil, err
+	}
+	inRange := bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}
+	filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+		bson.D{{Key: "entryTime", Value: inRange}},
+		bson.D{{Key: "exitTime", Value: inRange}},
+	}})
+
+	cursor, err := parkingSessionCollection.Find(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var sessions []ParkingSession
+	if err := cursor.All(context.TODO(), &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetSessionByID returns a single parking session
+func GetSessionByID(id string) (ParkingSession, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return ParkingSession{}, err
+	}
+
+	var session ParkingSession
+	err = parkingSessionCollection.FindOne(context.TODO(), bson.D{{Key: "_id", Value: objID}}).Decode(&session)
+	return session, err
+}
+
+// GetSessionsOverlapping returns sessions open at any point in [from, to):
+// entered before to and not exited before from
+func GetSessionsOverlapping(ctx context.Context, parkingLotID string, from, to time.Time) ([]ParkingSession, error) {
+	filter, err := lotFilter(parkingLotID)
+	if err != nil {
+		return nil, err
+	}
+	filter = append(filter,
+		bson.E{Key: "entryTime", Value: bson.D{{Key: "$lt", Value: to}}},
+		bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "exitTime", Value: bson.D{{Key: "$gte", Value: from}}}},
+			bson.D{{Key: "exitTime", Value: nil}},
+		}},
+	)
+
+	opts := options.Find().SetSort(bson.D{{Key: "entryTime", Value: 1}})
+	cursor, err := parkingSessionCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []ParkingSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetUsedTicketsBetween returns pre-booked tickets redeemed in [from, to)
+func GetUsedTicketsBetween(parkingLotID string, from, to time.Time) ([]Ticket, error) {
+	filter, err := lotFilter(parkingLotID)
+	if err != nil {
+		return nil, err
+	}
+	filter = append(filter,
+		bson.E{Key: "status", Value: "USED"},
+		bson.E{Key: "usedAt", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	)
+
+	cursor, err := ticketCollection.Find(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var tickets []Ticket
+	if err := cursor.All(context.TODO(), &tickets); err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+// CountEntriesByHour counts session entries in [from, to) per lot and hour.
+// Hours start on the hour in tz, a UTC offset such as "+05:30".
+func CountEntriesByHour(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time, tz string) (map[bson.ObjectID]map[time.Time]int, error) {
+	return countByHour(ctx, parkingSessionCollection, "entryTime", lotIDs, from, to, tz)
+}
+
+// CountTicketsByHour counts tickets created in [from, to) per lot and hour,
+// like CountEntriesByHour
+func CountTicketsByHour(ctx context.Context, lotIDs []bson.ObjectID, from, to time.Time, tz string) (map[bson.ObjectID]map[time.Time]int, error) {
+	return countByHour(ctx, ticketCollection, "createdAt", lotIDs, from, to, tz)
+}
+
+func countByHour(ctx context.Context, coll *mongo.Collection, timeField string, lotIDs []bson.ObjectID, from, to time.Time, tz string) (map[bson.ObjectID]map[time.Time]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "parkingLotId", Value: bson.D{{Key: "$in", Value: lotIDs}}},
+			{Key: timeField, Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "lot", Value: "$parkingLotId"},
+				{Key: "hour", Value: bson.D{{Key: "$dateTrunc", Value: bson.D{
+					{Key: "date", Value: "$" + timeField},
+					{Key: "unit", Value: "hour"},
+					{Key: "timezone", Value: tz},
+				}}}},
+			}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[bson.ObjectID]map[time.Time]int)
+	for cursor.Next(ctx) {
+		var row struct {
+			ID struct {
+				Lot  bson.ObjectID `bson:"lot"`
+				Hour time.Time     `bson:"hour"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		if counts[row.ID.Lot] == nil {
+			counts[row.ID.Lot] = make(map[time.Time]int)
+		}
+		counts[row.ID.Lot][row.ID.Hour.UTC()] = row.Count
+	}
+	return counts, cursor.Err()
+}
@@ -2,16 +2,103 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-func GetLastTamperLog() (*TamperLog, error) {
+// ErrTamperLogConflict is returned when another writer already appended at
+// the same position in the chain
+var ErrTamperLogConflict = errors.New("tamper log: chain position already taken")
+
+// Chain order: sequence number, falling back to insertion order for records
+// written before sequence numbers existed (they have no seq and sort first)
+var tamperChainOrder = bson.D{{Key: "seq", Value: 1}, {Key: "_id", Value: 1}}
+
+// chainHeadOrder puts each chain's tip first
+var chainHeadOrder = bson.D{{Key: "chainId", Value: 1}, {Key: "seq", Value: -1}, {Key: "_id", Value: -1}}
+
+// ensureTamperIndexes makes every chain linear: no two records in a chain can
+// share a sequence number or link to the same predecessor. Older records
+// without a seq are left out so existing duplicates don't block index creation.
+func ensureTamperIndexes() error {
+	// Superseded by the per-chain indexes below
+	if err := dropIndexesIfExist(tamperCollection, "seq_unique", "prevHash_unique"); err != nil {
+		return err
+	}
+
+	sequenced := bson.D{{Key: "seq", Value: bson.D{{Key: "$exists", Value: true}}}}
+	_, err := tamperCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "chainId", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetName("chain_seq_unique").SetUnique(true).SetPartialFilterExpression(sequenced),
+		},
+		{
+			Keys:    bson.D{{Key: "chainId", Value: 1}, {Key: "prevHash", Value: 1}},
+			Options: options.Index().SetName("chain_prevHash_unique").SetUnique(true).SetPartialFilterExpression(sequenced),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Not partial, so chain tips (GetLastTamperLog, GetTamperChainHeads)
+	// are found from the index whether or not a chain's records have a seq
+	_, err = tamperCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    chainHeadOrder,
+		Options: options.Index().SetName("chain_head"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tamperCheckpointCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "seq", Value: 1}},
+			Options: options.Index().SetName("seq_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetName("createdAt_seq"),
+		},
+	})
+	return err
+}
+
+func dropIndexesIfExist(coll *mongo.Collection, names ...string) error {
+	specs, err := coll.Indexes().ListSpecifications(context.TODO())
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		for _, name := range names {
+			if spec.Name == name {
+				if err := coll.Indexes().DropOne(context.TODO(), name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// chainFilter selects the records of one chain. The legacy global chain
+// (LegacyChainID) is made of records written before chains were split per
+// parking lot, which have no chainId at all.
+func chainFilter(chainID string) bson.D {
+	if chainID == LegacyChainID {
+		return bson.D{{Key: "chainId", Value: bson.D{{Key: "$exists", Value: false}}}}
+	}
+	return bson.D{{Key: "chainId", Value: chainID}}
+}
+
+func GetLastTamperLog(chainID string) (*TamperLog, error) {
 	var lastLog TamperLog
-	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
-	err := tamperCollection.FindOne(context.TODO(), bson.D{}, opts).Decode(&lastLog)
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}, {Key: "_id", Value: -1}})
+	err := tamperCollection.FindOne(context.TODO(), chainFilter(chainID), opts).Decode(&lastLog)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, nil // No logs yet, this is fine
@@ -23,19 +110,301 @@ func GetLastTamperLog() (*TamperLog, error) {
 
 func InsertTamperLog(logData TamperLog) error {
 	_, err := tamperCollection.InsertOne(context.TODO(), logData)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrTamperLogConflict
+	}
 	return err
 }
 
-func GetAllTamperLogs() ([]TamperLog, error) {
-	var logs []TamperLog
-	cursor, err := tamperCollection.Find(context.TODO(), bson.D{})
+// TamperLogFilter selects records for listing. Empty fields don't filter.
+type TamperLogFilter struct {
+	ParkingLotID string
+	VehicleNo    string
+	Action       string
+	From         time.Time     // createdAt >= From
+	To           time.Time     // createdAt < To
+	After        bson.ObjectID // cursor: only records past this one in list order
+	Descending   bool          // newest first
+	Limit        int64         // 0 = no limit
+}
+
+func (f TamperLogFilter) query() bson.D {
+	filter := bson.D{}
+	if f.ParkingLotID != "" {
+		filter = append(filter, bson.E{Key: "parkingLotId", Value: f.ParkingLotID})
+	}
+	if f.VehicleNo != "" {
+		filter = append(filter, bson.E{Key: "vehicleNo", Value: f.VehicleNo})
+	}
+	if f.Action != "" {
+		filter = append(filter, bson.E{Key: "action", Value: f.Action})
+	}
+
+	createdAt := bson.D{}
+	if !f.From.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$gte", Value: f.From})
+	}
+	if !f.To.IsZero() {
+		createdAt = append(createdAt, bson.E{Key: "$lt", Value: f.To})
+	}
+	if len(createdAt) > 0 {
+		filter = append(filter, bson.E{Key: "createdAt", Value: createdAt})
+	}
+
+	if !f.After.IsZero() {
+		op := "$gt"
+		if f.Descending {
+			op = "$lt"
+		}
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: op, Value: f.After}}})
+	}
+	return filter
+}
+
+func (f TamperLogFilter) options() *options.FindOptionsBuilder {
+	order := 1
+	if f.Descending {
+		order = -1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: order}})
+	if f.Limit > 0 {
+		opts.SetLimit(f.Limit)
+	}
+	return opts
+}
+
+// ensureTamperQueryIndexes backs the filters in TamperLogFilter, all of which
+// page through results by _id, and GetLastVehicleTamperLogs
+func ensureTamperQueryIndexes() error {
+	_, err := tamperCollection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "parkingLotId", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("parkingLotId_id")},
+		{Keys: bson.D{{Key: "vehicleNo", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("vehicleNo_id")},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("action_id")},
+		{Keys: bson.D{{Key: "createdAt", Value: 1}}, Options: options.Index().SetName("createdAt")},
+		{Keys: bson.D{{Key: "parkingLotId", Value: 1}, {Key: "vehicleNo", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("parkingLotId_vehicleNo_createdAt")},
+	})
+	return err
+}
+
+// FindTamperLogs returns one page of records matching f
+func FindTamperLogs(f TamperLogFilter) ([]TamperLog, error) {
+	cursor, err := tamperCollection.Find(context.TODO(), f.query(), f.options())
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(context.TODO())
 
+	logs := []TamperLog{}
 	if err = cursor.All(context.TODO(), &logs); err != nil {
 		return nil, err
 	}
 	return logs, nil
 }
+
+// GetLastVehicleTamperLogs returns, for each of the vehicles, its last record
+// at one parking lot created before t. Vehicles with none are left out.
+func GetLastVehicleTamperLogs(lotID string, vehicles []string, t time.Time) ([]TamperLog, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "parkingLotId", Value: lotID},
+			{Key: "vehicleNo", Value: bson.D{{Key: "$in", Value: vehicles}}},
+			{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: t}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "vehicleNo", Value: 1}, {Key: "createdAt", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$vehicleNo"},
+			{Key: "log", Value: bson.D{{Key: "$first", Value: "$$ROOT"}}},
+		}}},
+		{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$log"}}}},
+	}
+
+	cursor, err := tamperCollection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var logs []TamperLog
+	if err := cursor.All(context.TODO(), &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// EachTamperLogMatching streams every record matching f
+func EachTamperLogMatching(f TamperLogFilter, fn func(TamperLog) error) error {
+	cursor, err := tamperCollection.Find(context.TODO(), f.query(), f.options())
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var l TamperLog
+		if err := cursor.Decode(&l); err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// EachTamperLog walks one chain in order without loading it all
+func EachTamperLog(chainID string, fn func(TamperLog) error) error {
+	opts := options.Find().SetSort(tamperChainOrder)
+	cursor, err := tamperCollection.Find(context.TODO(), chainFilter(chainID), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	for cursor.Next(context.TODO()) {
+		var l TamperLog
+		if err := cursor.Decode(&l); err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// GetTamperChainIDs returns the IDs of all per-lot chains
+func GetTamperChainIDs() ([]string, error) {
+	var ids []string
+	err := tamperCollection.Distinct(context.TODO(), "chainId", bson.D{}).Decode(&ids)
+	return ids, err
+}
+
+// GetTamperChainHeads returns the latest record of every chain, including
+// the legacy global chain. The sort matches the chain_head index, so the
+// group reads one entry per chain from it instead of sorting the collection.
+func GetTamperChainHeads() ([]ChainHead, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: chainHeadOrder}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$chainId"},
+			{Key: "seq", Value: bson.D{{Key: "$first", Value: "$seq"}}},
+			{Key: "hash", Value: bson.D{{Key: "$first", Value: "$hash"}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "chainId", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$_id", LegacyChainID}}}},
+			{Key: "seq", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$seq", 0}}}},
+			{Key: "hash", Value: 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "chainId", Value: 1}}}},
+	}
+
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := tamperCollection.Aggregate(context.TODO(), pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var heads []ChainHead
+	if err := cursor.All(context.TODO(), &heads); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
+
+// GetTamperLogsInRange returns a chain's records created in [from, to), in
+// chain order, stopping after limit
+func GetTamperLogsInRange(chainID string, from, to time.Time, limit int64) ([]TamperLog, error) {
+	filter := append(chainFilter(chainID), bson.E{Key: "createdAt", Value: bson.D{
+		{Key: "$gte", Value: from},
+		{Key: "$lt", Value: to},
+	}})
+	opts := options.Find().SetSort(tamperChainOrder).SetLimit(limit)
+
+	cursor, err := tamperCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var logs []TamperLog
+	if err := cursor.All(context.TODO(), &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// GetTamperLogBySeq returns the record at seq in a chain, or nil
+func GetTamperLogBySeq(chainID string, seq int64) (*TamperLog, error) {
+	var l TamperLog
+	filter := append(chainFilter(chainID), bson.E{Key: "seq", Value: seq})
+	err := tamperCollection.FindOne(context.TODO(), filter).Decode(&l)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetLastTamperLogBefore returns a chain's last record created before t, or
+// nil
+func GetLastTamperLogBefore(chainID string, t time.Time) (*TamperLog, error) {
+	var l TamperLog
+	filter := append(chainFilter(chainID), bson.E{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: t}}})
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}, {Key: "_id", Value: -1}})
+	err := tamperCollection.FindOne(context.TODO(), filter, opts).Decode(&l)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetTamperLogsAfterSeq returns a chain's records with seq in (after,
+// through], in chain order, stopping after limit
+func GetTamperLogsAfterSeq(chainID string, after, through int64, limit int64) ([]TamperLog, error) {
+	filter := append(chainFilter(chainID), bson.E{Key: "seq", Value: bson.D{
+		{Key: "$gt", Value: after},
+		{Key: "$lte", Value: through},
+	}})
+	opts := options.Find().SetSort(tamperChainOrder).SetLimit(limit)
+
+	cursor, err := tamperCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	logs := []TamperLog{}
+	if err := cursor.All(context.TODO(), &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// GetLegacyTamperLogsForLot returns one lot's records in the legacy global
+// chain created in [from, to), in chain order, stopping after limit
+func GetLegacyTamperLogsForLot(lotID string, from, to time.Time, limit int64) ([]TamperLog, error) {
+	filter := append(chainFilter(LegacyChainID),
+		bson.E{Key: "parkingLotId", Value: lotID},
+		bson.E{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	)
+	opts := options.Find().SetSort(tamperChainOrder).SetLimit(limit)
+
+	cursor, err := tamperCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	logs := []TamperLog{}
+	if err := cursor.All(context.TODO(), &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
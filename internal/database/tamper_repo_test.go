@@ -0,0 +1,60 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestTamperLogFilterQuery(t *testing.T) {
+	from := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	after := bson.NewObjectIDFromTimestamp(from)
+
+	tests := []struct {
+		name string
+		f    TamperLogFilter
+		want bson.D
+	}{
+		{"everything", TamperLogFilter{}, bson.D{}},
+		{
+			"fields",
+			TamperLogFilter{ParkingLotID: "lot", VehicleNo: "KA01AB1234", Action: "EXIT"},
+			bson.D{{Key: "parkingLotId", Value: "lot"}, {Key: "vehicleNo", Value: "KA01AB1234"}, {Key: "action", Value: "EXIT"}},
+		},
+		{
+			"range",
+			TamperLogFilter{From: from, To: to},
+			bson.D{{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}},
+		},
+		{
+			"open-ended range",
+			TamperLogFilter{To: to},
+			bson.D{{Key: "createdAt", Value: bson.D{{Key: "$lt", Value: to}}}},
+		},
+		{
+			"cursor, oldest first",
+			TamperLogFilter{After: after},
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}}},
+		},
+		{
+			"cursor, newest first",
+			TamperLogFilter{After: after, Descending: true},
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$lt", Value: after}}}},
+		},
+		{
+			"newest first without cursor",
+			TamperLogFilter{Descending: true},
+			bson.D{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.query(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("query() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrEquivocation is returned when an origin sends a different hash for a
+// checkpoint we already witnessed: its history was rewritten
+var ErrEquivocation = errors.New("witness: origin sent a different hash for an already witnessed checkpoint")
+
+func ensureWitnessIndexes() error {
+	_, err := witnessedHeadCollection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "origin", Value: 1}, {Key: "checkpointSeq", Value: 1}},
+		Options: options.Index().SetName("origin_seq_unique").SetUnique(true),
+	})
+	return err
+}
+
+// AddCheckpointWitness records a witness receipt next to a checkpoint
+func AddCheckpointWitness(checkpointID bson.ObjectID, receipt WitnessReceipt) error {
+	_, err := tamperCheckpointCollection.UpdateOne(
+		context.TODO(),
+		bson.D{{Key: "_id", Value: checkpointID}},
+		bson.D{{Key: "$push", Value: bson.D{{Key: "witnesses", Value: receipt}}}},
+	)
+	return err
+}
+
+// SaveWitnessedHead stores a head sent by another instance. Re-sending the
+// same head is fine and returns the stored copy; a different hash for the
+// same checkpoint is ErrEquivocation.
+func SaveWitnessedHead(head WitnessedHead) (WitnessedHead, error) {
+	_, err := witnessedHeadCollection.InsertOne(context.TODO(), head)
+	if err == nil || !mongo.IsDuplicateKeyError(err) {
+		return head, err
+	}
+
+	var existing WitnessedHead
+	filter := bson.D{{Key: "origin", Value: head.Origin}, {Key: "checkpointSeq", Value: head.CheckpointSeq}}
+	if err := witnessedHeadCollection.FindOne(context.TODO(), filter).Decode(&existing); err != nil {
+		return head, err
+	}
+	if existing.Hash != head.Hash {
+		return existing, ErrEquivocation
+	}
+	return existing, nil
+}
+
+// GetWitnessedHeads returns the latest heads witnessed for an origin, newest first
+func GetWitnessedHeads(origin string, limit int64) ([]WitnessedHead, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "checkpointSeq", Value: -1}}).SetLimit(limit)
+	cursor, err := witnessedHeadCollection.Find(context.TODO(), bson.D{{Key: "origin", Value: origin}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	heads := []WitnessedHead{}
+	if err := cursor.All(context.TODO(), &heads); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
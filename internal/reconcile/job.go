@@ -0,0 +1,148 @@
+package reconcile
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	reconcileInterval = 6 * time.Hour
+
+	// Leave recent events alone so an exit logged a few minutes after its
+	// session closed isn't reported as missing
+	settleDelay = 1 * time.Hour
+
+	// Only one replica reconciles a window. The lease outlives any run, and
+	// if its holder dies it expires before the next tick.
+	reconcileLockName = "reconciliation"
+	reconcileLockTTL  = reconcileInterval / 2
+)
+
+// StartReconciliationScheduler reconciles all lots every few hours, each run
+// picking up where the last saved report ended. One replica at a time runs
+// it; the others skip the tick.
+func StartReconciliationScheduler() {
+	ticker := time.NewTicker(reconcileInterval)
+	go func() {
+		for range ticker.C {
+			runScheduled()
+		}
+	}()
+}
+
+func runScheduled() {
+	ctx := context.Background()
+	ok, err := database.AcquireLock(ctx, reconcileLockName, database.InstanceID, reconcileLockTTL)
+	if err != nil {
+		log.Println("Error taking reconciliation lock:", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer func() {
+		if err := database.ReleaseLock(ctx, reconcileLockName, database.InstanceID); err != nil {
+			log.Println("Error releasing reconciliation lock:", err)
+		}
+	}()
+
+	to := time.Now().Add(-settleDelay)
+	from := to.Add(-reconcileInterval)
+	last, err := database.GetLastReconciliationReport()
+	if err != nil {
+		log.Println("Error getting last reconciliation report:", err)
+		return
+	}
+	if last != nil && last.To.After(from) {
+		from = last.To
+	}
+	if !from.Before(to) {
+		return
+	}
+
+	r, err := Run("", from, to)
+	if err != nil {
+		log.Println("Error reconciling tamper log:", err)
+		return
+	}
+	if err := database.SaveReconciliationReport(r); err != nil {
+		log.Println("Error saving reconciliation report:", err)
+		return
+	}
+	log.Printf("Reconciliation %s - %s: %d discrepancies", from.Format(time.RFC3339), to.Format(time.RFC3339), len(r.Discrepancies))
+}
+
+// Run holds a window's logs, sessions and tickets in memory, so keep
+// on-demand windows to a size that comfortably fits
+const MaxRange = 7 * 24 * time.Hour
+
+var ErrRangeTooLong = fmt.Errorf("reconciliation: range longer than %d days, narrow the dates", int(MaxRange.Hours()/24))
+
+// Run reconciles one parking lot (or all, if parkingLotID is "") over
+// [from, to)
+func Run(parkingLotID string, from, to time.Time) (database.ReconciliationReport, error) {
+	if to.Sub(from) > MaxRange {
+		return database.ReconciliationReport{}, ErrRangeTooLong
+	}
+
+	// Read a bit either side of the window so events near its edges still
+	// find their partners
+	readFrom := from.Add(-matchTolerance)
+	readTo := to.Add(matchTolerance)
+
+	in := Input{From: from, To: to}
+	err := database.EachTamperLogMatching(database.TamperLogFilter{
+		ParkingLotID: parkingLotID,
+		From:         readFrom,
+		To:           readTo,
+	}, func(l database.TamperLog) error {
+		in.Logs = append(in.Logs, l)
+		return nil
+	})
+	if err != nil {
+		return database.ReconciliationReport{}, err
+	}
+
+	if in.Before, err = lastLogsBefore(in.Logs, readFrom); err != nil {
+		return database.ReconciliationReport{}, err
+	}
+	if in.Sessions, err = database.GetSessionsBetween(parkingLotID, readFrom, readTo); err != nil {
+		return database.ReconciliationReport{}, err
+	}
+	if in.Tickets, err = database.GetUsedTicketsBetween(parkingLotID, readFrom, readTo); err != nil {
+		return database.ReconciliationReport{}, err
+	}
+
+	r := Reconcile(in)
+	r.ParkingLotID = parkingLotID
+	return r, nil
+}
+
+// lastLogsBefore looks up the last log before t of every vehicle in logs at
+// its lot, which says whether it was already inside when logs begin
+func lastLogsBefore(logs []database.TamperLog, t time.Time) ([]database.TamperLog, error) {
+	vehicles := make(map[string]map[string]bool) // lot -> vehicle numbers
+	for _, l := range logs {
+		if vehicles[l.ParkingLotID] == nil {
+			vehicles[l.ParkingLotID] = make(map[string]bool)
+		}
+		vehicles[l.ParkingLotID][l.VehicleNo] = true
+	}
+
+	var before []database.TamperLog
+	for lot, set := range vehicles {
+		numbers := make([]string, 0, len(set))
+		for v := range set {
+			numbers = append(numbers, v)
+		}
+		last, err := database.GetLastVehicleTamperLogs(lot, numbers, t)
+		if err != nil {
+			return nil, err
+		}
+		before = append(before, last...)
+	}
+	return before, nil
+}
@@ -0,0 +1,218 @@
+package reconcile
+
+import (
+	"app/internal/database"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Discrepancy kinds
+const (
+	OrphanExit          = "ORPHAN_EXIT"  // EXIT log with no open ENTRY log for the vehicle
+	DoubleEntry         = "DOUBLE_ENTRY" // ENTRY log while the vehicle is already in
+	SessionWithoutEntry = "SESSION_WITHOUT_ENTRY_LOG"
+	SessionWithoutExit  = "SESSION_WITHOUT_EXIT_LOG"
+	EntryWithoutSession = "ENTRY_LOG_WITHOUT_SESSION"
+	ExitWithoutSession  = "EXIT_LOG_WITHOUT_SESSION"
+	TicketWithoutEntry  = "TICKET_WITHOUT_SESSION" // pre-booked ticket redeemed with no session starting
+)
+
+// How far apart a log and the session/ticket it belongs to may be. The web
+// app posts the tamper log right after writing the session.
+const matchTolerance = 15 * time.Minute
+
+// Input is everything one reconciliation needs. Logs, sessions and tickets
+// may extend beyond [From, To); only discrepancies inside it are reported.
+// Before holds each vehicle's last log ahead of Logs, however long ago, so a
+// vehicle that entered before the window and leaves inside it isn't an
+// orphan exit.
+type Input struct {
+	From, To time.Time
+	Logs     []database.TamperLog
+	Before   []database.TamperLog
+	Sessions []database.ParkingSession
+	Tickets  []database.Ticket
+}
+
+// event is a point in time for one vehicle at one lot, from any source
+type event struct {
+	at      time.Time
+	id      string
+	matched bool
+}
+
+type vehicleKey struct {
+	lot     string
+	vehicle string
+}
+
+type vehicleEvents struct {
+	inside        bool // when the first log starts, going by Input.Before
+	logs          []database.TamperLog
+	entryLogs     []*event
+	exitLogs      []*event
+	sessionStarts []*event
+	sessionEnds   []*event
+	tickets       []*event
+}
+
+// Reconcile pairs tamper log ENTRY/EXIT records per vehicle and lot and
+// compares them with parking sessions and redeemed tickets
+func Reconcile(in Input) database.ReconciliationReport {
+	r := database.ReconciliationReport{
+		From:            in.From,
+		To:              in.To,
+		LogsChecked:     len(in.Logs),
+		SessionsChecked: len(in.Sessions),
+		TicketsChecked:  len(in.Tickets),
+		Counts:          make(map[string]int),
+		Discrepancies:   []database.Discrepancy{},
+		GeneratedAt:     time.Now(),
+	}
+
+	byVehicle := make(map[vehicleKey]*vehicleEvents)
+	get := func(lot, vehicle string) *vehicleEvents {
+		k := vehicleKey{lot: lot, vehicle: normalizeVehicle(vehicle)}
+		ev, ok := byVehicle[k]
+		if !ok {
+			ev = &vehicleEvents{}
+			byVehicle[k] = ev
+		}
+		return ev
+	}
+
+	for _, l := range in.Before {
+		get(l.ParkingLotID, l.VehicleNo).inside = l.Action == "ENTRY"
+	}
+	for _, l := range in.Logs {
+		ev := get(l.ParkingLotID, l.VehicleNo)
+		ev.logs = append(ev.logs, l)
+		e := &event{at: l.CreatedAt, id: l.ID.Hex()}
+		switch l.Action {
+		case "ENTRY":
+			ev.entryLogs = append(ev.entryLogs, e)
+		case "EXIT":
+			ev.exitLogs = append(ev.exitLogs, e)
+		}
+	}
+	for _, s := range in.Sessions {
+		ev := get(s.ParkingLotID.Hex(), s.VehicleNumber)
+		ev.sessionStarts = append(ev.sessionStarts, &event{at: s.EntryTime, id: s.ID.Hex()})
+		if s.ExitTime != nil {
+			ev.sessionEnds = append(ev.sessionEnds, &event{at: *s.ExitTime, id: s.ID.Hex()})
+		}
+	}
+	for _, t := range in.Tickets {
+		ev := get(t.ParkingLotID.Hex(), t.VehicleNumber)
+		ev.tickets = append(ev.tickets, &event{at: t.UsedAt, id: t.ID.Hex()})
+	}
+
+	inWindow := func(t time.Time) bool {
+		return !t.Before(in.From) && t.Before(in.To)
+	}
+	report := func(kind string, k vehicleKey, at time.Time, d database.Discrepancy) {
+		if !inWindow(at) {
+			return
+		}
+		d.Kind, d.ParkingLotID, d.VehicleNo, d.At = kind, k.lot, k.vehicle, at
+		r.Discrepancies = append(r.Discrepancies, d)
+		r.Counts[kind]++
+	}
+
+	for k, ev := range byVehicle {
+		// The log on its own: every EXIT needs an ENTRY before it, and no
+		// vehicle enters twice without leaving
+		sort.Slice(ev.logs, func(i, j int) bool { return ev.logs[i].CreatedAt.Before(ev.logs[j].CreatedAt) })
+		inside := ev.inside
+		for _, l := range ev.logs {
+			switch l.Action {
+			case "ENTRY":
+				if inside {
+					report(DoubleEntry, k, l.CreatedAt, database.Discrepancy{LogID: l.ID.Hex()})
+				}
+				inside = true
+			case "EXIT":
+				if !inside {
+					report(OrphanExit, k, l.CreatedAt, database.Discrepancy{LogID: l.ID.Hex()})
+				}
+				inside = false
+			}
+		}
+
+		// Log against sessions and tickets
+		match(ev.sessionStarts, ev.entryLogs, true)
+		match(ev.sessionEnds, ev.exitLogs, true)
+		match(ev.tickets, ev.sessionStarts, false)
+
+		for _, e := range ev.sessionStarts {
+			if !e.matched {
+				report(SessionWithoutEntry, k, e.at, database.Discrepancy{SessionID: e.id})
+			}
+		}
+		for _, e := range ev.sessionEnds {
+			if !e.matched {
+				report(SessionWithoutExit, k, e.at, database.Discrepancy{SessionID: e.id})
+			}
+		}
+		for _, e := range ev.entryLogs {
+			if !e.matched {
+				report(EntryWithoutSession, k, e.at, database.Discrepancy{LogID: e.id})
+			}
+		}
+		for _, e := range ev.exitLogs {
+			if !e.matched {
+				report(ExitWithoutSession, k, e.at, database.Discrepancy{LogID: e.id})
+			}
+		}
+		for _, e := range ev.tickets {
+			if !e.matched {
+				report(TicketWithoutEntry, k, e.at, database.Discrepancy{TicketID: e.id})
+			}
+		}
+	}
+
+	sort.Slice(r.Discrepancies, func(i, j int) bool { return r.Discrepancies[i].At.Before(r.Discrepancies[j].At) })
+	return r
+}
+
+// match pairs each event in want with the closest unpaired event in have
+// within matchTolerance and marks want as matched. markHave marks the paired
+// have events too; it's off when have's flags belong to another pairing.
+func match(want, have []*event, markHave bool) {
+	used := make(map[*event]bool)
+	for _, w := range want {
+		var best *event
+		for _, h := range have {
+			if used[h] {
+				continue
+			}
+			d := absDuration(h.at.Sub(w.at))
+			if d > matchTolerance {
+				continue
+			}
+			if best == nil || d < absDuration(best.at.Sub(w.at)) {
+				best = h
+			}
+		}
+		if best != nil {
+			used[best] = true
+			w.matched = true
+			if markHave {
+				best.matched = true
+			}
+		}
+	}
+}
+
+func normalizeVehicle(v string) string {
+	v = strings.ToUpper(v)
+	return strings.NewReplacer(" ", "", "-", "").Replace(v)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
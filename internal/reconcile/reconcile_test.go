@@ -0,0 +1,267 @@
+package reconcile
+
+import (
+	"app/internal/database"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMatch(t *testing.T) {
+	base := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	minute := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+
+	tests := []struct {
+		name        string
+		want, have  []time.Time
+		markHave    bool
+		wantMatched []bool // per want event
+		haveMatched []bool // per have event
+	}{
+		{
+			name:        "same moment",
+			want:        []time.Time{minute(0)},
+			have:        []time.Time{minute(0)},
+			markHave:    true,
+			wantMatched: []bool{true},
+			haveMatched: []bool{true},
+		},
+		{
+			name:        "at the tolerance",
+			want:        []time.Time{minute(0)},
+			have:        []time.Time{minute(15)},
+			markHave:    true,
+			wantMatched: []bool{true},
+			haveMatched: []bool{true},
+		},
+		{
+			name:        "past the tolerance",
+			want:        []time.Time{minute(0)},
+			have:        []time.Time{minute(16)},
+			markHave:    true,
+			wantMatched: []bool{false},
+			haveMatched: []bool{false},
+		},
+		{
+			name:        "either side",
+			want:        []time.Time{minute(20)},
+			have:        []time.Time{minute(10)},
+			markHave:    true,
+			wantMatched: []bool{true},
+			haveMatched: []bool{true},
+		},
+		{
+			name:        "closest wins",
+			want:        []time.Time{minute(0)},
+			have:        []time.Time{minute(-10), minute(3), minute(12)},
+			markHave:    true,
+			wantMatched: []bool{true},
+			haveMatched: []bool{false, true, false},
+		},
+		{
+			name:        "each have pairs once",
+			want:        []time.Time{minute(0), minute(1)},
+			have:        []time.Time{minute(0)},
+			markHave:    true,
+			wantMatched: []bool{true, false},
+			haveMatched: []bool{true},
+		},
+		{
+			name:        "second want takes the next closest",
+			want:        []time.Time{minute(0), minute(1)},
+			have:        []time.Time{minute(0), minute(10)},
+			markHave:    true,
+			wantMatched: []bool{true, true},
+			haveMatched: []bool{true, true},
+		},
+		{
+			// Tickets pair with session starts already paired with logs
+			name:        "have left unmarked",
+			want:        []time.Time{minute(0)},
+			have:        []time.Time{minute(2)},
+			markHave:    false,
+			wantMatched: []bool{true},
+			haveMatched: []bool{false},
+		},
+		{
+			name:        "nothing to match",
+			want:        []time.Time{minute(0)},
+			markHave:    true,
+			wantMatched: []bool{false},
+			haveMatched: []bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, have := events(tt.want), events(tt.have)
+			match(want, have, tt.markHave)
+			for i, e := range want {
+				if e.matched != tt.wantMatched[i] {
+					t.Errorf("want[%d].matched = %v, expected %v", i, e.matched, tt.wantMatched[i])
+				}
+			}
+			for i, e := range have {
+				if e.matched != tt.haveMatched[i] {
+					t.Errorf("have[%d].matched = %v, expected %v", i, e.matched, tt.haveMatched[i])
+				}
+			}
+		})
+	}
+}
+
+func events(times []time.Time) []*event {
+	evs := make([]*event, len(times))
+	for i, at := range times {
+		evs[i] = &event{at: at}
+	}
+	return evs
+}
+
+func TestReconcile(t *testing.T) {
+	from := time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)
+	lot := bson.NewObjectID()
+	const car = "KA01AB1234"
+	minute := func(m int) time.Time { return from.Add(time.Duration(m) * time.Minute) }
+	logAt := func(action string, m int) database.TamperLog {
+		return database.TamperLog{ID: bson.NewObjectID(), ParkingLotID: lot.Hex(), VehicleNo: car, Action: action, CreatedAt: minute(m)}
+	}
+	session := func(entry int, exit ...int) database.ParkingSession {
+		s := database.ParkingSession{ID: bson.NewObjectID(), ParkingLotID: lot, VehicleNumber: car, EntryTime: minute(entry)}
+		if len(exit) > 0 {
+			at := minute(exit[0])
+			s.ExitTime = &at
+		}
+		return s
+	}
+	ticket := func(m int) database.Ticket {
+		return database.Ticket{ID: bson.NewObjectID(), ParkingLotID: lot, VehicleNumber: car, Status: "USED", UsedAt: minute(m)}
+	}
+	threeDays := -3 * 24 * 60
+
+	tests := []struct {
+		name     string
+		logs     []database.TamperLog
+		before   []database.TamperLog
+		sessions []database.ParkingSession
+		tickets  []database.Ticket
+		want     []string // kinds, in time order
+	}{
+		{
+			name:     "clean visit",
+			logs:     []database.TamperLog{logAt("ENTRY", 0), logAt("EXIT", 60)},
+			sessions: []database.ParkingSession{session(0, 60)},
+		},
+		{
+			name:     "exit with no entry on record",
+			logs:     []database.TamperLog{logAt("EXIT", 30)},
+			sessions: []database.ParkingSession{session(threeDays, 30)},
+			want:     []string{OrphanExit},
+		},
+		{
+			name:     "exit after a stay longer than a day",
+			logs:     []database.TamperLog{logAt("EXIT", 30)},
+			before:   []database.TamperLog{logAt("ENTRY", threeDays)},
+			sessions: []database.ParkingSession{session(threeDays, 30)},
+		},
+		{
+			name:     "exit after the last visit already ended",
+			logs:     []database.TamperLog{logAt("EXIT", 30)},
+			before:   []database.TamperLog{logAt("EXIT", threeDays)},
+			sessions: []database.ParkingSession{session(threeDays, 30)},
+			want:     []string{OrphanExit},
+		},
+		{
+			name:     "entered twice",
+			logs:     []database.TamperLog{logAt("ENTRY", 0), logAt("ENTRY", 30)},
+			sessions: []database.ParkingSession{session(0), session(30)},
+			want:     []string{DoubleEntry},
+		},
+		{
+			name:     "entered again without leaving days ago",
+			logs:     []database.TamperLog{logAt("ENTRY", 30)},
+			before:   []database.TamperLog{logAt("ENTRY", threeDays)},
+			sessions: []database.ParkingSession{session(30)},
+			want:     []string{DoubleEntry},
+		},
+		{
+			name:     "session with no entry log",
+			sessions: []database.ParkingSession{session(10)},
+			want:     []string{SessionWithoutEntry},
+		},
+		{
+			name:     "session closed with no exit log",
+			logs:     []database.TamperLog{logAt("ENTRY", 0)},
+			sessions: []database.ParkingSession{session(0, 60)},
+			want:     []string{SessionWithoutExit},
+		},
+		{
+			name: "entry log with no session",
+			logs: []database.TamperLog{logAt("ENTRY", 0)},
+			want: []string{EntryWithoutSession},
+		},
+		{
+			name:   "exit log with no session closing",
+			logs:   []database.TamperLog{logAt("EXIT", 30)},
+			before: []database.TamperLog{logAt("ENTRY", threeDays)},
+			want:   []string{ExitWithoutSession},
+		},
+		{
+			name:    "ticket redeemed with no session",
+			tickets: []database.Ticket{ticket(20)},
+			want:    []string{TicketWithoutEntry},
+		},
+		{
+			name:     "ticket redeemed on entry",
+			logs:     []database.TamperLog{logAt("ENTRY", 0)},
+			sessions: []database.ParkingSession{session(0)},
+			tickets:  []database.Ticket{ticket(2)},
+		},
+		{
+			name:     "log and session too far apart",
+			logs:     []database.TamperLog{logAt("ENTRY", 0)},
+			sessions: []database.ParkingSession{session(20)},
+			want:     []string{EntryWithoutSession, SessionWithoutEntry},
+		},
+		{
+			name: "outside the window",
+			logs: []database.TamperLog{logAt("ENTRY", -30), logAt("ENTRY", 6*60)},
+		},
+		{
+			name: "vehicle numbers written differently",
+			logs: []database.TamperLog{func() database.TamperLog {
+				l := logAt("ENTRY", 0)
+				l.VehicleNo = "ka 01-ab 1234"
+				return l
+			}()},
+			sessions: []database.ParkingSession{session(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Reconcile(Input{From: from, To: minute(6 * 60), Logs: tt.logs, Before: tt.before, Sessions: tt.sessions, Tickets: tt.tickets})
+			var got []string
+			for _, d := range r.Discrepancies {
+				got = append(got, d.Kind)
+				if r.Counts[d.Kind] == 0 {
+					t.Errorf("%s reported but not counted", d.Kind)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("discrepancies %v, want %v", got, tt.want)
+			}
+			if r.LogsChecked != len(tt.logs) {
+				t.Errorf("%d logs checked, want %d (not counting the ones before)", r.LogsChecked, len(tt.logs))
+			}
+		})
+	}
+}
+
+func TestRunRejectsLongRange(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Run("", from, from.Add(MaxRange+time.Hour)); !errors.Is(err, ErrRangeTooLong) {
+		t.Errorf("err = %v, want %v", err, ErrRangeTooLong)
+	}
+}
@@ -0,0 +1,29 @@
+package risk
+
+import "testing"
+
+func TestBacktestRulesKeepBaselinesInStore(t *testing.T) {
+	store := &memoryBaselines{}
+	checked := 0
+	for _, r := range backtestRules(store) {
+		var b *Baselines
+		switch r := r.(type) {
+		case ReportDensityRule:
+			b = r.Baselines
+		case TrafficMismatchRule:
+			b = r.Baselines
+		case PeakSuppressionRule:
+			b = r.Baselines
+		default:
+			continue
+		}
+		checked++
+		src, ok := b.Store.(backtestSource)
+		if !ok || src.Store != store {
+			t.Errorf("%s keeps baselines in %T, want the backtest's store", r.Name(), b.Store)
+		}
+	}
+	if checked != 3 {
+		t.Errorf("checked %d rules with baselines, want 3", checked)
+	}
+}
@@ -0,0 +1,234 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BacktestSeries is one lot's replayed scores
+type BacktestSeries struct {
+	ParkingLotID string         `json:"parkingLotId"`
+	Name         string         `json:"name"`
+	Area         string         `json:"area"`
+	Points       []Scored       `json:"points"`
+	MaxScore     int            `json:"maxScore"`
+	HighHours    float64        `json:"highHours"`
+	FirstHigh    *time.Time     `json:"firstHigh,omitempty"`
+	Levels       map[string]int `json:"levels"` // points per level
+}
+
+// BacktestResult is a policy replayed over a range
+type BacktestResult struct {
+	PolicyVersion string           `json:"policyVersion"`
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	Step          string           `json:"step"`
+	Lots          []BacktestSeries `json:"lots"`
+}
+
+// backtestWorkers bounds how many lots are replayed at once
+const backtestWorkers = 4
+
+// Backtest replays the analyzer for every lot at each step in [from, to)
+// with the given policies, as if it had run then. Nothing is saved:
+// baselines are kept in memory for the replay. Each lot's momentum starts
+// from its recorded score at from, if there is one. It stops at the first
+// lot that fails, or once ctx ends.
+func Backtest(ctx context.Context, lots []database.ParkingLot, set *PolicySet, from, to time.Time, step time.Duration) (BacktestResult, error) {
+	rules := backtestRules(&memoryBaselines{})
+	res := BacktestResult{
+		PolicyVersion: set.Base.Version,
+		From:          from,
+		To:            to,
+		Step:          step.String(),
+		Lots:          make([]BacktestSeries, len(lots)),
+	}
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	sem := make(chan struct{}, backtestWorkers)
+	for i, lot := range lots {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, lot database.ParkingLot) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			series, err := backtestLot(ctx, lot, set, rules, from, to, step)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			res.Lots[i] = series
+		}(i, lot)
+	}
+	wg.Wait()
+	return res, firstErr
+}
+
+func backtestLot(ctx context.Context, lot database.ParkingLot, set *PolicySet, rules []Rule, from, to time.Time, step time.Duration) (BacktestSeries, error) {
+	series := BacktestSeries{
+		ParkingLotID: lot.ID.Hex(),
+		Name:         lot.Name,
+		Area:         lot.Area,
+		Levels:       map[string]int{},
+	}
+
+	prev := 0
+	seed, err := database.GetRiskHistoryAt(ctx, lot.ID, from)
+	if err != nil {
+		return series, err
+	}
+	if seed != nil {
+		prev = seed.Score
+	}
+
+	for t := from; t.Before(to); t = t.Add(step) {
+		at := t
+		a := Analyzer{
+			Clock:    func() time.Time { return at },
+			Window:   liveAnalyzer.Window,
+			Policies: set.For,
+			Rules:    rules,
+		}
+		s, err := a.Score(ctx, lot, prev)
+		if err != nil {
+			return series, err
+		}
+		prev = s.Score
+
+		series.Points = append(series.Points, s)
+		series.MaxScore = max(series.MaxScore, s.Score)
+		series.Levels[s.Level]++
+		if s.Level == "HIGH" {
+			series.HighHours += step.Hours()
+			if series.FirstHigh == nil {
+				series.FirstHigh = &at
+			}
+		}
+	}
+	return series, nil
+}
+
+// backtestRules is the registered rules with the built-in ones keeping
+// their baselines in store instead of the database
+func backtestRules(store BaselineStore) []Rule {
+	builtin := make(map[string]Rule)
+	for _, r := range builtinRules(backtestSource{Store: store}) {
+		builtin[r.Name()] = r
+	}
+	rules := Rules()
+	for i, r := range rules {
+		if b, ok := builtin[r.Name()]; ok {
+			rules[i] = b
+		}
+	}
+	return rules
+}
+
+// backtestSource reads the database like live runs, but loads and saves
+// baselines in Store
+type backtestSource struct {
+	dbSource
+	Store BaselineStore
+}
+
+func (s backtestSource) LoadBaseline(ctx context.Context, scope, key, metric string, through time.Time) (*database.RiskBaseline, error) {
+	return s.Store.LoadBaseline(ctx, scope, key, metric, through)
+}
+
+func (s backtestSource) SaveBaseline(ctx context.Context, b database.RiskBaseline) error {
+	return s.Store.SaveBaseline(ctx, b)
+}
+
+// memoryBaselines keeps every baseline a backtest computes, so a replay
+// steps through time reusing them the way live runs reuse stored ones,
+// without writing to riskBaselines or seeing later data
+type memoryBaselines struct {
+	mu        sync.Mutex
+	baselines map[string][]database.RiskBaseline
+}
+
+func (m *memoryBaselines) LoadBaseline(_ context.Context, scope, key, metric string, through time.Time) (*database.RiskBaseline, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var best *database.RiskBaseline
+	for _, b := range m.baselines[scope+"/"+key+"/"+metric] {
+		if !b.Through.After(through) && (best == nil || b.Through.After(best.Through)) {
+			best = &b
+		}
+	}
+	return best, nil
+}
+
+func (m *memoryBaselines) SaveBaseline(_ context.Context, b database.RiskBaseline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.baselines == nil {
+		m.baselines = make(map[string][]database.RiskBaseline)
+	}
+	k := b.Scope + "/" + b.Key + "/" + b.Metric
+	m.baselines[k] = append(m.baselines[k], b)
+	return nil
+}
+
+// BacktestDiff is how two policies' replays differ for one lot
+type BacktestDiff struct {
+	ParkingLotID string     `json:"parkingLotId"`
+	Name         string     `json:"name"`
+	StepsDiffer  int        `json:"stepsDiffer"` // steps where the level differs
+	FirstDiffer  *time.Time `json:"firstDiffer,omitempty"`
+	MaxScoreA    int        `json:"maxScoreA"`
+	MaxScoreB    int        `json:"maxScoreB"`
+	HighHoursA   float64    `json:"highHoursA"`
+	HighHoursB   float64    `json:"highHoursB"`
+	FlaggedA     bool       `json:"flaggedA"` // reached HIGH at least once
+	FlaggedB     bool       `json:"flaggedB"`
+}
+
+// DiffBacktests compares two replays of the same lots and range, listing
+// only lots whose levels differ somewhere, most different first
+func DiffBacktests(a, b BacktestResult) []BacktestDiff {
+	byLot := make(map[string]BacktestSeries, len(b.Lots))
+	for _, s := range b.Lots {
+		byLot[s.ParkingLotID] = s
+	}
+
+	diffs := []BacktestDiff{}
+	for _, sa := range a.Lots {
+		sb, ok := byLot[sa.ParkingLotID]
+		if !ok {
+			continue
+		}
+		d := BacktestDiff{
+			ParkingLotID: sa.ParkingLotID,
+			Name:         sa.Name,
+			MaxScoreA:    sa.MaxScore,
+			MaxScoreB:    sb.MaxScore,
+			HighHoursA:   sa.HighHours,
+			HighHoursB:   sb.HighHours,
+			FlaggedA:     sa.FirstHigh != nil,
+			FlaggedB:     sb.FirstHigh != nil,
+		}
+		for i := range sa.Points {
+			if i >= len(sb.Points) {
+				break
+			}
+			if sa.Points[i].Level != sb.Points[i].Level {
+				d.StepsDiffer++
+				if d.FirstDiffer == nil {
+					at := sa.Points[i].At
+					d.FirstDiffer = &at
+				}
+			}
+		}
+		if d.StepsDiffer > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	sort.SliceStable(diffs, func(i, j int) bool { return diffs[i].StepsDiffer > diffs[j].StepsDiffer })
+	return diffs
+}
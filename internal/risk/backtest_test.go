@@ -0,0 +1,155 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"testing"
+	"time"
+)
+
+// series builds a replay of one lot from its levels, an hour apart
+func series(id string, levels ...string) BacktestSeries {
+	start := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	s := BacktestSeries{ParkingLotID: id, Name: "Lot " + id, Levels: map[string]int{}}
+	for i, level := range levels {
+		at := start.Add(time.Duration(i) * time.Hour)
+		score := map[string]int{"LOW": 10, "MEDIUM": 40, "HIGH": 80}[level]
+		s.Points = append(s.Points, Scored{At: at, Score: score, Level: level})
+		s.MaxScore = max(s.MaxScore, score)
+		s.Levels[level]++
+		if level == "HIGH" {
+			s.HighHours++
+			if s.FirstHigh == nil {
+				s.FirstHigh = &at
+			}
+		}
+	}
+	return s
+}
+
+func TestDiffBacktests(t *testing.T) {
+	start := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	hour := func(i int) *time.Time {
+		at := start.Add(time.Duration(i) * time.Hour)
+		return &at
+	}
+
+	tests := []struct {
+		name string
+		a, b []BacktestSeries
+		want []BacktestDiff
+	}{
+		{
+			name: "identical",
+			a:    []BacktestSeries{series("1", "LOW", "HIGH")},
+			b:    []BacktestSeries{series("1", "LOW", "HIGH")},
+			want: []BacktestDiff{},
+		},
+		{
+			name: "one lot differs",
+			a:    []BacktestSeries{series("1", "LOW", "LOW"), series("2", "LOW", "MEDIUM", "HIGH")},
+			b:    []BacktestSeries{series("1", "LOW", "LOW"), series("2", "LOW", "LOW", "MEDIUM")},
+			want: []BacktestDiff{{
+				ParkingLotID: "2", Name: "Lot 2", StepsDiffer: 2, FirstDiffer: hour(1),
+				MaxScoreA: 80, MaxScoreB: 40, HighHoursA: 1, FlaggedA: true,
+			}},
+		},
+		{
+			name: "most different first",
+			a:    []BacktestSeries{series("1", "LOW", "MEDIUM", "LOW"), series("2", "HIGH", "HIGH", "HIGH")},
+			b:    []BacktestSeries{series("1", "LOW", "LOW", "LOW"), series("2", "LOW", "LOW", "LOW")},
+			want: []BacktestDiff{
+				{ParkingLotID: "2", Name: "Lot 2", StepsDiffer: 3, FirstDiffer: hour(0), MaxScoreA: 80, MaxScoreB: 10, HighHoursA: 3, FlaggedA: true},
+				{ParkingLotID: "1", Name: "Lot 1", StepsDiffer: 1, FirstDiffer: hour(1), MaxScoreA: 40, MaxScoreB: 10},
+			},
+		},
+		{
+			name: "lots only in one replay skipped",
+			a:    []BacktestSeries{series("1", "HIGH")},
+			b:    []BacktestSeries{series("2", "LOW")},
+			want: []BacktestDiff{},
+		},
+		{
+			name: "compared up to the shorter replay",
+			a:    []BacktestSeries{series("1", "LOW", "HIGH")},
+			b:    []BacktestSeries{series("1", "LOW")},
+			want: []BacktestDiff{},
+		},
+		{
+			name: "same levels, different scores",
+			a:    []BacktestSeries{series("1", "LOW")},
+			b:    []BacktestSeries{func() BacktestSeries { s := series("1", "LOW"); s.Points[0].Score = 20; return s }()},
+			want: []BacktestDiff{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffBacktests(BacktestResult{Lots: tt.a}, BacktestResult{Lots: tt.b})
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d diffs %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if (g.FirstDiffer == nil) != (w.FirstDiffer == nil) || (g.FirstDiffer != nil && !g.FirstDiffer.Equal(*w.FirstDiffer)) {
+					t.Errorf("diff %d: FirstDiffer = %v, want %v", i, g.FirstDiffer, w.FirstDiffer)
+				}
+				g.FirstDiffer, w.FirstDiffer = nil, nil
+				if g != w {
+					t.Errorf("diff %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryBaselines(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	m := &memoryBaselines{}
+	if b, err := m.LoadBaseline(ctx, database.BaselineScopeLot, "lot", MetricEntries, day); err != nil || b != nil {
+		t.Fatalf("empty store loaded %v, %v", b, err)
+	}
+	for _, b := range []database.RiskBaseline{
+		{Scope: database.BaselineScopeLot, Key: "lot", Metric: MetricEntries, Through: day, Capacity: 1},
+		{Scope: database.BaselineScopeLot, Key: "lot", Metric: MetricEntries, Through: day.AddDate(0, 0, 2), Capacity: 3},
+		{Scope: database.BaselineScopeLot, Key: "lot", Metric: MetricEntries, Through: day.AddDate(0, 0, 1), Capacity: 2},
+		{Scope: database.BaselineScopeLot, Key: "lot", Metric: MetricTickets, Through: day, Capacity: 10},
+		{Scope: database.BaselineScopeArea, Key: "lot", Metric: MetricEntries, Through: day, Capacity: 20},
+	} {
+		if err := m.SaveBaseline(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each load gets the newest baseline computed through no later than
+	// asked, so stepping back in time never sees later data
+	tests := []struct {
+		name          string
+		scope, metric string
+		through       time.Time
+		want          int // Capacity of the baseline; 0 for none
+	}{
+		{"before any", database.BaselineScopeLot, MetricEntries, day.Add(-time.Hour), 0},
+		{"exactly through", database.BaselineScopeLot, MetricEntries, day, 1},
+		{"between", database.BaselineScopeLot, MetricEntries, day.AddDate(0, 0, 1).Add(12 * time.Hour), 2},
+		{"saved out of order", database.BaselineScopeLot, MetricEntries, day.AddDate(0, 0, 5), 3},
+		{"another metric", database.BaselineScopeLot, MetricTickets, day.AddDate(0, 0, 5), 10},
+		{"another scope", database.BaselineScopeArea, MetricEntries, day.AddDate(0, 0, 5), 20},
+		{"nothing for the metric", database.BaselineScopeArea, MetricReports, day.AddDate(0, 0, 5), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := m.LoadBaseline(ctx, tt.scope, "lot", tt.metric, tt.through)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := 0
+			if b != nil {
+				got = b.Capacity
+			}
+			if got != tt.want {
+				t.Errorf("loaded baseline %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const hoursPerWeek = 7 * 24
+
+// Expectation is what history says a metric should be for one hour
+type Expectation struct {
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stdDev"`
+	Samples int     `json:"samples"`
+	Source  string  `json:"source"` // lot, area, or "" when neither has enough history
+}
+
+// Known reports whether there was enough history to expect anything
+func (e Expectation) Known() bool { return e.Source != "" }
+
+// Z is how many standard deviations observed lies from the mean. The
+// deviation is floored at 1 so a lot with a perfectly flat history isn't
+// infinitely surprised by one ticket more or less.
+func (e Expectation) Z(observed float64) float64 {
+	return (observed - e.Mean) / math.Max(e.StdDev, 1)
+}
+
+// Scaled converts an hourly expectation to a window of length d, taking
+// counts to be spread evenly and independent
+func (e Expectation) Scaled(d time.Duration) Expectation {
+	f := d.Hours()
+	e.Mean *= f
+	e.StdDev *= math.Sqrt(f)
+	return e
+}
+
+type BaselineStore interface {
+	// LoadBaseline returns the stored baseline, or nil. A store that keeps
+	// several returns the newest computed through no later than through.
+	LoadBaseline(ctx context.Context, scope, key, metric string, through time.Time) (*database.RiskBaseline, error)
+	SaveBaseline(ctx context.Context, b database.RiskBaseline) error
+}
+
+// Baselines keeps rolling per-hour-of-week statistics of a metric for each
+// lot, and per-slot rates for each area to fall back on while a lot is too
+// new to have its own
+type Baselines struct {
+	Counts CountSource
+	Lots   LotSource
+	Store  BaselineStore // nil recomputes on every call
+}
+
+// HourOfWeek indexes RiskBaseline.Hours
+func HourOfWeek(t time.Time, loc *time.Location) int {
+	local := t.In(loc)
+	return int(local.Weekday())*24 + local.Hour()
+}
+
+func localHour(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+}
+
+// baselineLag keeps the days rules judge out of the history they're judged
+// against. It also means every rule in a run asks for the same baseline, so
+// one stored baseline per lot and metric serves them all.
+const baselineLag = 48 * time.Hour
+
+// Expect returns the expected hourly value of metric for lot at the hour of
+// the week containing at, from the history up to baselineLag before asOf,
+// the moment being scored
+func (b *Baselines) Expect(ctx context.Context, lot database.ParkingLot, metric string, at, asOf time.Time, p *Policy) (Expectation, error) {
+	exps, err := b.ExpectHours(ctx, lot, metric, []time.Time{at}, asOf, p)
+	if err != nil {
+		return Expectation{}, err
+	}
+	return exps[0], nil
+}
+
+// ExpectHours is Expect for several hours at once
+func (b *Baselines) ExpectHours(ctx context.Context, lot database.ParkingLot, metric string, hours []time.Time, asOf time.Time, p *Policy) ([]Expectation, error) {
+	cfg := p.Baselines
+	exps := make([]Expectation, len(hours))
+	if len(hours) == 0 {
+		return exps, nil
+	}
+	through := localHour(asOf.Add(-baselineLag), p.Location())
+
+	lb, err := b.baseline(ctx, database.BaselineScopeLot, lot.ID.Hex(), metric, through, p, func() (database.RiskBaseline, error) {
+		return b.computeLot(ctx, lot, metric, through, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ab *database.RiskBaseline
+	for i, at := range hours {
+		idx := HourOfWeek(at, p.Location())
+		if h := lb.Hours[idx]; h.N >= cfg.MinSamples {
+			exps[i] = Expectation{Mean: h.Mean, StdDev: h.StdDev, Samples: h.N, Source: database.BaselineScopeLot}
+			continue
+		}
+
+		if lot.Area == "" || lot.Capacity <= 0 {
+			continue
+		}
+		if ab == nil {
+			area, err := b.baseline(ctx, database.BaselineScopeArea, lot.Area, metric, through, p, func() (database.RiskBaseline, error) {
+				return b.computeArea(ctx, lot.Area, metric, through, p)
+			})
+			if err != nil {
+				return nil, err
+			}
+			ab = &area
+		}
+		if h := ab.Hours[idx]; h.N >= cfg.MinSamples {
+			c := float64(lot.Capacity)
+			exps[i] = Expectation{Mean: h.RateMean * c, StdDev: h.RateStdDev * c, Samples: h.N, Source: database.BaselineScopeArea}
+		}
+	}
+	return exps, nil
+}
+
+// ExpectWindow totals the expectations of every local hour overlapping
+// [from, to), as of to, taking the hours to be independent. It's unknown
+// unless every hour is known, and from the area's history if any hour is.
+func (b *Baselines) ExpectWindow(ctx context.Context, lot database.ParkingLot, metric string, from, to time.Time, p *Policy) (Expectation, error) {
+	var hours []time.Time
+	for h := localHour(from, p.Location()); h.Before(to); h = h.Add(time.Hour) {
+		hours = append(hours, h)
+	}
+	exps, err := b.ExpectHours(ctx, lot, metric, hours, to, p)
+	if err != nil || len(exps) == 0 {
+		return Expectation{}, err
+	}
+
+	total := Expectation{Samples: exps[0].Samples, Source: database.BaselineScopeLot}
+	variance := 0.0
+	for _, e := range exps {
+		if !e.Known() {
+			return Expectation{}, nil
+		}
+		total.Mean += e.Mean
+		variance += e.StdDev * e.StdDev
+		total.Samples = min(total.Samples, e.Samples)
+		if e.Source == database.BaselineScopeArea {
+			total.Source = database.BaselineScopeArea
+		}
+	}
+	total.StdDev = math.Sqrt(variance)
+	return total, nil
+}
+
+// baseline returns the stored baseline if it's recent enough, otherwise
+// computes and stores a new one
+func (b *Baselines) baseline(ctx context.Context, scope, key, metric string, through time.Time, p *Policy, compute func() (database.RiskBaseline, error)) (database.RiskBaseline, error) {
+	cfg := p.Baselines
+	refresh := time.Duration(cfg.RefreshHours) * time.Hour
+
+	if b.Store != nil {
+		stored, err := b.Store.LoadBaseline(ctx, scope, key, metric, through)
+		if err != nil {
+			return database.RiskBaseline{}, err
+		}
+		// Only use it if it doesn't include data from after through, so
+		// backtests don't see the future
+		if stored != nil && stored.Weeks == cfg.Weeks && len(stored.Hours) == hoursPerWeek &&
+			!stored.Through.After(through) && through.Sub(stored.Through) < refresh {
+			return *stored, nil
+		}
+	}
+
+	nb, err := compute()
+	if err != nil {
+		return database.RiskBaseline{}, err
+	}
+	nb.Scope, nb.Key, nb.Metric = scope, key, metric
+	nb.Weeks = cfg.Weeks
+	nb.Through = through
+	nb.ComputedAt = time.Now()
+
+	if b.Store != nil {
+		if err := b.Store.SaveBaseline(ctx, nb); err != nil {
+			log.Printf("Error saving %s baseline for %s %s: %v", metric, scope, key, err)
+		}
+	}
+	return nb, nil
+}
+
+func (b *Baselines) computeLot(ctx context.Context, lot database.ParkingLot, metric string, through time.Time, p *Policy) (database.RiskBaseline, error) {
+	from := through.AddDate(0, 0, -7*p.Baselines.Weeks)
+	counts, err := b.Counts.HourlyCounts(ctx, metric, []bson.ObjectID{lot.ID}, from, through, p.Location())
+	if err != nil {
+		return database.RiskBaseline{}, err
+	}
+
+	samples := hourSamples(counts[lot.ID], from, through, p.Location())
+	hours := make([]database.HourStat, hoursPerWeek)
+	for i, xs := range samples {
+		mean, sd := meanStdDev(xs)
+		hours[i] = database.HourStat{N: len(xs), Mean: mean, StdDev: sd}
+		if lot.Capacity > 0 {
+			hours[i].RateMean = mean / float64(lot.Capacity)
+			hours[i].RateStdDev = sd / float64(lot.Capacity)
+		}
+	}
+	return database.RiskBaseline{Capacity: lot.Capacity, Hours: hours}, nil
+}
+
+// computeArea pools the per-slot rates of every lot in the area: each lot
+// and week is one sample of an hour
+func (b *Baselines) computeArea(ctx context.Context, area, metric string, through time.Time, p *Policy) (database.RiskBaseline, error) {
+	lots, err := b.Lots.LotsInArea(ctx, area)
+	if err != nil {
+		return database.RiskBaseline{}, err
+	}
+	var ids []bson.ObjectID
+	capacity := 0
+	for _, l := range lots {
+		if l.Capacity > 0 {
+			ids = append(ids, l.ID)
+			capacity += l.Capacity
+		}
+	}
+
+	rates := make([][]float64, hoursPerWeek)
+	from := through.AddDate(0, 0, -7*p.Baselines.Weeks)
+	if len(ids) > 0 {
+		counts, err := b.Counts.HourlyCounts(ctx, metric, ids, from, through, p.Location())
+		if err != nil {
+			return database.RiskBaseline{}, err
+		}
+		for _, l := range lots {
+			if l.Capacity <= 0 {
+				continue
+			}
+			for i, xs := range hourSamples(counts[l.ID], from, through, p.Location()) {
+				for _, x := range xs {
+					rates[i] = append(rates[i], x/float64(l.Capacity))
+				}
+			}
+		}
+	}
+
+	hours := make([]database.HourStat, hoursPerWeek)
+	for i, xs := range rates {
+		mean, sd := meanStdDev(xs)
+		hours[i] = database.HourStat{N: len(xs), RateMean: mean, RateStdDev: sd}
+	}
+	return database.RiskBaseline{Capacity: capacity, Hours: hours}, nil
+}
+
+// hourSamples lays hourly counts out by hour of the week. Sampling starts
+// at the first hour with any data, so the weeks before a lot opened don't
+// count as zeros.
+func hourSamples(byHour map[time.Time]int, from, through time.Time, loc *time.Location) [][]float64 {
+	samples := make([][]float64, hoursPerWeek)
+	start := time.Time{}
+	for h := range byHour {
+		if start.IsZero() || h.Before(start) {
+			start = h
+		}
+	}
+	if start.IsZero() {
+		return samples
+	}
+	if start.Before(from) {
+		start = from
+	}
+	for h := start; h.Before(through); h = h.Add(time.Hour) {
+		i := HourOfWeek(h, loc)
+		samples[i] = append(samples[i], float64(byHour[h.UTC()]))
+	}
+	return samples
+}
+
+// meanStdDev returns the mean and sample standard deviation of xs
+func meanStdDev(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
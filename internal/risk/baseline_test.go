@@ -0,0 +1,211 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMeanStdDev(t *testing.T) {
+	tests := []struct {
+		name     string
+		xs       []float64
+		mean, sd float64
+	}{
+		{"no samples", nil, 0, 0},
+		{"one sample", []float64{5}, 5, 0},
+		{"constant", []float64{3, 3, 3, 3}, 3, 0},
+		{"sample deviation", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, math.Sqrt(32.0 / 7)},
+		{"two", []float64{2, 6}, 4, math.Sqrt(8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, sd := meanStdDev(tt.xs)
+			if math.Abs(mean-tt.mean) > 1e-9 || math.Abs(sd-tt.sd) > 1e-9 {
+				t.Errorf("meanStdDev = (%v, %v), want (%v, %v)", mean, sd, tt.mean, tt.sd)
+			}
+		})
+	}
+}
+
+func TestExpectation(t *testing.T) {
+	tests := []struct {
+		name     string
+		exp      Expectation
+		window   time.Duration
+		observed float64
+		mean, sd float64 // after scaling to window
+		z        float64
+	}{
+		{"an hour", Expectation{Mean: 10, StdDev: 2}, time.Hour, 6, 10, 2, -2},
+		{"half an hour", Expectation{Mean: 10, StdDev: 4}, 30 * time.Minute, 1, 5, 4 / math.Sqrt2, -4 / (4 / math.Sqrt2)},
+		{"four hours", Expectation{Mean: 3, StdDev: 1}, 4 * time.Hour, 16, 12, 2, 2},
+		{"flat history floors the spread at 1", Expectation{Mean: 4}, time.Hour, 7, 4, 0, 3},
+		{"spread below 1 is floored", Expectation{Mean: 4, StdDev: 0.1}, time.Hour, 2, 4, 0.1, -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.exp.Scaled(tt.window)
+			if math.Abs(e.Mean-tt.mean) > 1e-9 || math.Abs(e.StdDev-tt.sd) > 1e-9 {
+				t.Errorf("Scaled = %v ± %v, want %v ± %v", e.Mean, e.StdDev, tt.mean, tt.sd)
+			}
+			if z := e.Z(tt.observed); math.Abs(z-tt.z) > 1e-9 {
+				t.Errorf("Z(%v) = %v, want %v", tt.observed, z, tt.z)
+			}
+		})
+	}
+	if (Expectation{Mean: 3}).Known() || !(Expectation{Source: database.BaselineScopeArea}).Known() {
+		t.Error("Known should follow Source")
+	}
+}
+
+func TestHourSamples(t *testing.T) {
+	ist := time.FixedZone("IST", 330*60)
+	from := time.Date(2026, 2, 2, 0, 0, 0, 0, ist)
+	through := from.AddDate(0, 0, 14)
+	week := 7 * 24 * time.Hour
+
+	// every fills each hour in [start, end) with n
+	every := func(start, end time.Time, n int) map[time.Time]int {
+		m := make(map[time.Time]int)
+		for h := start; h.Before(end); h = h.Add(time.Hour) {
+			m[h.UTC()] = n
+		}
+		return m
+	}
+
+	tests := []struct {
+		name        string
+		byHour      map[time.Time]int
+		wantPerSlot int     // samples in every hour of the week
+		wantTotal   float64 // sum of all samples
+	}{
+		{"no history", nil, 0, 0},
+		{"two full weeks", every(from, through, 3), 2, 2 * hoursPerWeek * 3},
+		{"opened a week in", every(from.Add(week), through, 3), 1, hoursPerWeek * 3},
+		{"quiet hours are zeros", map[time.Time]int{from.Add(week).UTC(): 5}, 1, 5},
+		{"history before from left out", every(from.Add(-week), from.Add(week), 2), 2, hoursPerWeek * 2},
+		{"history after through left out", every(from.Add(week), through.Add(week), 2), 1, hoursPerWeek * 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := hourSamples(tt.byHour, from, through, ist)
+			if len(samples) != hoursPerWeek {
+				t.Fatalf("got %d hours of the week, want %d", len(samples), hoursPerWeek)
+			}
+			total := 0.0
+			for i, xs := range samples {
+				if len(xs) != tt.wantPerSlot {
+					t.Fatalf("hour %d has %d samples, want %d", i, len(xs), tt.wantPerSlot)
+				}
+				for _, x := range xs {
+					total += x
+				}
+			}
+			if total != tt.wantTotal {
+				t.Errorf("samples total %v, want %v", total, tt.wantTotal)
+			}
+		})
+	}
+
+	// Samples land in the local hour of the week
+	at := time.Date(2026, 2, 11, 9, 0, 0, 0, ist) // a Wednesday
+	samples := hourSamples(map[time.Time]int{from.UTC(): 0, at.UTC(): 7}, from, through, ist)
+	if xs := samples[3*24+9]; len(xs) != 2 || xs[1] != 7 {
+		t.Errorf("Wednesday 09:00 samples = %v, want [0 7]", xs)
+	}
+}
+
+func TestBaselinesExpect(t *testing.T) {
+	p := DefaultPolicy()
+	loc := p.Location()
+	asOf := time.Date(2026, 3, 14, 12, 0, 0, 0, loc)
+	through := localHour(asOf.Add(-baselineLag), loc)
+	from := through.AddDate(0, 0, -7*p.Baselines.Weeks)
+
+	old := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 10}
+	fresh := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 20}
+	alone := database.ParkingLot{ID: bson.NewObjectID(), Capacity: 10}
+	tiny := database.ParkingLot{ID: bson.NewObjectID(), Area: "south", Capacity: 10}
+
+	// old alternates 2 and 6 entries an hour week by week, so every hour of
+	// the week has mean 4 and the same spread
+	history := make(map[time.Time]int)
+	for h := from; h.Before(through); h = h.Add(time.Hour) {
+		history[h.UTC()] = 2 + 4*(int(h.Sub(from)/(7*24*time.Hour))%2)
+	}
+	// The days being judged mustn't move the baseline
+	for h := through; h.Before(asOf); h = h.Add(time.Hour) {
+		history[h.UTC()] = 100
+	}
+	// tiny has less history than MinSamples
+	short := make(map[time.Time]int)
+	for h := through.AddDate(0, 0, -7); h.Before(through); h = h.Add(time.Hour) {
+		short[h.UTC()] = 1
+	}
+	counts := &fakeCounts{byLot: map[bson.ObjectID]map[time.Time]int{old.ID: history, tiny.ID: short}}
+	b := &Baselines{
+		Counts: counts,
+		Lots:   fakeLots{old, fresh, alone, tiny},
+		Store:  &memoryBaselines{},
+	}
+	sd := math.Sqrt(4 * float64(p.Baselines.Weeks) / float64(p.Baselines.Weeks-1))
+
+	tests := []struct {
+		name       string
+		lot        database.ParkingLot
+		wantSource string
+		wantMean   float64
+		wantSD     float64
+	}{
+		{"own history", old, database.BaselineScopeLot, 4, sd},
+		// The area's rate per space, scaled to fresh's capacity
+		{"new lot falls back to the area", fresh, database.BaselineScopeArea, 4.0 / 10 * 20, sd / 10 * 20},
+		{"no area", alone, "", 0, 0},
+		{"too little history", tiny, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp, err := b.Expect(context.Background(), tt.lot, MetricEntries, asOf.Add(-time.Hour), asOf, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp.Source != tt.wantSource || exp.Known() != (tt.wantSource != "") {
+				t.Fatalf("source %q, want %q", exp.Source, tt.wantSource)
+			}
+			if math.Abs(exp.Mean-tt.wantMean) > 1e-9 || math.Abs(exp.StdDev-tt.wantSD) > 1e-9 {
+				t.Errorf("expected %v ± %v, want %v ± %v", exp.Mean, exp.StdDev, tt.wantMean, tt.wantSD)
+			}
+		})
+	}
+
+	// A window totals its hours
+	win, err := b.ExpectWindow(context.Background(), old, MetricEntries, asOf.Add(-2*time.Hour), asOf, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if win.Mean != 8 || math.Abs(win.StdDev-sd*math.Sqrt2) > 1e-9 {
+		t.Errorf("two-hour window expected %v ± %v, want 8 ± %v", win.Mean, win.StdDev, sd*math.Sqrt2)
+	}
+
+	// Later in the same run, and within RefreshHours, the stored baseline
+	// is reused; past it, it's recomputed
+	calls := counts.calls
+	if _, err := b.Expect(context.Background(), old, MetricEntries, asOf, asOf.Add(time.Hour), p); err != nil {
+		t.Fatal(err)
+	}
+	if counts.calls != calls {
+		t.Errorf("stored baseline recomputed %d times", counts.calls-calls)
+	}
+	later := asOf.Add(time.Duration(p.Baselines.RefreshHours) * time.Hour)
+	if _, err := b.Expect(context.Background(), old, MetricEntries, later, later, p); err != nil {
+		t.Fatal(err)
+	}
+	if counts.calls == calls {
+		t.Error("stale baseline reused")
+	}
+}
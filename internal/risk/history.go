@@ -0,0 +1,200 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var levelRank = map[string]int{"LOW": 0, "MEDIUM": 1, "HIGH": 2}
+
+// compactLockName is the lock a replica takes to compact history, so two
+// don't fold the same day at once
+const compactLockName = "risk-history-compaction"
+
+// compactLockTTL outlasts any compaction; a crashed holder's lease runs out
+// well before the next day's
+const compactLockTTL = 1 * time.Hour
+
+// StartHistoryCompactor folds old per-run history into daily entries and
+// drops entries past retention, once a day, on one replica at a time,
+// until ctx is done
+func StartHistoryCompactor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		compactHistory(ctx, time.Now())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				compactHistory(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+func compactHistory(ctx context.Context, now time.Time) {
+	ok, err := database.AcquireLock(ctx, compactLockName, database.InstanceID, compactLockTTL)
+	if err != nil {
+		log.Println("Error taking risk history lock:", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer func() {
+		if err := database.ReleaseLock(context.WithoutCancel(ctx), compactLockName, database.InstanceID); err != nil {
+			log.Println("Error releasing risk history lock:", err)
+		}
+	}()
+
+	p := Policies().Base
+	today := now.UTC().Truncate(24 * time.Hour)
+	// Cut at a day boundary so a day is always folded from all of its runs;
+	// that makes a retry after a failed delete produce the same day entry
+	rawCutoff := today.AddDate(0, 0, -p.History.RawDays)
+	dailyCutoff := today.AddDate(0, 0, -p.History.DailyDays)
+
+	folded, err := foldRunsBefore(ctx, dbHistory{}, rawCutoff)
+	if err != nil {
+		log.Println("Error compacting risk history:", err)
+	}
+
+	deleted, err := database.DeleteRiskHistoryBefore(ctx, dailyCutoff)
+	if err != nil {
+		log.Println("Error expiring risk history:", err)
+	}
+	log.Printf("Risk history compacted: %d days folded, %d entries expired", folded, deleted)
+}
+
+// historyStore is where compaction reads per-run entries and writes the day
+// entries folded from them
+type historyStore interface {
+	// EachRawBefore calls fn with every per-run entry analyzed before t,
+	// grouped by lot and oldest first
+	EachRawBefore(ctx context.Context, t time.Time, fn func(database.RiskHistoryEntry) error) error
+	// ReplaceDay stores day and removes the runs it was folded from
+	ReplaceDay(ctx context.Context, day database.RiskHistoryEntry, runIDs []bson.ObjectID) error
+}
+
+type dbHistory struct{}
+
+func (dbHistory) EachRawBefore(ctx context.Context, t time.Time, fn func(database.RiskHistoryEntry) error) error {
+	return database.EachRawRiskHistoryBefore(ctx, t, fn)
+}
+
+func (dbHistory) ReplaceDay(ctx context.Context, day database.RiskHistoryEntry, runIDs []bson.ObjectID) error {
+	return database.ReplaceRiskHistoryDay(ctx, day, runIDs)
+}
+
+// foldRunsBefore replaces the per-run entries before cutoff with one entry
+// per lot and UTC day
+func foldRunsBefore(ctx context.Context, store historyStore, cutoff time.Time) (int, error) {
+	folded := 0
+	var day *database.RiskHistoryEntry
+	var ids []bson.ObjectID
+	var scoreSum int
+	var rulePoints map[string]int
+
+	flush := func() error {
+		if day == nil {
+			return nil
+		}
+		day.Score = int(math.Round(float64(scoreSum) / float64(day.Samples)))
+		for i := range day.Factors {
+			c := &day.Factors[i]
+			c.Points = int(math.Round(float64(rulePoints[c.Rule]) / float64(c.Fired)))
+		}
+		if err := store.ReplaceDay(ctx, *day, ids); err != nil {
+			return err
+		}
+		folded++
+		day, ids = nil, nil
+		return nil
+	}
+
+	err := store.EachRawBefore(ctx, cutoff, func(e database.RiskHistoryEntry) error {
+		start := e.AnalyzedAt.UTC().Truncate(24 * time.Hour)
+		if day != nil && (day.ParkingLotID != e.ParkingLotID || !day.AnalyzedAt.Equal(start)) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if day == nil {
+			day = &database.RiskHistoryEntry{
+				ParkingLotID: e.ParkingLotID,
+				Level:        e.Level,
+				AnalyzedAt:   start,
+				Resolution:   database.RiskResolutionDay,
+				MinScore:     e.Score,
+				MaxScore:     e.Score,
+				Factors:      []database.RiskFactor{},
+			}
+			scoreSum = 0
+			rulePoints = make(map[string]int)
+		}
+
+		// The last run of the day supplies the reason and policy version
+		ids = append(ids, e.ID)
+		day.Samples++
+		scoreSum += e.Score
+		day.MinScore = min(day.MinScore, e.Score)
+		day.MaxScore = max(day.MaxScore, e.Score)
+		day.Historical = e.Historical
+		day.Reason = e.Reason
+		day.PolicyVersion = e.PolicyVersion
+		if levelRank[e.Level] > levelRank[day.Level] {
+			day.Level = e.Level
+		}
+		// A rule can make several findings in one run; it still fired once,
+		// and its points for the run are their sum
+		firedNow := make(map[string]bool)
+		for _, c := range e.Factors {
+			if _, seen := rulePoints[c.Rule]; !seen {
+				day.Factors = append(day.Factors, database.RiskFactor{Rule: c.Rule})
+			}
+			rulePoints[c.Rule] += c.Points
+			for i := range day.Factors {
+				if day.Factors[i].Rule != c.Rule {
+					continue
+				}
+				df := &day.Factors[i]
+				if !firedNow[c.Rule] {
+					firedNow[c.Rule] = true
+					df.Fired++
+					df.Evidence = nil
+				}
+				df.Message = c.Message
+				df.Counts = c.Counts
+				df.Evidence = append(df.Evidence, c.Evidence...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return folded, err
+	}
+	return folded, flush()
+}
+
+// LevelSince returns the level of the newest entry and when the lot entered
+// it, i.e. the start of the unbroken run of that level at the end of the
+// series. entries must be oldest first.
+func LevelSince(entries []database.RiskHistoryEntry) (string, time.Time) {
+	if len(entries) == 0 {
+		return "", time.Time{}
+	}
+	last := len(entries) - 1
+	level := entries[last].Level
+	since := entries[last].AnalyzedAt
+	for i := last; i >= 0 && entries[i].Level == level; i-- {
+		since = entries[i].AnalyzedAt
+	}
+	return level, since
+}
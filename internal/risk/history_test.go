@@ -0,0 +1,151 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// fakeHistory holds per-run entries grouped by lot and oldest first, the
+// way EachRawRiskHistoryBefore returns them
+type fakeHistory struct {
+	raw     []database.RiskHistoryEntry
+	days    []database.RiskHistoryEntry
+	removed [][]bson.ObjectID
+	failOn  int // fail the nth ReplaceDay; 0 never fails
+}
+
+func (f *fakeHistory) EachRawBefore(_ context.Context, t time.Time, fn func(database.RiskHistoryEntry) error) error {
+	for _, e := range f.raw {
+		if !e.AnalyzedAt.Before(t) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeHistory) ReplaceDay(_ context.Context, day database.RiskHistoryEntry, runIDs []bson.ObjectID) error {
+	if len(f.days)+1 == f.failOn {
+		return errors.New("replace failed")
+	}
+	f.days = append(f.days, day)
+	f.removed = append(f.removed, runIDs)
+	return nil
+}
+
+func TestFoldRunsBefore(t *testing.T) {
+	day1 := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	day2, day3 := day1.AddDate(0, 0, 1), day1.AddDate(0, 0, 2)
+	lotA, lotB := bson.NewObjectID(), bson.NewObjectID()
+	ev := func(id string) []database.RiskEvidence { return []database.RiskEvidence{{Kind: "report", ID: id}} }
+	run := func(lot bson.ObjectID, at time.Time, score int, level string, factors ...database.RiskFactor) database.RiskHistoryEntry {
+		return database.RiskHistoryEntry{
+			ID: bson.NewObjectID(), ParkingLotID: lot, AnalyzedAt: at, Score: score, Level: level,
+			Resolution: database.RiskResolutionRun, Factors: factors, Reason: "run at " + at.Format(time.Kitchen),
+		}
+	}
+
+	a1 := run(lotA, day1.Add(1*time.Hour), 20, "LOW", database.RiskFactor{Rule: "report-density", Points: 20, Message: "first", Evidence: ev("r1")})
+	// report-density makes two findings in one run; it still fired once
+	a2 := run(lotA, day1.Add(13*time.Hour), 50, "HIGH",
+		database.RiskFactor{Rule: "report-density", Points: 10, Evidence: ev("r2")},
+		database.RiskFactor{Rule: "traffic-mismatch", Points: 25, Message: "jammed", Counts: map[string]int{"tickets": 1}},
+		database.RiskFactor{Rule: "report-density", Points: 15, Evidence: ev("r3")},
+	)
+	a3 := run(lotA, day1.Add(23*time.Hour), 35, "MEDIUM", database.RiskFactor{Rule: "report-density", Points: 5, Message: "last", Counts: map[string]int{"reports": 4}, Evidence: ev("r4")})
+	a3.PolicyVersion, a3.Historical = "v2", 5
+	a4 := run(lotA, day2.Add(30*time.Minute), 80, "HIGH")
+	a5 := run(lotA, day3.Add(time.Hour), 90, "HIGH") // on the cutoff day, kept
+	b1 := run(lotB, day1.Add(10*time.Hour), 10, "LOW")
+
+	store := &fakeHistory{raw: []database.RiskHistoryEntry{a1, a2, a3, a4, a5, b1}}
+	folded, err := foldRunsBefore(context.Background(), store, day3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if folded != 3 || len(store.days) != 3 {
+		t.Fatalf("folded %d days (%d stored), want 3", folded, len(store.days))
+	}
+
+	want := database.RiskHistoryEntry{
+		ParkingLotID:  lotA,
+		AnalyzedAt:    day1,
+		Resolution:    database.RiskResolutionDay,
+		Samples:       3,
+		Score:         35, // (20+50+35)/3
+		MinScore:      20,
+		MaxScore:      50,
+		Level:         "HIGH",
+		Reason:        a3.Reason,
+		PolicyVersion: "v2",
+		Historical:    5,
+		Factors: []database.RiskFactor{
+			// (20 + 10+15 + 5) over the three runs it fired in, with the
+			// last run's message, counts and evidence
+			{Rule: "report-density", Points: 17, Fired: 3, Message: "last", Counts: map[string]int{"reports": 4}, Evidence: ev("r4")},
+			{Rule: "traffic-mismatch", Points: 25, Fired: 1, Message: "jammed", Counts: map[string]int{"tickets": 1}},
+		},
+	}
+	if !reflect.DeepEqual(store.days[0], want) {
+		t.Errorf("lot A day 1 =\n%+v\nwant\n%+v", store.days[0], want)
+	}
+	if ids := store.removed[0]; !reflect.DeepEqual(ids, []bson.ObjectID{a1.ID, a2.ID, a3.ID}) {
+		t.Errorf("day 1 removed %v, want its three runs", ids)
+	}
+
+	if d := store.days[1]; d.ParkingLotID != lotA || !d.AnalyzedAt.Equal(day2) || d.Samples != 1 || d.Score != 80 || len(d.Factors) != 0 || d.Factors == nil {
+		t.Errorf("lot A day 2 = %+v, want one HIGH run with no factors", d)
+	}
+	if d := store.days[2]; d.ParkingLotID != lotB || !d.AnalyzedAt.Equal(day1) || d.Samples != 1 || d.Level != "LOW" {
+		t.Errorf("lot B day 1 = %+v, want its one run", d)
+	}
+	for _, ids := range store.removed {
+		for _, id := range ids {
+			if id == a5.ID {
+				t.Error("folded a run from the cutoff day")
+			}
+		}
+	}
+
+	// A failed write stops the fold and reports the days already done
+	store = &fakeHistory{raw: []database.RiskHistoryEntry{a1, a4, b1}, failOn: 2}
+	if folded, err := foldRunsBefore(context.Background(), store, day3); err == nil || folded != 1 {
+		t.Errorf("foldRunsBefore = %d, %v; want 1 and the write error", folded, err)
+	}
+}
+
+func TestLevelSince(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2026, 3, 10, h, 0, 0, 0, time.UTC) }
+	entry := func(h int, level string) database.RiskHistoryEntry {
+		return database.RiskHistoryEntry{AnalyzedAt: at(h), Level: level}
+	}
+
+	tests := []struct {
+		name    string
+		entries []database.RiskHistoryEntry
+		level   string
+		since   time.Time
+	}{
+		{"no history", nil, "", time.Time{}},
+		{"one entry", []database.RiskHistoryEntry{entry(3, "LOW")}, "LOW", at(3)},
+		{"same level throughout", []database.RiskHistoryEntry{entry(1, "HIGH"), entry(2, "HIGH"), entry(3, "HIGH")}, "HIGH", at(1)},
+		{"just changed", []database.RiskHistoryEntry{entry(1, "LOW"), entry(2, "LOW"), entry(3, "HIGH")}, "HIGH", at(3)},
+		{"back to an earlier level", []database.RiskHistoryEntry{entry(1, "MEDIUM"), entry(2, "HIGH"), entry(3, "MEDIUM"), entry(4, "MEDIUM")}, "MEDIUM", at(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, since := LevelSince(tt.entries)
+			if level != tt.level || !since.Equal(tt.since) {
+				t.Errorf("LevelSince = (%q, %v), want (%q, %v)", level, since, tt.level, tt.since)
+			}
+		})
+	}
+}
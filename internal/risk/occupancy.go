@@ -0,0 +1,68 @@
+package risk
+
+import (
+	"app/internal/database"
+	"sort"
+	"time"
+)
+
+// staleSessionAge is how long a session without an exit is taken to still
+// be parked. Sessions nobody closed would otherwise fill the lot forever.
+const staleSessionAge = 24 * time.Hour
+
+type occupancyEvent struct {
+	at    time.Time
+	delta int
+}
+
+// occupancySamples reconstructs a lot's occupancy from its sessions and
+// samples it every step from w.Start up to w.End
+func occupancySamples(sessions []database.ParkingSession, w Window, step time.Duration) []int {
+	var events []occupancyEvent
+	for _, s := range sessions {
+		exit := s.EntryTime.Add(staleSessionAge)
+		if s.ExitTime != nil && s.ExitTime.Before(exit) {
+			exit = *s.ExitTime
+		}
+		if !exit.After(s.EntryTime) {
+			continue
+		}
+		events = append(events, occupancyEvent{s.EntryTime, 1}, occupancyEvent{exit, -1})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+
+	var samples []int
+	occupied, next := 0, 0
+	for t := w.Start; t.Before(w.End); t = t.Add(step) {
+		for next < len(events) && !events[next].at.After(t) {
+			occupied += events[next].delta
+			next++
+		}
+		samples = append(samples, occupied)
+	}
+	return samples
+}
+
+// longestPlateau finds the longest run of samples that stays within
+// tolerance of itself. It returns the run's first sample, length and lowest
+// level.
+func longestPlateau(samples []int, tolerance int) (start, length, level int) {
+	for i := range samples {
+		lo, hi := samples[i], samples[i]
+		j := i
+		for ; j < len(samples); j++ {
+			lo, hi = min(lo, samples[j]), max(hi, samples[j])
+			if hi-lo > tolerance {
+				break
+			}
+		}
+		if j-i > length {
+			start, length = i, j-i
+			level = samples[i]
+			for _, v := range samples[i:j] {
+				level = min(level, v)
+			}
+		}
+	}
+	return start, length, level
+}
@@ -0,0 +1,154 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestOccupancySamples(t *testing.T) {
+	lot := bson.NewObjectID()
+	start := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return start.Add(time.Duration(m) * time.Minute) }
+	w := Window{Start: start, End: at(60)}
+
+	tests := []struct {
+		name     string
+		sessions []database.ParkingSession
+		want     []int
+	}{
+		{"empty lot", nil, []int{0, 0, 0, 0, 0, 0}},
+		{"in and out", []database.ParkingSession{session(lot, at(5), at(35))}, []int{0, 1, 1, 1, 0, 0}},
+		{"counted from the moment of entry", []database.ParkingSession{session(lot, at(10), at(30))}, []int{0, 1, 1, 0, 0, 0}},
+		{"overlapping", []database.ParkingSession{
+			session(lot, at(-30), at(25)),
+			session(lot, at(15), time.Time{}),
+		}, []int{1, 1, 2, 1, 1, 1}},
+		{"still parked", []database.ParkingSession{session(lot, at(-120), time.Time{})}, []int{1, 1, 1, 1, 1, 1}},
+		{"stale", []database.ParkingSession{session(lot, start.Add(-staleSessionAge).Add(30*time.Minute), time.Time{})}, []int{1, 1, 1, 0, 0, 0}},
+		{"exit before entry", []database.ParkingSession{session(lot, at(20), at(10))}, []int{0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := occupancySamples(tt.sessions, w, 10*time.Minute); !slices.Equal(got, tt.want) {
+				t.Errorf("occupancySamples = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongestPlateau(t *testing.T) {
+	tests := []struct {
+		name                             string
+		samples                          []int
+		tolerance                        int
+		wantStart, wantLength, wantLevel int
+	}{
+		{"no samples", nil, 1, 0, 0, 0},
+		{"flat", []int{3, 3, 3}, 0, 0, 3, 3},
+		{"within tolerance", []int{1, 5, 5, 6, 5, 2}, 1, 1, 4, 5},
+		{"beyond tolerance", []int{1, 5, 5, 6, 5, 2}, 0, 1, 2, 5},
+		{"level is the lowest", []int{9, 6, 7, 7, 6, 1}, 1, 1, 4, 6},
+		{"first of equal runs", []int{2, 2, 7, 7}, 0, 0, 2, 2},
+		{"rising", []int{1, 2, 3, 4, 5}, 1, 0, 2, 1},
+		{"empty is flat too", []int{0, 0, 0, 4, 4}, 1, 0, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, length, level := longestPlateau(tt.samples, tt.tolerance)
+			if start != tt.wantStart || length != tt.wantLength || level != tt.wantLevel {
+				t.Errorf("longestPlateau = (%d, %d, %d), want (%d, %d, %d)",
+					start, length, level, tt.wantStart, tt.wantLength, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestOccupancyPlateauRule(t *testing.T) {
+	p := DefaultPolicy()
+	loc := p.Location()
+	end := time.Date(2026, 3, 14, 22, 0, 0, 0, loc)
+	lotID := bson.NewObjectID()
+	lot := database.ParkingLot{ID: lotID, Capacity: 20}
+
+	// day returns local clock time on the i-th day before end
+	day := func(i, hour, minute int) time.Time {
+		d := end.AddDate(0, 0, -i)
+		return time.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, 0, loc)
+	}
+	// flat parks n cars through the whole peak on each of days
+	flat := func(n, days int) []database.ParkingSession {
+		var sessions []database.ParkingSession
+		for i := range days {
+			for range n {
+				sessions = append(sessions, session(lotID, day(i, 10, 0), day(i, 20, 30)))
+			}
+		}
+		return sessions
+	}
+	// rising lets a car in every sample and none out
+	rising := func(days int) []database.ParkingSession {
+		var sessions []database.ParkingSession
+		for i := range days {
+			for m := 0; m < 10*60; m += p.OccupancyPlateau.SampleMinutes {
+				sessions = append(sessions, session(lotID, day(i, 10, 0).Add(time.Duration(m)*time.Minute), day(i, 21, 0)))
+			}
+		}
+		return sessions
+	}
+
+	tests := []struct {
+		name       string
+		capacity   int
+		sessions   []database.ParkingSession
+		wantScore  int
+		wantCounts map[string]int
+	}{
+		{
+			name:      "capped every day",
+			capacity:  20,
+			sessions:  flat(5, 7),
+			wantScore: p.OccupancyPlateau.Points,
+			wantCounts: map[string]int{
+				"plateauDays":           7,
+				"daysChecked":           7,
+				"medianPlateauLevel":    5,
+				"longestPlateauMinutes": 600,
+			},
+		},
+		{name: "too few days", capacity: 20, sessions: flat(5, p.OccupancyPlateau.MinDays-1)},
+		{name: "flat but near full", capacity: 8, sessions: flat(5, 7)},
+		{name: "empty", capacity: 20},
+		{name: "filling up", capacity: 200, sessions: rising(7)},
+		{name: "no capacity", capacity: 0, sessions: flat(5, 7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lot.Capacity = tt.capacity
+			r := OccupancyPlateauRule{Sessions: fakeSessions(tt.sessions)}
+			res, err := r.Evaluate(context.Background(), lot, Window{Start: end.Add(-time.Hour), End: end}, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Score != tt.wantScore {
+				t.Fatalf("score = %d, want %d", res.Score, tt.wantScore)
+			}
+			if tt.wantScore == 0 {
+				return
+			}
+			f := res.Findings[0]
+			for k, want := range tt.wantCounts {
+				if f.Counts[k] != want {
+					t.Errorf("counts[%s] = %d, want %d", k, f.Counts[k], want)
+				}
+			}
+			if len(f.Evidence) == 0 {
+				t.Error("no sessions cited")
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Policy holds every threshold and weight the analyzer uses. A policy file
+// is JSON with the fields below (keys as in the json tags); anything left
+// out keeps its default. "areas" maps a ParkingLot.Area to partial overrides
+// of the same shape.
+type Policy struct {
+	Version string `json:"version"` // stamped on every RiskScore
+
+	// A lot needs at least MediumCount/HighCount unique reports in the
+	// window and, once its reports have a baseline, that many more than
+	// usual by z-score
+	ReportDensity struct {
+		WindowHours  int     `json:"windowHours"`
+		MediumCount  int     `json:"mediumCount"`
+		HighCount    int     `json:"highCount"`
+		MediumZ      float64 `json:"mediumZ"`
+		HighZ        float64 `json:"highZ"`
+		MediumPoints int     `json:"mediumPoints"`
+		HighPoints   int     `json:"highPoints"`
+	} `json:"reportDensity"`
+
+	TrafficMismatch struct {
+		CongestedAt          float64 `json:"congestedAt"` // congestion level (0-1) that counts as congested
+		MaxReadingAgeMinutes int     `json:"maxReadingAgeMinutes"`
+		ShortWindowMinutes   int     `json:"shortWindowMinutes"`
+		LongWindowMinutes    int     `json:"longWindowMinutes"`
+		ExpectedTickets      int     `json:"expectedTickets"` // used while there's no baseline
+		LowTicketsZ          float64 `json:"lowTicketsZ"`     // low activity at or below this z-score
+		LowActivityPoints    int     `json:"lowActivityPoints"`
+		StalledPoints        int     `json:"stalledPoints"`
+	} `json:"trafficMismatch"`
+
+	IgnoredQueries struct {
+		IdleMinutes int `json:"idleMinutes"`
+		Points      int `json:"points"`
+	} `json:"ignoredQueries"`
+
+	OccupancyPlateau struct {
+		Days              int     `json:"days"`          // look-back
+		SampleMinutes     int     `json:"sampleMinutes"` // occupancy sampling step
+		MinPlateauMinutes int     `json:"minPlateauMinutes"`
+		Tolerance         int     `json:"tolerance"` // vehicles occupancy may wander and still be flat
+		MaxFill           float64 `json:"maxFill"`   // plateau must sit at or below this share of capacity
+		MinDays           int     `json:"minDays"`   // days with a plateau before the rule fires
+		Points            int     `json:"points"`
+	} `json:"occupancyPlateau"`
+
+	// Entries are judged against the entries baseline (see Baselines)
+	PeakSuppression struct {
+		MinBaseline  float64 `json:"minBaseline"` // hours expecting fewer entries are too noisy to judge
+		MaxRatio     float64 `json:"maxRatio"`    // an hour is suppressed below this share of its baseline
+		MinHours     int     `json:"minHours"`    // suppressed hours before the rule fires
+		Points       int     `json:"points"`
+		MinPeers     int     `json:"minPeers"`     // area lots with a baseline needed to compare
+		PeerMaxRatio float64 `json:"peerMaxRatio"` // flag below this share of the area's median ratio
+		PeerPoints   int     `json:"peerPoints"`
+	} `json:"peakSuppression"`
+
+	ExitAnomalies struct {
+		Days        int `json:"days"`        // closed sessions looked at
+		MinSessions int `json:"minSessions"` // fewer closed sessions aren't enough to judge
+
+		ClusterShare  float64 `json:"clusterShare"` // share of sessions with one exact duration
+		ClusterPoints int     `json:"clusterPoints"`
+
+		Handovers       []string `json:"handovers"`       // local shift changes, "HH:MM"
+		HandoverMinutes int      `json:"handoverMinutes"` // window before each handover
+		HandoverFactor  float64  `json:"handoverFactor"`  // exits there vs an even spread over the day
+		HandoverPoints  int      `json:"handoverPoints"`
+
+		BillingUnitMinutes int     `json:"billingUnitMinutes"`
+		BillingShare       float64 `json:"billingShare"` // share closed at exactly one unit
+		BillingPoints      int     `json:"billingPoints"`
+
+		LongStayHours  int `json:"longStayHours"` // still no exit after this
+		LongStayCount  int `json:"longStayCount"`
+		LongStayPoints int `json:"longStayPoints"`
+	} `json:"exitAnomalies"`
+
+	PeerComparison struct {
+		Days       int     `json:"days"`
+		MinPeers   int     `json:"minPeers"`   // other lots in the area with capacity
+		Factor     float64 `json:"factor"`     // outlier when this many times off the area median
+		MinReports int     `json:"minReports"` // fewer reports are never an outlier
+		Points     int     `json:"points"`     // per outlying metric
+	} `json:"peerComparison"`
+
+	// Rolling per-hour-of-week history that rules compare against; see
+	// Baselines. A lot needs MinSamples weeks of an hour before its own
+	// history is used instead of its area's.
+	Baselines struct {
+		Weeks        int `json:"weeks"`
+		MinSamples   int `json:"minSamples"`
+		RefreshHours int `json:"refreshHours"`
+	} `json:"baselines"`
+
+	// Hours of the local day (End exclusive) when demand should be high, and
+	// the lots' offset from UTC
+	PeakHours struct {
+		Start int `json:"start"`
+		End   int `json:"end"`
+	} `json:"peakHours"`
+	UTCOffsetMinutes int `json:"utcOffsetMinutes"`
+
+	HistoricalMomentum float64 `json:"historicalMomentum"` // share of the previous score carried over
+
+	// Off unless enabled: a lot scored HIGH by a scheduled run gets this
+	// query, at most once per CooldownHours. Its answer, or lack of one, is
+	// then judged by the ignored-queries rule.
+	VerificationQueries struct {
+		Enabled       bool   `json:"enabled"`
+		Query         string `json:"query"`
+		WithInMinutes int    `json:"withInMinutes"`
+		CooldownHours int    `json:"cooldownHours"`
+	} `json:"verificationQueries"`
+
+	Levels struct {
+		Medium int `json:"medium"`
+		High   int `json:"high"`
+	} `json:"levels"`
+
+	// Only the base policy's values are used: history is kept per run for
+	// RawDays, then as one entry per day until DailyDays.
+	History struct {
+		RawDays   int `json:"rawDays"`
+		DailyDays int `json:"dailyDays"`
+	} `json:"history"`
+
+	// Per-rule switches and weights, keyed by Rule.Name(). Rules not listed
+	// run with weight 1. RISK_RULES overrides entries here in every area;
+	// see LoadRuleConfig.
+	Rules map[string]RuleConfig `json:"rules"`
+}
+
+// DefaultPolicy is what the analyzer did before policies were configurable
+func DefaultPolicy() *Policy {
+	p := &Policy{Version: "default", Rules: map[string]RuleConfig{}}
+	p.ReportDensity.WindowHours = 48
+	p.ReportDensity.MediumCount = 3
+	p.ReportDensity.HighCount = 5
+	p.ReportDensity.MediumZ = 2
+	p.ReportDensity.HighZ = 3
+	p.ReportDensity.MediumPoints = 30
+	p.ReportDensity.HighPoints = 50
+	p.TrafficMismatch.CongestedAt = 0.7
+	p.TrafficMismatch.MaxReadingAgeMinutes = 30
+	p.TrafficMismatch.ShortWindowMinutes = 60
+	p.TrafficMismatch.LongWindowMinutes = 120
+	p.TrafficMismatch.ExpectedTickets = 5
+	p.TrafficMismatch.LowTicketsZ = -1.5
+	p.TrafficMismatch.LowActivityPoints = 40
+	p.TrafficMismatch.StalledPoints = 60
+	p.IgnoredQueries.IdleMinutes = 10
+	p.IgnoredQueries.Points = 30
+	p.OccupancyPlateau.Days = 7
+	p.OccupancyPlateau.SampleMinutes = 10
+	p.OccupancyPlateau.MinPlateauMinutes = 120
+	p.OccupancyPlateau.Tolerance = 1
+	p.OccupancyPlateau.MaxFill = 0.6
+	p.OccupancyPlateau.MinDays = 3
+	p.OccupancyPlateau.Points = 35
+	p.PeakSuppression.MinBaseline = 4
+	p.PeakSuppression.MaxRatio = 0.5
+	p.PeakSuppression.MinHours = 2
+	p.PeakSuppression.Points = 40
+	p.PeakSuppression.MinPeers = 2
+	p.PeakSuppression.PeerMaxRatio = 0.6
+	p.PeakSuppression.PeerPoints = 25
+	p.ExitAnomalies.Days = 7
+	p.ExitAnomalies.MinSessions = 20
+	p.ExitAnomalies.ClusterShare = 0.25
+	p.ExitAnomalies.ClusterPoints = 20
+	p.ExitAnomalies.Handovers = []string{"08:00", "20:00"}
+	p.ExitAnomalies.HandoverMinutes = 15
+	p.ExitAnomalies.HandoverFactor = 4
+	p.ExitAnomalies.HandoverPoints = 20
+	p.ExitAnomalies.BillingUnitMinutes = 60
+	p.ExitAnomalies.BillingShare = 0.4
+	p.ExitAnomalies.BillingPoints = 20
+	p.ExitAnomalies.LongStayHours = 24
+	p.ExitAnomalies.LongStayCount = 3
+	p.ExitAnomalies.LongStayPoints = 15
+	p.PeerComparison.Days = 7
+	p.PeerComparison.MinPeers = 2
+	p.PeerComparison.Factor = 3
+	p.PeerComparison.MinReports = 3
+	p.PeerComparison.Points = 15
+	p.Baselines.Weeks = 8
+	p.Baselines.MinSamples = 4
+	p.Baselines.RefreshHours = 24
+	p.PeakHours.Start = 10
+	p.PeakHours.End = 20
+	p.UTCOffsetMinutes = 330 // IST
+	p.HistoricalMomentum = 0.25
+	p.VerificationQueries.Query = "Photograph the entry board now"
+	p.VerificationQueries.WithInMinutes = 10
+	p.VerificationQueries.CooldownHours = 6
+	p.Levels.Medium = 30
+	p.Levels.High = 70
+	p.History.RawDays = 14
+	p.History.DailyDays = 365
+	return p
+}
+
+// Location is the lots' local time zone
+func (p *Policy) Location() *time.Location {
+	return time.FixedZone("lot", p.UTCOffsetMinutes*60)
+}
+
+// PeakWindows returns the peak-hour windows of the local days from from to
+// to, clipped to [from, to)
+func (p *Policy) PeakWindows(from, to time.Time) []Window {
+	var windows []Window
+	local := from.In(p.Location())
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		start := day.Add(time.Duration(p.PeakHours.Start) * time.Hour)
+		end := day.Add(time.Duration(p.PeakHours.End) * time.Hour)
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if start.Before(end) {
+			windows = append(windows, Window{Start: start, End: end})
+		}
+	}
+	return windows
+}
+
+// PeakHourStarts returns the start of every whole local peak hour in
+// [from, to)
+func (p *Policy) PeakHourStarts(from, to time.Time) []time.Time {
+	var hours []time.Time
+	for _, w := range p.PeakWindows(from, to) {
+		local := w.Start.In(p.Location())
+		h := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, local.Location())
+		if h.Before(w.Start) {
+			h = h.Add(time.Hour)
+		}
+		for ; !h.Add(time.Hour).After(w.End); h = h.Add(time.Hour) {
+			hours = append(hours, h)
+		}
+	}
+	return hours
+}
+
+// Level maps a score to LOW, MEDIUM or HIGH
+func (p *Policy) Level(score int) string {
+	if score >= p.Levels.High {
+		return "HIGH"
+	}
+	if score >= p.Levels.Medium {
+		return "MEDIUM"
+	}
+	return "LOW"
+}
+
+// RuleConfig returns the switch and weight for a rule
+func (p *Policy) RuleConfig(name string) RuleConfig {
+	if cfg, ok := p.Rules[name]; ok {
+		return cfg
+	}
+	return defaultRuleConfig
+}
+
+// Validate reports every out-of-range value, not just the first
+func (p *Policy) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(p.Version != "", "version is required")
+
+	rd := p.ReportDensity
+	check(rd.WindowHours > 0, "reportDensity.windowHours must be positive")
+	check(rd.MediumCount > 0 && rd.MediumCount <= rd.HighCount, "reportDensity: need 0 < mediumCount <= highCount")
+	check(rd.MediumZ > 0 && rd.MediumZ <= rd.HighZ, "reportDensity: need 0 < mediumZ <= highZ")
+	check(rd.MediumPoints >= 0 && rd.HighPoints >= 0, "reportDensity: points can't be negative")
+
+	tm := p.TrafficMismatch
+	check(tm.CongestedAt > 0 && tm.CongestedAt <= 1, "trafficMismatch.congestedAt must be in (0, 1]")
+	check(tm.MaxReadingAgeMinutes > 0, "trafficMismatch.maxReadingAgeMinutes must be positive")
+	check(tm.ShortWindowMinutes > 0 && tm.ShortWindowMinutes <= tm.LongWindowMinutes, "trafficMismatch: need 0 < shortWindowMinutes <= longWindowMinutes")
+	check(tm.ExpectedTickets > 0, "trafficMismatch.expectedTickets must be positive")
+	check(tm.LowTicketsZ < 0, "trafficMismatch.lowTicketsZ must be negative")
+	check(tm.LowActivityPoints >= 0 && tm.StalledPoints >= 0, "trafficMismatch: points can't be negative")
+
+	check(p.IgnoredQueries.IdleMinutes > 0, "ignoredQueries.idleMinutes must be positive")
+	check(p.IgnoredQueries.Points >= 0, "ignoredQueries.points can't be negative")
+
+	op := p.OccupancyPlateau
+	check(op.Days > 0, "occupancyPlateau.days must be positive")
+	check(op.SampleMinutes > 0 && op.SampleMinutes <= op.MinPlateauMinutes, "occupancyPlateau: need 0 < sampleMinutes <= minPlateauMinutes")
+	check(op.Tolerance >= 0, "occupancyPlateau.tolerance can't be negative")
+	check(op.MaxFill > 0 && op.MaxFill <= 1, "occupancyPlateau.maxFill must be in (0, 1]")
+	check(op.MinDays > 0 && op.MinDays <= op.Days, "occupancyPlateau: need 0 < minDays <= days")
+	check(op.Points >= 0, "occupancyPlateau.points can't be negative")
+
+	ps := p.PeakSuppression
+	check(ps.MinBaseline > 0, "peakSuppression.minBaseline must be positive")
+	check(ps.MaxRatio > 0 && ps.MaxRatio < 1, "peakSuppression.maxRatio must be in (0, 1)")
+	check(ps.MinHours > 0, "peakSuppression.minHours must be positive")
+	check(ps.MinPeers > 0, "peakSuppression.minPeers must be positive")
+	check(ps.PeerMaxRatio > 0 && ps.PeerMaxRatio < 1, "peakSuppression.peerMaxRatio must be in (0, 1)")
+	check(ps.Points >= 0 && ps.PeerPoints >= 0, "peakSuppression: points can't be negative")
+
+	ea := p.ExitAnomalies
+	check(ea.Days > 0, "exitAnomalies.days must be positive")
+	check(ea.MinSessions > 0, "exitAnomalies.minSessions must be positive")
+	check(ea.ClusterShare > 0 && ea.ClusterShare <= 1, "exitAnomalies.clusterShare must be in (0, 1]")
+	for _, h := range ea.Handovers {
+		_, err := time.Parse("15:04", h)
+		check(err == nil, "exitAnomalies.handovers: %q is not HH:MM", h)
+	}
+	check(ea.HandoverMinutes > 0 && ea.HandoverMinutes*len(ea.Handovers) < 24*60, "exitAnomalies.handoverMinutes must be positive and leave room in the day")
+	check(ea.HandoverFactor > 1, "exitAnomalies.handoverFactor must be above 1")
+	check(ea.BillingUnitMinutes > 0, "exitAnomalies.billingUnitMinutes must be positive")
+	check(ea.BillingShare > 0 && ea.BillingShare <= 1, "exitAnomalies.billingShare must be in (0, 1]")
+	check(ea.LongStayHours > 0 && ea.LongStayCount > 0, "exitAnomalies: longStayHours and longStayCount must be positive")
+	check(ea.ClusterPoints >= 0 && ea.HandoverPoints >= 0 && ea.BillingPoints >= 0 && ea.LongStayPoints >= 0, "exitAnomalies: points can't be negative")
+
+	pc := p.PeerComparison
+	check(pc.Days > 0, "peerComparison.days must be positive")
+	check(pc.MinPeers > 0, "peerComparison.minPeers must be positive")
+	check(pc.Factor > 1, "peerComparison.factor must be above 1")
+	check(pc.MinReports > 0, "peerComparison.minReports must be positive")
+	check(pc.Points >= 0, "peerComparison.points can't be negative")
+
+	check(p.Baselines.Weeks > 0, "baselines.weeks must be positive")
+	check(p.Baselines.MinSamples > 0 && p.Baselines.MinSamples <= p.Baselines.Weeks, "baselines: need 0 < minSamples <= weeks")
+	check(p.Baselines.RefreshHours > 0, "baselines.refreshHours must be positive")
+
+	check(p.PeakHours.Start >= 0 && p.PeakHours.Start < p.PeakHours.End && p.PeakHours.End <= 24, "peakHours: need 0 <= start < end <= 24")
+	check(p.UTCOffsetMinutes >= -12*60 && p.UTCOffsetMinutes <= 14*60, "utcOffsetMinutes must be a real UTC offset")
+
+	check(p.HistoricalMomentum >= 0 && p.HistoricalMomentum < 1, "historicalMomentum must be in [0, 1)")
+	vq := p.VerificationQueries
+	check(vq.Query != "", "verificationQueries.query can't be empty")
+	check(vq.WithInMinutes > 0, "verificationQueries.withInMinutes must be positive")
+	check(vq.CooldownHours > 0, "verificationQueries.cooldownHours must be positive")
+	check(p.Levels.Medium > 0 && p.Levels.Medium < p.Levels.High, "levels: need 0 < medium < high")
+	check(p.History.RawDays > 0 && p.History.RawDays <= p.History.DailyDays, "history: need 0 < rawDays <= dailyDays")
+
+	known := make(map[string]bool)
+	for _, r := range Rules() {
+		known[r.Name()] = true
+	}
+	for name, cfg := range p.Rules {
+		check(known[name], "rules: unknown rule %q", name)
+		check(cfg.Weight >= 0, "rules.%s.weight can't be negative", name)
+	}
+
+	return errors.Join(errs...)
+}
+
+// PolicySet is the base policy plus per-area variants
+type PolicySet struct {
+	Base  *Policy
+	Areas map[string]*Policy
+}
+
+// For returns the policy for a parking lot's area
+func (s *PolicySet) For(area string) *Policy {
+	if p, ok := s.Areas[area]; ok {
+		return p
+	}
+	return s.Base
+}
+
+var currentPolicies atomic.Pointer[PolicySet]
+
+func init() {
+	currentPolicies.Store(&PolicySet{Base: DefaultPolicy()})
+}
+
+// Rule settings from the environment, applied over every policy's rules
+var ruleOverrides map[string]RuleConfig
+
+// LoadRuleConfig reads per-rule settings in the form
+// "report-density=1.5,traffic-mismatch=off". A number sets the weight, "off"
+// disables the rule. They take precedence over the policy file's "rules",
+// including its areas', so call it before LoadPolicyFile.
+func LoadRuleConfig(spec string) error {
+	overrides := make(map[string]RuleConfig)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("risk rule config %q: expected name=weight or name=off", entry)
+		}
+		if value == "off" {
+			overrides[name] = RuleConfig{Enabled: false}
+			continue
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 {
+			return fmt.Errorf("risk rule config %q: weight must be a non-negative number", entry)
+		}
+		overrides[name] = RuleConfig{Enabled: true, Weight: weight}
+	}
+
+	base := DefaultPolicy()
+	base.overrideRules(overrides)
+	if err := base.Validate(); err != nil {
+		return fmt.Errorf("risk rule config: %w", err)
+	}
+	ruleOverrides = overrides
+	currentPolicies.Store(&PolicySet{Base: base})
+	return nil
+}
+
+func (p *Policy) overrideRules(overrides map[string]RuleConfig) {
+	if p.Rules == nil {
+		p.Rules = make(map[string]RuleConfig)
+	}
+	for name, cfg := range overrides {
+		p.Rules[name] = cfg
+	}
+}
+
+// Policies returns the policies currently in force
+func Policies() *PolicySet {
+	return currentPolicies.Load()
+}
+
+// ParsePolicies reads a policy file's contents. The file must name its
+// version; it would otherwise be stamped with the default policy's.
+func ParsePolicies(data []byte) (*PolicySet, error) {
+	var file struct {
+		Version string                     `json:"version"`
+		Areas   map[string]json.RawMessage `json:"areas"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version == "" {
+		return nil, errors.New("version is required")
+	}
+
+	base := DefaultPolicy()
+	if err := json.Unmarshal(data, base); err != nil {
+		return nil, err
+	}
+	base.overrideRules(ruleOverrides)
+	if err := base.Validate(); err != nil {
+		return nil, err
+	}
+
+	set := &PolicySet{Base: base, Areas: make(map[string]*Policy)}
+	for area, raw := range file.Areas {
+		p, err := base.clone()
+		if err != nil {
+			return nil, err
+		}
+		p.Version = base.Version + "+" + area
+		if err := json.Unmarshal(raw, p); err != nil {
+			return nil, fmt.Errorf("area %q: %w", area, err)
+		}
+		p.overrideRules(ruleOverrides)
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("area %q: %w", area, err)
+		}
+		set.Areas[area] = p
+	}
+	return set, nil
+}
+
+func (p *Policy) clone() (*Policy, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	c := &Policy{}
+	return c, json.Unmarshal(data, c)
+}
+
+// ReadPolicyFile parses a policy file without putting it in force
+func ReadPolicyFile(path string) (*PolicySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := ParsePolicies(data)
+	if err != nil {
+		return nil, fmt.Errorf("risk policy %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// LoadPolicyFile replaces the policies in force with the file's
+func LoadPolicyFile(path string) error {
+	set, err := ReadPolicyFile(path)
+	if err != nil {
+		return err
+	}
+	currentPolicies.Store(set)
+	log.Printf("Loaded risk policy %s (version %s, %d area overrides)", path, set.Base.Version, len(set.Areas))
+	return nil
+}
+
+const policyPollInterval = 30 * time.Second
+
+// WatchPolicyFile reloads the policy file whenever it changes. A file that
+// fails to parse or validate is logged and the previous policy stays.
+func WatchPolicyFile(path string) {
+	lastMod := time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(policyPollInterval)
+	go func() {
+		for range ticker.C {
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			if err := LoadPolicyFile(path); err != nil {
+				log.Println("Error reloading risk policy, keeping the previous one:", err)
+			}
+		}
+	}()
+}
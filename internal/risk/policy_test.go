@@ -0,0 +1,264 @@
+package risk
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPeakHourStarts(t *testing.T) {
+	ist := DefaultPolicy() // peak 10:00-20:00, UTC+5:30
+	utc := DefaultPolicy()
+	utc.UTCOffsetMinutes = 0
+	evening := DefaultPolicy()
+	evening.PeakHours.Start, evening.PeakHours.End = 18, 24
+
+	local := func(p *Policy, day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, p.Location())
+	}
+
+	tests := []struct {
+		name      string
+		p         *Policy
+		from, to  time.Time
+		wantCount int
+		wantFirst time.Time
+		wantLast  time.Time
+	}{
+		{
+			name: "whole local day", p: ist,
+			from: local(ist, 14, 0, 0), to: local(ist, 15, 0, 0),
+			wantCount: 10, wantFirst: local(ist, 14, 10, 0), wantLast: local(ist, 14, 19, 0),
+		},
+		{
+			// The same UTC day starts at 05:30 in IST
+			name: "UTC day in IST", p: ist,
+			from: time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC), to: time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC),
+			wantCount: 10, wantFirst: local(ist, 14, 10, 0), wantLast: local(ist, 14, 19, 0),
+		},
+		{
+			name: "UTC policy", p: utc,
+			from: time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC), to: time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC),
+			wantCount: 10, wantFirst: time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC), wantLast: time.Date(2026, 3, 14, 19, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "partial hours left out", p: ist,
+			from: local(ist, 14, 10, 30), to: local(ist, 14, 19, 30),
+			wantCount: 8, wantFirst: local(ist, 14, 11, 0), wantLast: local(ist, 14, 18, 0),
+		},
+		{
+			name: "across days", p: ist,
+			from: local(ist, 13, 15, 0), to: local(ist, 14, 12, 0),
+			wantCount: 7, wantFirst: local(ist, 13, 15, 0), wantLast: local(ist, 14, 11, 0),
+		},
+		{
+			name: "peak to midnight", p: evening,
+			from: local(evening, 14, 0, 0), to: local(evening, 15, 0, 0),
+			wantCount: 6, wantFirst: local(evening, 14, 18, 0), wantLast: local(evening, 14, 23, 0),
+		},
+		{
+			name: "outside peak", p: ist,
+			from: local(ist, 14, 20, 0), to: local(ist, 15, 9, 0),
+		},
+		{
+			name: "less than an hour of peak", p: ist,
+			from: local(ist, 14, 19, 15), to: local(ist, 14, 23, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hours := tt.p.PeakHourStarts(tt.from, tt.to)
+			if len(hours) != tt.wantCount {
+				t.Fatalf("got %d hours %v, want %d", len(hours), hours, tt.wantCount)
+			}
+			if len(hours) == 0 {
+				return
+			}
+			if !hours[0].Equal(tt.wantFirst) || !hours[len(hours)-1].Equal(tt.wantLast) {
+				t.Errorf("hours run %v to %v, want %v to %v", hours[0], hours[len(hours)-1], tt.wantFirst, tt.wantLast)
+			}
+			for i := 1; i < len(hours); i++ {
+				if hours[i].Sub(hours[i-1]) < time.Hour {
+					t.Errorf("hours %v and %v overlap", hours[i-1], hours[i])
+				}
+			}
+		})
+	}
+}
+
+// useRuleConfig loads spec as RISK_RULES, restoring the previous settings
+// and policies after t
+func useRuleConfig(t *testing.T, spec string) {
+	t.Helper()
+	saved, savedSet := ruleOverrides, Policies()
+	t.Cleanup(func() {
+		ruleOverrides = saved
+		currentPolicies.Store(savedSet)
+	})
+	if err := LoadRuleConfig(spec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	useRuleConfig(t, "")
+	set, err := ParsePolicies([]byte(`{
+		"version": "2026-03",
+		"reportDensity": {"mediumCount": 4, "highCount": 8},
+		"levels": {"high": 80},
+		"areas": {
+			"Old City": {"reportDensity": {"highCount": 6}, "utcOffsetMinutes": 0},
+			"Airport": {}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := set.Base
+	if base.Version != "2026-03" || base.ReportDensity.MediumCount != 4 || base.ReportDensity.HighCount != 8 || base.Levels.High != 80 {
+		t.Errorf("base = version %q, counts %d/%d, high %d; want the file's values", base.Version, base.ReportDensity.MediumCount, base.ReportDensity.HighCount, base.Levels.High)
+	}
+	if base.Levels.Medium != DefaultPolicy().Levels.Medium || base.ReportDensity.WindowHours != DefaultPolicy().ReportDensity.WindowHours {
+		t.Error("values left out of the file lost their defaults")
+	}
+
+	old := set.For("Old City")
+	if old.Version != "2026-03+Old City" {
+		t.Errorf("area version %q, want the base's with the area", old.Version)
+	}
+	if old.ReportDensity.HighCount != 6 || old.ReportDensity.MediumCount != 4 || old.UTCOffsetMinutes != 0 || old.Levels.High != 80 {
+		t.Errorf("area override = counts %d/%d, offset %d, high %d; want its own values over the base's",
+			old.ReportDensity.MediumCount, old.ReportDensity.HighCount, old.UTCOffsetMinutes, old.Levels.High)
+	}
+	if base.ReportDensity.HighCount != 8 || base.UTCOffsetMinutes != DefaultPolicy().UTCOffsetMinutes {
+		t.Error("area override leaked into the base policy")
+	}
+	if set.For("Airport").Version != "2026-03+Airport" {
+		t.Errorf("empty area override has version %q", set.For("Airport").Version)
+	}
+	if set.For("Suburbs") != base {
+		t.Error("area without overrides doesn't get the base policy")
+	}
+
+	for _, tt := range []struct {
+		name, file, want string
+	}{
+		{"no version", `{"levels": {"high": 80}}`, "version is required"},
+		{"empty version", `{"version": ""}`, "version is required"},
+		{"not JSON", `version: 1`, "invalid character"},
+		{"out of range", `{"version": "v", "levels": {"medium": 90}}`, "levels"},
+		{"unknown rule", `{"version": "v", "rules": {"no-such-rule": {"weight": 2}}}`, "unknown rule"},
+		{"bad area", `{"version": "v", "areas": {"Old City": {"historicalMomentum": 1}}}`, `area "Old City"`},
+		{"area of the wrong type", `{"version": "v", "areas": {"Old City": {"levels": 3}}}`, `area "Old City"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicies([]byte(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultPolicy().Validate(); err != nil {
+		t.Fatalf("default policy is invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(p *Policy)
+		want   string
+	}{
+		{"no version", func(p *Policy) { p.Version = "" }, "version is required"},
+		{"medium above high count", func(p *Policy) { p.ReportDensity.MediumCount = 9 }, "mediumCount <= highCount"},
+		{"congestion above 1", func(p *Policy) { p.TrafficMismatch.CongestedAt = 1.5 }, "congestedAt"},
+		{"positive low z", func(p *Policy) { p.TrafficMismatch.LowTicketsZ = 1 }, "lowTicketsZ"},
+		{"short window longer than long", func(p *Policy) { p.TrafficMismatch.ShortWindowMinutes = 600 }, "shortWindowMinutes <= longWindowMinutes"},
+		{"more plateau days than days", func(p *Policy) { p.OccupancyPlateau.MinDays = 8 }, "minDays <= days"},
+		{"ratio of 1", func(p *Policy) { p.PeakSuppression.MaxRatio = 1 }, "maxRatio"},
+		{"handover not a time", func(p *Policy) { p.ExitAnomalies.Handovers = []string{"8am"} }, `"8am" is not HH:MM`},
+		{"handovers fill the day", func(p *Policy) { p.ExitAnomalies.HandoverMinutes = 12 * 60 }, "handoverMinutes"},
+		{"negative points", func(p *Policy) { p.ExitAnomalies.LongStayPoints = -1 }, "exitAnomalies: points"},
+		{"peer factor of 1", func(p *Policy) { p.PeerComparison.Factor = 1 }, "peerComparison.factor"},
+		{"more samples than weeks", func(p *Policy) { p.Baselines.MinSamples = 9 }, "minSamples <= weeks"},
+		{"peak ends before it starts", func(p *Policy) { p.PeakHours.Start = 20 }, "peakHours"},
+		{"offset off the globe", func(p *Policy) { p.UTCOffsetMinutes = 15 * 60 }, "utcOffsetMinutes"},
+		{"full momentum", func(p *Policy) { p.HistoricalMomentum = 1 }, "historicalMomentum"},
+		{"levels swapped", func(p *Policy) { p.Levels.Medium = 80 }, "levels"},
+		{"raw history longer than daily", func(p *Policy) { p.History.RawDays = 400 }, "rawDays <= dailyDays"},
+		{"unknown rule", func(p *Policy) { p.Rules["no-such-rule"] = defaultRuleConfig }, "unknown rule"},
+		{"negative weight", func(p *Policy) { p.Rules["report-density"] = RuleConfig{Enabled: true, Weight: -1} }, "weight can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultPolicy()
+			tt.mutate(p)
+			err := p.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported, not just the first
+	p := DefaultPolicy()
+	p.Version = ""
+	p.Levels.Medium = 0
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "version") || !strings.Contains(err.Error(), "levels") {
+		t.Errorf("err = %v, want both problems", err)
+	}
+}
+
+func TestLoadRuleConfig(t *testing.T) {
+	useRuleConfig(t, " report-density=off, traffic-mismatch=2.5 ,")
+	if cfg := Policies().Base.RuleConfig("report-density"); cfg.Enabled {
+		t.Errorf("report-density = %+v, want off", cfg)
+	}
+
+	// The environment wins over the file, in the base and in every area;
+	// rules it doesn't mention keep the file's settings
+	set, err := ParsePolicies([]byte(`{
+		"version": "v",
+		"rules": {"report-density": {"weight": 3}, "ignored-queries": {"weight": 0.5}},
+		"areas": {"Old City": {"rules": {"traffic-mismatch": {"weight": 4}, "peer-comparison": {"enabled": false}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]RuleConfig{
+		"base": {
+			"report-density":   {Enabled: false},
+			"traffic-mismatch": {Enabled: true, Weight: 2.5},
+			"ignored-queries":  {Enabled: true, Weight: 0.5},
+			"peer-comparison":  defaultRuleConfig,
+		},
+		"Old City": {
+			"report-density":   {Enabled: false},
+			"traffic-mismatch": {Enabled: true, Weight: 2.5},
+			"ignored-queries":  {Enabled: true, Weight: 0.5},
+			"peer-comparison":  {Enabled: false, Weight: 1},
+		},
+	}
+	for area, rules := range want {
+		p := set.Base
+		if area != "base" {
+			p = set.For(area)
+		}
+		for name, cfg := range rules {
+			if got := p.RuleConfig(name); got != cfg {
+				t.Errorf("%s %s = %+v, want %+v", area, name, got, cfg)
+			}
+		}
+	}
+
+	for _, bad := range []string{"report-density", "report-density=-1", "report-density=lots", "no-such-rule=2"} {
+		if err := LoadRuleConfig(bad); err == nil {
+			t.Errorf("LoadRuleConfig(%q) accepted", bad)
+		}
+	}
+	if cfg := Policies().Base.RuleConfig("report-density"); cfg.Enabled {
+		t.Error("a rejected config replaced the one in force")
+	}
+}
@@ -0,0 +1,159 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RankingFilter narrows the audit ranking. Zero values don't filter.
+type RankingFilter struct {
+	Area               string
+	Levels             []string // any of these
+	MinPersistenceDays float64  // at the current level for at least this long
+	// Top switches to "what to inspect today": lots at MEDIUM or above that
+	// haven't been audited in the last AuditCooldown, at most Top of them
+	Top           int
+	AuditCooldown time.Duration
+}
+
+// RankedLot is one row of the audit ranking
+type RankedLot struct {
+	Rank            int                   `json:"rank"`
+	ParkingLotID    string                `json:"parkingLotId"`
+	PID             string                `json:"pid,omitempty"`
+	Name            string                `json:"name"`
+	Area            string                `json:"area"`
+	Score           int                   `json:"score"`
+	Level           string                `json:"level"`
+	LevelSince      *time.Time            `json:"levelSince,omitempty"`
+	PersistenceDays float64               `json:"persistenceDays"`
+	Trend           int                   `json:"trend"` // score change over trendWindow
+	LastAuditAt     *time.Time            `json:"lastAuditAt,omitempty"`
+	AnalyzedAt      time.Time             `json:"analyzedAt"`
+	Factors         []database.RiskFactor `json:"factors"`
+}
+
+// trendWindow is how far back Trend compares the score
+const trendWindow = 24 * time.Hour
+
+// trendLookBack is how far before the trend window Rank looks for a score
+// to compare with, which covers a day of history folded into one entry
+const trendLookBack = 48 * time.Hour
+
+// Rank orders lots for physical audit: highest score first, then the
+// fastest rising, then the longest since an audit (never audited first)
+func Rank(ctx context.Context, f RankingFilter, now time.Time) ([]RankedLot, error) {
+	scores, err := database.GetAllRiskScores(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lots, err := database.GetAllParkingLots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	audits, err := database.GetLastAuditTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scoredIDs := make([]bson.ObjectID, len(scores))
+	for i, s := range scores {
+		scoredIDs[i] = s.ParkingLotID
+	}
+	before, err := database.GetRiskHistoryScoresAt(ctx, scoredIDs, now.Add(-trendWindow), trendLookBack)
+	if err != nil {
+		return nil, err
+	}
+	return rankLots(f, now, scores, lots, audits, before), nil
+}
+
+// rankLots filters and orders scores for Rank. audits holds each lot's last
+// audit and before each lot's score a trendWindow ago.
+func rankLots(f RankingFilter, now time.Time, scores []database.RiskScore, lots []database.ParkingLot, audits map[bson.ObjectID]time.Time, before map[bson.ObjectID]int) []RankedLot {
+	byID := make(map[bson.ObjectID]database.ParkingLot, len(lots))
+	for _, l := range lots {
+		byID[l.ID] = l
+	}
+	levels := make(map[string]bool)
+	for _, l := range f.Levels {
+		levels[l] = true
+	}
+
+	ranked := []RankedLot{}
+	for _, s := range scores {
+		lot, ok := byID[s.ParkingLotID]
+		if !ok {
+			continue // lot deleted since it was scored
+		}
+		if f.Area != "" && lot.Area != f.Area {
+			continue
+		}
+		if len(levels) > 0 && !levels[s.Level] {
+			continue
+		}
+		if f.Top > 0 && levelRank[s.Level] < levelRank["MEDIUM"] {
+			continue
+		}
+		lastAudit, audited := audits[lot.ID]
+		if f.Top > 0 && audited && now.Sub(lastAudit) < f.AuditCooldown {
+			continue
+		}
+
+		row := RankedLot{
+			ParkingLotID: lot.ID.Hex(),
+			PID:          lot.PID,
+			Name:         lot.Name,
+			Area:         lot.Area,
+			Score:        s.Score,
+			Level:        s.Level,
+			AnalyzedAt:   s.AnalyzedAt,
+			Factors:      s.Factors,
+		}
+		if audited {
+			row.LastAuditAt = &lastAudit
+		}
+
+		if since := s.LevelSince; !since.IsZero() {
+			row.LevelSince = &since
+			row.PersistenceDays = now.Sub(since).Hours() / 24
+		}
+		if row.PersistenceDays < f.MinPersistenceDays {
+			continue
+		}
+
+		if prev, ok := before[lot.ID]; ok {
+			row.Trend = s.Score - prev
+		}
+		ranked = append(ranked, row)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Trend != b.Trend {
+			return a.Trend > b.Trend
+		}
+		return auditAge(a, now) > auditAge(b, now)
+	})
+	if f.Top > 0 && len(ranked) > f.Top {
+		ranked = ranked[:f.Top]
+	}
+	for i := range ranked {
+		ranked[i].Rank = i + 1
+	}
+	return ranked
+}
+
+// auditAge is how long ago a lot was audited; never counts as forever
+func auditAge(r RankedLot, now time.Time) time.Duration {
+	if r.LastAuditAt == nil {
+		return time.Duration(math.MaxInt64)
+	}
+	return now.Sub(*r.LastAuditAt)
+}
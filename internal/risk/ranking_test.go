@@ -0,0 +1,87 @@
+package risk
+
+import (
+	"app/internal/database"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRankLots(t *testing.T) {
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	days := func(n float64) time.Time { return now.Add(-time.Duration(n * 24 * float64(time.Hour))) }
+
+	lot := func(name, area string) database.ParkingLot {
+		return database.ParkingLot{ID: bson.NewObjectID(), Name: name, Area: area}
+	}
+	a, b, c, d, e := lot("a", "north"), lot("b", "north"), lot("c", "south"), lot("d", "south"), lot("e", "north")
+	gone := bson.NewObjectID() // scored, then deleted
+	lots := []database.ParkingLot{a, b, c, d, e}
+
+	score := func(id bson.ObjectID, n int, level string, since time.Time) database.RiskScore {
+		return database.RiskScore{ParkingLotID: id, Score: n, Level: level, LevelSince: since}
+	}
+	scores := []database.RiskScore{
+		score(a.ID, 80, "HIGH", days(1)),
+		score(b.ID, 50, "MEDIUM", days(5)),
+		score(c.ID, 50, "MEDIUM", days(2)),
+		score(d.ID, 50, "MEDIUM", days(3)),
+		score(e.ID, 10, "LOW", time.Time{}),
+		score(gone, 99, "HIGH", days(1)),
+	}
+	// b, c and d tie on score; c rose fastest, and of b and d, d was
+	// never audited
+	before := map[bson.ObjectID]int{a.ID: 90, b.ID: 40, c.ID: 20, d.ID: 40}
+	audits := map[bson.ObjectID]time.Time{a.ID: days(2), b.ID: days(10), e.ID: days(30)}
+
+	tests := []struct {
+		name string
+		f    RankingFilter
+		want []string
+	}{
+		{"everything", RankingFilter{}, []string{"a", "c", "d", "b", "e"}},
+		{"area", RankingFilter{Area: "south"}, []string{"c", "d"}},
+		{"levels", RankingFilter{Levels: []string{"HIGH", "LOW"}}, []string{"a", "e"}},
+		{"persistence", RankingFilter{MinPersistenceDays: 2.5}, []string{"d", "b"}},
+		{"inspect today skips LOW and recent audits", RankingFilter{Top: 10, AuditCooldown: 7 * 24 * time.Hour}, []string{"c", "d", "b"}},
+		{"inspect today, top 2", RankingFilter{Top: 2, AuditCooldown: 7 * 24 * time.Hour}, []string{"c", "d"}},
+		{"inspect today without cooldown", RankingFilter{Top: 10}, []string{"a", "c", "d", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked := rankLots(tt.f, now, scores, lots, audits, before)
+			var got []string
+			for i, r := range ranked {
+				got = append(got, r.Name)
+				if r.Rank != i+1 {
+					t.Errorf("%s ranked %d at position %d", r.Name, r.Rank, i+1)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ranked %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ranked %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Rows carry the trend, persistence and last audit
+	byName := make(map[string]RankedLot)
+	for _, r := range rankLots(RankingFilter{}, now, scores, lots, audits, before) {
+		byName[r.Name] = r
+	}
+	if r := byName["a"]; r.Trend != -10 || r.PersistenceDays != 1 || r.LastAuditAt == nil || !r.LastAuditAt.Equal(days(2)) {
+		t.Errorf("a = trend %d, %v days, audited %v; want -10, 1 day, 2 days ago", r.Trend, r.PersistenceDays, r.LastAuditAt)
+	}
+	if r := byName["c"]; r.Trend != 30 || r.LastAuditAt != nil {
+		t.Errorf("c = trend %d, audited %v; want +30 and never", r.Trend, r.LastAuditAt)
+	}
+	// No score a day ago is no trend, and no LevelSince no persistence
+	if r := byName["e"]; r.Trend != 0 || r.LevelSince != nil || r.PersistenceDays != 0 {
+		t.Errorf("e = trend %d, since %v, %v days; want none", r.Trend, r.LevelSince, r.PersistenceDays)
+	}
+}
@@ -0,0 +1,150 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// Window is the period an analysis covers. End is the moment the lot is
+// scored at; rules that need more history reach back from End themselves.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Finding is one reason a rule added points. Counts holds the numbers the
+// rule decided on and Evidence the records behind them.
+type Finding struct {
+	Rule     string                  `json:"rule"`
+	Points   int                     `json:"points"`
+	Message  string                  `json:"message"`
+	Counts   map[string]int          `json:"counts,omitempty"`
+	Evidence []database.RiskEvidence `json:"evidence,omitempty"`
+}
+
+// maxEvidence caps the records listed per finding; Counts stay exact
+const maxEvidence = 50
+
+// Factor converts a finding to its stored form
+func (f Finding) Factor() database.RiskFactor {
+	return database.RiskFactor{
+		Rule:     f.Rule,
+		Points:   f.Points,
+		Message:  f.Message,
+		Counts:   f.Counts,
+		Evidence: f.Evidence,
+	}
+}
+
+// evidence refers to a record the evidence endpoint can return
+func evidence(kind, id string) database.RiskEvidence {
+	return database.RiskEvidence{Kind: kind, ID: id, Link: "/api/admin/risk/evidence/" + kind + "/" + id}
+}
+
+// appendEvidence adds e to list unless the list is full
+func appendEvidence(list []database.RiskEvidence, e database.RiskEvidence) []database.RiskEvidence {
+	if len(list) >= maxEvidence {
+		return list
+	}
+	return append(list, e)
+}
+
+// Result is what a rule contributes to a lot's score
+type Result struct {
+	Score    int
+	Findings []Finding
+}
+
+// Rule is one over-parking signal. Rules get their data through the source
+// interfaces in sources.go so they can be run against fakes.
+type Rule interface {
+	// Name identifies the rule in configuration and findings
+	Name() string
+	Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error)
+}
+
+// RuleConfig switches a rule on or off and scales its points
+type RuleConfig struct {
+	Enabled bool    `json:"enabled"`
+	Weight  float64 `json:"weight"`
+}
+
+var defaultRuleConfig = RuleConfig{Enabled: true, Weight: 1}
+
+// UnmarshalJSON starts from the defaults, so {"weight": 2} stays enabled
+func (c *RuleConfig) UnmarshalJSON(data []byte) error {
+	type plain RuleConfig
+	cfg := plain(defaultRuleConfig)
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = RuleConfig(cfg)
+	return nil
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Rule
+)
+
+// Register adds a rule to the engine. Rules run in registration order.
+func Register(r Rule) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name() == r.Name() {
+			panic("risk: rule registered twice: " + r.Name())
+		}
+	}
+	registry = append(registry, r)
+}
+
+// Rules returns the registered rules
+func Rules() []Rule {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Rule(nil), registry...)
+}
+
+// evaluateRules runs every enabled rule against a lot and returns the
+// weighted total and findings. A failing rule is logged and contributes
+// nothing, like the rules did when they were called directly. Once ctx
+// ends the remaining rules are skipped and ctx's error is returned.
+func evaluateRules(ctx context.Context, rules []Rule, lot database.ParkingLot, w Window, p *Policy) (int, []Finding, error) {
+	score := 0
+	var findings []Finding
+	for _, r := range rules {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, err
+		}
+		cfg := p.RuleConfig(r.Name())
+		if !cfg.Enabled {
+			continue
+		}
+
+		res, err := r.Evaluate(ctx, lot, w, p)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, nil, ctx.Err()
+			}
+			logRuleError(r, lot, err)
+			continue
+		}
+
+		score += weighted(res.Score, cfg.Weight)
+		for _, f := range res.Findings {
+			f.Rule = r.Name()
+			f.Points = weighted(f.Points, cfg.Weight)
+			findings = append(findings, f)
+		}
+	}
+	return score, findings, nil
+}
+
+func weighted(points int, weight float64) int {
+	return int(math.Round(float64(points) * weight))
+}
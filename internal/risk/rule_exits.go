@@ -0,0 +1,157 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Rule 6: Exit-duration and Timing Anomalies
+// Looks at how sessions end. Each pattern is scored on its own:
+//   - many sessions with one exact duration (exits typed in, not scanned)
+//   - exits bunched just before a shift handover (books squared at hand-off)
+//   - sessions closed at exactly the minimum billing unit (undercharging)
+//   - vehicles that entered long ago and never got an exit
+//
+// The patterns are findings of one rule rather than rules of their own: they
+// read the same sessions, and what they share is a lot's exit records being
+// kept by hand. RuleConfig weighs or switches off all of them together; one
+// pattern is tuned through its points in the policy's exitAnomalies, and
+// setting them to 0 leaves it out.
+type ExitAnomalyRule struct {
+	Sessions SessionSource
+}
+
+func (ExitAnomalyRule) Name() string { return "exit-anomalies" }
+
+func (r ExitAnomalyRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.ExitAnomalies
+
+	from := w.End.AddDate(0, 0, -cfg.Days)
+	sessions, err := r.Sessions.SessionsOverlapping(ctx, id, from, w.End)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var closed []database.ParkingSession
+	var longStays []database.RiskEvidence
+	longStay := time.Duration(cfg.LongStayHours) * time.Hour
+	for _, s := range sessions {
+		// Exits after w.End hadn't happened yet as of w.End
+		if s.ExitTime == nil || s.ExitTime.After(w.End) {
+			if w.End.Sub(s.EntryTime) > longStay {
+				longStays = append(longStays, evidence("session", s.ID.Hex()))
+			}
+			continue
+		}
+		if !s.ExitTime.Before(from) && s.ExitTime.Before(w.End) && s.ExitTime.After(s.EntryTime) {
+			closed = append(closed, s)
+		}
+	}
+
+	log.Printf("Lot %s: %d closed sessions, %d long stays without exit (R6)", id, len(closed), len(longStays))
+
+	var res Result
+	add := func(f Finding) {
+		if f.Points == 0 {
+			return
+		}
+		res.Score += f.Points
+		res.Findings = append(res.Findings, f)
+	}
+
+	if len(longStays) >= cfg.LongStayCount {
+		msg := fmt.Sprintf("R6: %d vehicles parked over %dh with no exit recorded", len(longStays), cfg.LongStayHours)
+		counts := map[string]int{"longStays": len(longStays), "longStayHours": cfg.LongStayHours}
+		add(Finding{Points: cfg.LongStayPoints, Message: msg, Counts: counts, Evidence: capEvidence(longStays)})
+	}
+
+	if len(closed) < cfg.MinSessions {
+		return res, nil
+	}
+	total := len(closed)
+
+	// Identical durations, to the minute
+	byDuration := make(map[int][]database.ParkingSession)
+	for _, s := range closed {
+		m := int(s.ExitTime.Sub(s.EntryTime).Round(time.Minute) / time.Minute)
+		byDuration[m] = append(byDuration[m], s)
+	}
+	// The billing unit has its own finding below, so it doesn't count here
+	modeMinutes, mode := 0, []database.ParkingSession(nil)
+	for m, group := range byDuration {
+		if m == cfg.BillingUnitMinutes {
+			continue
+		}
+		if len(group) > len(mode) || (len(group) == len(mode) && m < modeMinutes) {
+			modeMinutes, mode = m, group
+		}
+	}
+	if len(mode) > 0 && float64(len(mode)) >= cfg.ClusterShare*float64(total) {
+		msg := fmt.Sprintf("R6: %d of %d sessions lasted exactly %d minutes", len(mode), total, modeMinutes)
+		counts := map[string]int{"sessions": total, "clusterSize": len(mode), "durationMinutes": modeMinutes}
+		add(Finding{Points: cfg.ClusterPoints, Message: msg, Counts: counts, Evidence: sessionEvidence(mode)})
+	}
+
+	// Exits just before a shift handover
+	if len(cfg.Handovers) > 0 {
+		var bunched []database.ParkingSession
+		for _, s := range closed {
+			if beforeHandover(s.ExitTime.In(p.Location()), cfg.Handovers, cfg.HandoverMinutes) {
+				bunched = append(bunched, s)
+			}
+		}
+		// What an even spread of exits over the day would put in the windows
+		expected := float64(total) * float64(cfg.HandoverMinutes*len(cfg.Handovers)) / (24 * 60)
+		if float64(len(bunched)) >= cfg.HandoverFactor*expected {
+			msg := fmt.Sprintf("R6: %d of %d exits within %d minutes before a shift handover (~%.0f expected)", len(bunched), total, cfg.HandoverMinutes, expected)
+			counts := map[string]int{"sessions": total, "exitsBeforeHandover": len(bunched), "expected": int(expected + 0.5), "handoverMinutes": cfg.HandoverMinutes}
+			add(Finding{Points: cfg.HandoverPoints, Message: msg, Counts: counts, Evidence: sessionEvidence(bunched)})
+		}
+	}
+
+	// Closed at exactly the minimum billing unit
+	if unit := byDuration[cfg.BillingUnitMinutes]; float64(len(unit)) >= cfg.BillingShare*float64(total) {
+		msg := fmt.Sprintf("R6: %d of %d sessions closed at exactly the %d-minute minimum", len(unit), total, cfg.BillingUnitMinutes)
+		counts := map[string]int{"sessions": total, "minimumUnitSessions": len(unit), "billingUnitMinutes": cfg.BillingUnitMinutes}
+		add(Finding{Points: cfg.BillingPoints, Message: msg, Counts: counts, Evidence: sessionEvidence(unit)})
+	}
+
+	return res, nil
+}
+
+// beforeHandover reports whether t falls in the minutes before one of the
+// "HH:MM" handovers (invalid entries are rejected by Policy.Validate)
+func beforeHandover(t time.Time, handovers []string, minutes int) bool {
+	minuteOfDay := t.Hour()*60 + t.Minute()
+	for _, h := range handovers {
+		at, err := time.Parse("15:04", h)
+		if err != nil {
+			continue
+		}
+		handover := at.Hour()*60 + at.Minute()
+		before := (handover - minuteOfDay + 24*60) % (24 * 60)
+		if before > 0 && before <= minutes {
+			return true
+		}
+	}
+	return false
+}
+
+func sessionEvidence(sessions []database.ParkingSession) []database.RiskEvidence {
+	var refs []database.RiskEvidence
+	for _, s := range sessions {
+		refs = appendEvidence(refs, evidence("session", s.ID.Hex()))
+	}
+	return refs
+}
+
+func capEvidence(refs []database.RiskEvidence) []database.RiskEvidence {
+	if len(refs) > maxEvidence {
+		return refs[:maxEvidence]
+	}
+	return refs
+}
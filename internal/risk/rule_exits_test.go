@@ -0,0 +1,181 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBeforeHandover(t *testing.T) {
+	ist := time.FixedZone("IST", 330*60)
+	at := func(hour, minute int) time.Time { return time.Date(2026, 3, 14, hour, minute, 0, 0, ist) }
+	shifts := []string{"08:00", "20:00"}
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		handovers []string
+		minutes   int
+		want      bool
+	}{
+		{"just before", at(7, 55), shifts, 15, true},
+		{"at the edge", at(7, 45), shifts, 15, true},
+		{"too early", at(7, 44), shifts, 15, false},
+		{"at the handover", at(8, 0), shifts, 15, false},
+		{"just after", at(8, 5), shifts, 15, false},
+		{"second shift", at(19, 59), shifts, 15, true},
+		{"across midnight", at(23, 50), []string{"00:05"}, 15, true},
+		{"after midnight", at(0, 10), []string{"00:05"}, 15, false},
+		{"local clock, not UTC", at(7, 50).UTC(), shifts, 15, false},
+		{"no handovers", at(7, 55), nil, 15, false},
+		{"unparseable skipped", at(7, 55), []string{"8am", "08:00"}, 15, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := beforeHandover(tt.t, tt.handovers, tt.minutes); got != tt.want {
+				t.Errorf("beforeHandover(%s) = %v, want %v", tt.t.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitAnomalyRule(t *testing.T) {
+	p := DefaultPolicy()
+	end := time.Date(2026, 3, 14, 12, 0, 0, 0, p.Location())
+	w := Window{Start: end.Add(-24 * time.Hour), End: end}
+	lot := database.ParkingLot{ID: bson.NewObjectID(), Capacity: 40}
+
+	// varied closes n sessions with no two durations alike, well clear of
+	// the handovers
+	varied := func(n int) []database.ParkingSession {
+		var out []database.ParkingSession
+		for i := range n {
+			entry := end.Add(-time.Duration(i+1) * 6 * time.Hour)
+			out = append(out, session(lot.ID, entry, entry.Add(time.Duration(41+3*i)*time.Minute)))
+		}
+		return out
+	}
+	// lasting closes n sessions after exactly minutes each
+	lasting := func(n, minutes int) []database.ParkingSession {
+		var out []database.ParkingSession
+		for i := range n {
+			entry := end.Add(-time.Duration(i+1)*6*time.Hour - 3*time.Hour)
+			out = append(out, session(lot.ID, entry, entry.Add(time.Duration(minutes)*time.Minute)))
+		}
+		return out
+	}
+	// beforeShift closes n sessions at 19:50 on the days before end
+	beforeShift := func(n int) []database.ParkingSession {
+		var out []database.ParkingSession
+		for i := range n {
+			exit := end.AddDate(0, 0, -i-1).Add(7*time.Hour + 50*time.Minute)
+			out = append(out, session(lot.ID, exit.Add(-2*time.Hour), exit))
+		}
+		return out
+	}
+	// stuck are sessions entered more than a day ago with no exit as of end
+	stuck := []database.ParkingSession{
+		session(lot.ID, end.Add(-30*time.Hour), time.Time{}),
+		session(lot.ID, end.Add(-50*time.Hour), time.Time{}),
+		session(lot.ID, end.Add(-25*time.Hour), end.Add(time.Hour)), // left after end
+	}
+	recent := session(lot.ID, end.Add(-10*time.Hour), time.Time{})
+
+	cluster, billed, bunched := lasting(5, 37), lasting(8, 60), beforeShift(3)
+	join := func(groups ...[]database.ParkingSession) []database.ParkingSession {
+		var out []database.ParkingSession
+		for _, g := range groups {
+			out = append(out, g...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		sessions []database.ParkingSession
+		policy   func(p *Policy)
+		score    int
+		counts   []map[string]int // a subset of each finding's counts
+		evidence [][]database.RiskEvidence
+	}{
+		{name: "nothing unusual", sessions: join(varied(25), []database.ParkingSession{recent})},
+		{name: "too few closed sessions to judge", sessions: lasting(19, 37)},
+		{
+			name:     "identical durations",
+			sessions: join(cluster, varied(15)),
+			score:    20,
+			counts:   []map[string]int{{"sessions": 20, "clusterSize": 5, "durationMinutes": 37}},
+			evidence: [][]database.RiskEvidence{sessionEvidence(cluster)},
+		},
+		{name: "identical durations below clusterShare", sessions: join(lasting(4, 37), varied(16))},
+		{
+			name:     "exits bunched before a handover",
+			sessions: join(bunched, varied(17)),
+			score:    20,
+			counts:   []map[string]int{{"sessions": 20, "exitsBeforeHandover": 3, "expected": 0, "handoverMinutes": 15}},
+			evidence: [][]database.RiskEvidence{sessionEvidence(bunched)},
+		},
+		{
+			name:     "closed at the billing unit",
+			sessions: join(billed, varied(12)),
+			score:    20,
+			counts:   []map[string]int{{"sessions": 20, "minimumUnitSessions": 8, "billingUnitMinutes": 60}},
+			evidence: [][]database.RiskEvidence{sessionEvidence(billed)},
+		},
+		{
+			name:     "a pattern with no points is left out",
+			sessions: join(billed, varied(12)),
+			policy:   func(p *Policy) { p.ExitAnomalies.BillingPoints = 0 },
+		},
+		{
+			name:     "long stays without exit, however few sessions closed",
+			sessions: join(stuck, []database.ParkingSession{recent}, varied(3)),
+			score:    15,
+			counts:   []map[string]int{{"longStays": 3, "longStayHours": 24}},
+			evidence: [][]database.RiskEvidence{sessionEvidence(stuck)},
+		},
+		{
+			name:     "several patterns add up",
+			sessions: join(stuck, cluster, billed, varied(7)),
+			score:    55,
+			counts: []map[string]int{
+				{"longStays": 3},
+				{"clusterSize": 5, "sessions": 20},
+				{"minimumUnitSessions": 8, "sessions": 20},
+			},
+			evidence: [][]database.RiskEvidence{sessionEvidence(stuck), sessionEvidence(cluster), sessionEvidence(billed)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultPolicy()
+			if tt.policy != nil {
+				tt.policy(p)
+			}
+			res, err := ExitAnomalyRule{Sessions: fakeSessions(tt.sessions)}.Evaluate(context.Background(), lot, w, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Score != tt.score {
+				t.Fatalf("score = %d, want %d (%+v)", res.Score, tt.score, res.Findings)
+			}
+			if len(res.Findings) != len(tt.counts) {
+				t.Fatalf("got %d findings, want %d: %+v", len(res.Findings), len(tt.counts), res.Findings)
+			}
+			for i, f := range res.Findings {
+				for k, v := range tt.counts[i] {
+					if got, ok := f.Counts[k]; !ok || got != v {
+						t.Errorf("finding %d counts[%s] = %d (set %v), want %d", i, k, got, ok, v)
+					}
+				}
+				if !reflect.DeepEqual(f.Evidence, tt.evidence[i]) {
+					t.Errorf("finding %d evidence = %+v, want %+v", i, f.Evidence, tt.evidence[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Rule 5: Peak-hour Entry Suppression
+// Compares the last day's peak-hour entries with their baseline for the
+// hour of the week, for the lot itself and for the other lots in its area.
+// Entries dropping while the area holds steady means they're going
+// somewhere other than the app.
+type PeakSuppressionRule struct {
+	Entries   CountSource
+	Lots      LotSource
+	Sessions  SessionSource // for evidence, once the rule fires
+	Baselines *Baselines
+}
+
+func (PeakSuppressionRule) Name() string { return "peak-suppression" }
+
+// peakComparison is one lot's observed and expected peak-hour entries
+type peakComparison struct {
+	observed, expected map[time.Time]float64
+	totalObs, totalExp float64
+}
+
+func (r PeakSuppressionRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.PeakSuppression
+
+	hours := p.PeakHourStarts(w.End.Add(-24*time.Hour), w.End)
+	if len(hours) == 0 {
+		return Result{}, nil
+	}
+
+	peers := []database.ParkingLot{lot}
+	if lot.Area != "" {
+		areaLots, err := r.Lots.LotsInArea(ctx, lot.Area)
+		if err != nil {
+			return Result{}, err
+		}
+		for _, l := range areaLots {
+			if l.ID != lot.ID {
+				peers = append(peers, l)
+			}
+		}
+	}
+	lotIDs := make([]bson.ObjectID, len(peers))
+	for i, l := range peers {
+		lotIDs[i] = l.ID
+	}
+
+	entries, err := r.Entries.HourlyCounts(ctx, MetricEntries, lotIDs, hours[0], w.End, p.Location())
+	if err != nil {
+		return Result{}, err
+	}
+
+	compare := func(l database.ParkingLot) (peakComparison, error) {
+		c := peakComparison{observed: map[time.Time]float64{}, expected: map[time.Time]float64{}}
+		exps, err := r.Baselines.ExpectHours(ctx, l, MetricEntries, hours, w.End, p)
+		if err != nil {
+			return c, err
+		}
+		byHour := entries[l.ID]
+		for i, h := range hours {
+			exp := exps[i]
+			if !exp.Known() || exp.Mean < cfg.MinBaseline {
+				continue
+			}
+			obs := float64(byHour[h.UTC()])
+			c.observed[h], c.expected[h] = obs, exp.Mean
+			c.totalObs += obs
+			c.totalExp += exp.Mean
+		}
+		return c, nil
+	}
+
+	own, err := compare(lot)
+	if err != nil {
+		return Result{}, err
+	}
+	var findings []Finding
+	score := 0
+
+	// Against the lot's own baseline
+	var suppressed []time.Time
+	for h, exp := range own.expected {
+		if own.observed[h] < exp*cfg.MaxRatio {
+			suppressed = append(suppressed, h)
+		}
+	}
+	sort.Slice(suppressed, func(i, j int) bool { return suppressed[i].Before(suppressed[j]) })
+
+	log.Printf("Lot %s: %d of %d peak hours below baseline (R5)", id, len(suppressed), len(own.expected))
+
+	if len(suppressed) >= cfg.MinHours {
+		counts := map[string]int{
+			"hoursChecked":    len(own.expected),
+			"suppressedHours": len(suppressed),
+			"observedEntries": int(own.totalObs),
+			"expectedEntries": int(own.totalExp + 0.5),
+		}
+		var parts []string
+		for _, h := range suppressed {
+			label := h.In(p.Location()).Format("Mon 15:04")
+			counts["observed@"+label] = int(own.observed[h])
+			counts["expected@"+label] = int(own.expected[h] + 0.5)
+			parts = append(parts, fmt.Sprintf("%s %d vs ~%.1f", label, int(own.observed[h]), own.expected[h]))
+		}
+		msg := fmt.Sprintf("R5: Peak-hour entries far below this lot's baseline (%s)", strings.Join(parts, ", "))
+		refs, err := r.entryEvidence(ctx, id, suppressed, w.End, p.Location())
+		if err != nil {
+			return Result{}, err
+		}
+		findings = append(findings, Finding{Points: cfg.Points, Message: msg, Counts: counts, Evidence: refs})
+		score += cfg.Points
+	}
+
+	// Against the area: own ratio vs the median of the other lots' ratios
+	if own.totalExp > 0 {
+		var ratios []float64
+		for _, l := range peers[1:] {
+			c, err := compare(l)
+			if err != nil {
+				return Result{}, err
+			}
+			if c.totalExp > 0 {
+				ratios = append(ratios, c.totalObs/c.totalExp)
+			}
+		}
+		if len(ratios) >= cfg.MinPeers {
+			sort.Float64s(ratios)
+			median := ratios[len(ratios)/2]
+			ratio := own.totalObs / own.totalExp
+			if ratio < median*cfg.PeerMaxRatio {
+				msg := fmt.Sprintf("R5: Peak-hour entries at %.0f%% of baseline while %s peers are at %.0f%%", ratio*100, lot.Area, median*100)
+				counts := map[string]int{
+					"ratioPercent":           int(ratio * 100),
+					"peerMedianRatioPercent": int(median * 100),
+					"peers":                  len(ratios),
+					"observedEntries":        int(own.totalObs),
+					"expectedEntries":        int(own.totalExp + 0.5),
+				}
+				checked := make([]time.Time, 0, len(own.expected))
+				for h := range own.expected {
+					checked = append(checked, h)
+				}
+				refs, err := r.entryEvidence(ctx, id, checked, w.End, p.Location())
+				if err != nil {
+					return Result{}, err
+				}
+				findings = append(findings, Finding{Points: cfg.PeerPoints, Message: msg, Counts: counts, Evidence: refs})
+				score += cfg.PeerPoints
+			}
+		}
+	}
+
+	return Result{Score: score, Findings: findings}, nil
+}
+
+// entryEvidence lists the sessions that entered in the given hours, i.e.
+// the entries that were recorded when too few were
+func (r PeakSuppressionRule) entryEvidence(ctx context.Context, lotID string, hours []time.Time, end time.Time, loc *time.Location) ([]database.RiskEvidence, error) {
+	if len(hours) == 0 {
+		return nil, nil
+	}
+	inHour := make(map[int64]bool, len(hours))
+	from := hours[0]
+	for _, h := range hours {
+		inHour[h.Unix()] = true
+		if h.Before(from) {
+			from = h
+		}
+	}
+	sessions, err := r.Sessions.SessionsOverlapping(ctx, lotID, from, end)
+	if err != nil {
+		return nil, err
+	}
+	var refs []database.RiskEvidence
+	for _, s := range sessions {
+		local := s.EntryTime.In(loc)
+		hour := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), 0, 0, 0, loc)
+		if inHour[hour.Unix()] {
+			refs = appendEvidence(refs, evidence("session", s.ID.Hex()))
+		}
+	}
+	return refs, nil
+}
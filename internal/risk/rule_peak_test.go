@@ -0,0 +1,219 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestPeakSuppressionRule(t *testing.T) {
+	p := DefaultPolicy()
+	loc := p.Location()
+	day := time.Date(2026, 3, 14, 0, 0, 0, 0, loc) // a Saturday
+	peakStart, end := day.Add(10*time.Hour), day.Add(21*time.Hour)
+	w := Window{Start: end.Add(-24 * time.Hour), End: end}
+
+	lot := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 40}
+	b := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 40}
+	c := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 40}
+	d := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 40}
+	peers := []database.ParkingLot{b, c, d}
+	all := []database.ParkingLot{lot, b, c, d}
+
+	// Entries into the lot during today's peak, and one into a peer
+	at10 := session(lot.ID, day.Add(10*time.Hour+15*time.Minute), day.Add(12*time.Hour))
+	at11 := session(lot.ID, day.Add(11*time.Hour+30*time.Minute), time.Time{})
+	at15 := session(lot.ID, day.Add(15*time.Hour+5*time.Minute), day.Add(16*time.Hour))
+	peer10 := session(b.ID, day.Add(10*time.Hour+20*time.Minute), time.Time{})
+	sessions := fakeSessions{at10, at11, at15, peer10}
+	refs := func(ss ...database.ParkingSession) []database.RiskEvidence {
+		var out []database.RiskEvidence
+		for _, s := range ss {
+			out = append(out, evidence("session", s.ID.Hex()))
+		}
+		return out
+	}
+
+	// usual gives l n entries an hour over the baseline weeks, and today
+	// fills l's peak hours with entries(hour)
+	type counts map[bson.ObjectID]map[time.Time]int
+	usual := func(m counts, l database.ParkingLot, n int) {
+		m[l.ID] = make(map[time.Time]int)
+		for h := peakStart.AddDate(0, 0, -7*(p.Baselines.Weeks+1)); h.Before(peakStart); h = h.Add(time.Hour) {
+			m[l.ID][h.UTC()] = n
+		}
+	}
+	today := func(m counts, l database.ParkingLot, entries func(hour int) int) {
+		for h := peakStart; h.Before(day.Add(20 * time.Hour)); h = h.Add(time.Hour) {
+			m[l.ID][h.UTC()] = entries(h.Hour())
+		}
+	}
+	flat := func(n int) func(int) int { return func(int) int { return n } }
+
+	tests := []struct {
+		name     string
+		data     func(m counts)
+		score    int
+		counts   []map[string]int // a subset of each finding's counts
+		evidence [][]database.RiskEvidence
+	}{
+		{
+			name: "as usual",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 10)
+					today(m, l, flat(10))
+				}
+			},
+		},
+		{
+			name: "one hour suppressed",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 10)
+					today(m, l, flat(10))
+				}
+				today(m, lot, func(h int) int {
+					if h == 10 {
+						return 2
+					}
+					return 10
+				})
+			},
+		},
+		{
+			name: "two hours suppressed",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 10)
+					today(m, l, flat(10))
+				}
+				today(m, lot, func(h int) int {
+					if h < 12 {
+						return 2
+					}
+					return 10
+				})
+			},
+			score: 40,
+			counts: []map[string]int{{
+				"hoursChecked": 10, "suppressedHours": 2, "observedEntries": 84, "expectedEntries": 100,
+				"observed@Sat 10:00": 2, "expected@Sat 10:00": 10, "observed@Sat 11:00": 2,
+			}},
+			evidence: [][]database.RiskEvidence{refs(at10, at11)},
+		},
+		{
+			name: "thin baselines aren't judged",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 3)
+					today(m, l, flat(3))
+				}
+				today(m, lot, flat(0))
+			},
+		},
+		{
+			name: "the whole area is quiet",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 10)
+					today(m, l, flat(3))
+				}
+			},
+			score:    40,
+			counts:   []map[string]int{{"hoursChecked": 10, "suppressedHours": 10, "observedEntries": 30}},
+			evidence: [][]database.RiskEvidence{refs(at10, at11, at15)},
+		},
+		{
+			name: "below the area's peers",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 10)
+					today(m, l, flat(10))
+				}
+				today(m, lot, flat(5))
+			},
+			score:    25,
+			counts:   []map[string]int{{"ratioPercent": 50, "peerMedianRatioPercent": 100, "peers": 3, "observedEntries": 50, "expectedEntries": 100}},
+			evidence: [][]database.RiskEvidence{refs(at10, at11, at15)},
+		},
+		{
+			name: "too few peers with a baseline",
+			data: func(m counts) {
+				usual(m, lot, 10)
+				today(m, lot, flat(5))
+				usual(m, b, 10)
+				today(m, b, flat(10))
+			},
+		},
+		{
+			name: "suppressed and below the area",
+			data: func(m counts) {
+				for _, l := range all {
+					usual(m, l, 10)
+					today(m, l, flat(10))
+				}
+				today(m, lot, flat(2))
+			},
+			score: 65,
+			counts: []map[string]int{
+				{"suppressedHours": 10, "observedEntries": 20},
+				{"ratioPercent": 20, "peers": 3},
+			},
+			evidence: [][]database.RiskEvidence{refs(at10, at11, at15), refs(at10, at11, at15)},
+		},
+		{
+			name: "a new lot is judged by its area's history",
+			data: func(m counts) {
+				for _, l := range peers {
+					usual(m, l, 10)
+					today(m, l, flat(10))
+				}
+			},
+			score: 65,
+			counts: []map[string]int{
+				{"hoursChecked": 10, "suppressedHours": 10, "observedEntries": 0, "expectedEntries": 100},
+				{"ratioPercent": 0, "peerMedianRatioPercent": 100},
+			},
+			evidence: [][]database.RiskEvidence{refs(at10, at11, at15), refs(at10, at11, at15)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := make(counts)
+			tt.data(m)
+			entries := &fakeCounts{byLot: m}
+			r := PeakSuppressionRule{
+				Entries:   entries,
+				Lots:      fakeLots(all),
+				Sessions:  sessions,
+				Baselines: &Baselines{Counts: entries, Lots: fakeLots(all)},
+			}
+
+			res, err := r.Evaluate(context.Background(), lot, w, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Score != tt.score {
+				t.Fatalf("score = %d, want %d (%+v)", res.Score, tt.score, res.Findings)
+			}
+			if len(res.Findings) != len(tt.counts) {
+				t.Fatalf("got %d findings, want %d: %+v", len(res.Findings), len(tt.counts), res.Findings)
+			}
+			for i, f := range res.Findings {
+				for k, v := range tt.counts[i] {
+					if got, ok := f.Counts[k]; !ok || got != v {
+						t.Errorf("finding %d counts[%s] = %d (set %v), want %d", i, k, got, ok, v)
+					}
+				}
+				if !reflect.DeepEqual(f.Evidence, tt.evidence[i]) {
+					t.Errorf("finding %d evidence = %+v, want %+v", i, f.Evidence, tt.evidence[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Rule 7: Peer Comparison
+// Lots in the same area see roughly the same demand, so per-slot usage,
+// tickets and revenue far below the area's median (or reports far above
+// it) are worth a look. Each outlying metric is its own finding.
+type PeerComparisonRule struct {
+	Totals TotalSource
+	Lots   LotSource
+
+	// The lot's own records behind an outlying metric, for evidence
+	Sessions SessionSource
+	Tickets  TicketSource
+	Reports  ReportSource
+}
+
+func (PeerComparisonRule) Name() string { return "peer-comparison" }
+
+// peerMetrics are compared per 100 slots per day; highIsBad flips the
+// direction for metrics where more is worse
+var peerMetrics = []struct {
+	metric    string
+	label     string
+	highIsBad bool
+}{
+	{MetricEntries, "entries", false},
+	{MetricTickets, "tickets", false},
+	{MetricRevenue, "revenue", false},
+	{MetricReports, "citizen reports", true},
+}
+
+func (r PeerComparisonRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.PeerComparison
+	if lot.Area == "" || lot.Capacity <= 0 {
+		return Result{}, nil
+	}
+
+	areaLots, err := r.Lots.LotsInArea(ctx, lot.Area)
+	if err != nil {
+		return Result{}, err
+	}
+	var peers []database.ParkingLot
+	for _, l := range areaLots {
+		if l.ID != lot.ID && l.Capacity > 0 {
+			peers = append(peers, l)
+		}
+	}
+	if len(peers) < cfg.MinPeers {
+		return Result{}, nil
+	}
+	ids := []bson.ObjectID{lot.ID}
+	for _, l := range peers {
+		ids = append(ids, l.ID)
+	}
+
+	from := w.End.AddDate(0, 0, -cfg.Days)
+	// per 100 slots per day
+	normalise := func(total float64, l database.ParkingLot) float64 {
+		return total / float64(l.Capacity) * 100 / float64(cfg.Days)
+	}
+
+	var res Result
+	for _, m := range peerMetrics {
+		totals, err := r.Totals.LotTotals(ctx, m.metric, ids, from, w.End)
+		if err != nil {
+			return Result{}, err
+		}
+
+		rates := make([]float64, len(peers))
+		for i, l := range peers {
+			rates[i] = normalise(totals[l.ID], l)
+		}
+		sort.Float64s(rates)
+		median := rates[len(rates)/2]
+		own := normalise(totals[lot.ID], lot)
+
+		var outlier bool
+		if m.highIsBad {
+			outlier = totals[lot.ID] >= float64(cfg.MinReports) && own > median*cfg.Factor
+		} else {
+			outlier = median > 0 && own*cfg.Factor < median
+		}
+		if !outlier {
+			continue
+		}
+
+		direction := "below"
+		if m.highIsBad {
+			direction = "above"
+		}
+		msg := fmt.Sprintf("R7: %s per 100 slots/day %.1f, far %s the %s median of %.1f across %d lots",
+			m.label, own, direction, lot.Area, median, len(peers))
+		counts := map[string]int{
+			"lotPer100SlotsPerDay":        int(own + 0.5),
+			"peerMedianPer100SlotsPerDay": int(median + 0.5),
+			"lotTotal":                    int(totals[lot.ID] + 0.5),
+			"peers":                       len(peers),
+			"days":                        cfg.Days,
+		}
+		refs, err := r.recordEvidence(ctx, m.metric, id, from, w.End)
+		if err != nil {
+			return Result{}, err
+		}
+		res.Score += cfg.Points
+		res.Findings = append(res.Findings, Finding{Points: cfg.Points, Message: msg, Counts: counts, Evidence: refs})
+	}
+
+	log.Printf("Lot %s: %d metrics out of line with %d %s peers (R7)", id, len(res.Findings), len(peers), lot.Area)
+	return res, nil
+}
+
+// recordEvidence lists the lot's records a metric was totalled from in [from, to)
+func (r PeerComparisonRule) recordEvidence(ctx context.Context, metric, lotID string, from, to time.Time) ([]database.RiskEvidence, error) {
+	var refs []database.RiskEvidence
+	switch metric {
+	case MetricEntries:
+		sessions, err := r.Sessions.SessionsOverlapping(ctx, lotID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sessions {
+			if !s.EntryTime.Before(from) {
+				refs = appendEvidence(refs, evidence("session", s.ID.Hex()))
+			}
+		}
+	case MetricTickets, MetricRevenue:
+		tickets, err := r.Tickets.TicketsLastWindow(ctx, lotID, to, to.Sub(from))
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tickets {
+			refs = appendEvidence(refs, evidence("ticket", t.ID.Hex()))
+		}
+	case MetricReports:
+		reports, err := r.Reports.ReportsLastWindow(ctx, lotID, to, to.Sub(from))
+		if err != nil {
+			return nil, err
+		}
+		for _, rep := range reports {
+			refs = appendEvidence(refs, evidence("report", rep.ID.Hex()))
+		}
+	}
+	return refs, nil
+}
@@ -0,0 +1,156 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestPeerComparisonRule(t *testing.T) {
+	p := DefaultPolicy()
+	end := time.Date(2026, 3, 14, 12, 0, 0, 0, p.Location())
+	from := end.AddDate(0, 0, -p.PeerComparison.Days)
+	w := Window{Start: end.Add(-24 * time.Hour), End: end}
+
+	lot := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 50}
+	b := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 100}
+	c := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 100}
+	unsized := database.ParkingLot{ID: bson.NewObjectID(), Area: "north"}
+	elsewhere := database.ParkingLot{ID: bson.NewObjectID(), Area: "south", Capacity: 100}
+	area := fakeLots{lot, b, c, unsized, elsewhere}
+
+	// The records behind the lot's totals, and some that aren't
+	entered := session(lot.ID, end.Add(-48*time.Hour), end.Add(-47*time.Hour))
+	stillIn := session(lot.ID, from.Add(-time.Hour), time.Time{}) // entered before the window
+	peerEntry := session(b.ID, end.Add(-48*time.Hour), time.Time{})
+	issued := ticket(lot.ID, end.Add(-24*time.Hour))
+	reported := report(lot.ID, bson.NewObjectID(), end.Add(-12*time.Hour))
+
+	// Per 100 slots a day the lot and its peers see 100 entries, 20
+	// tickets, 1000 in revenue and 2/7 of a report
+	usual := func() fakeTotals {
+		return fakeTotals{
+			MetricEntries: {lot.ID: 350, b.ID: 700, c.ID: 700, elsewhere.ID: 10},
+			MetricTickets: {lot.ID: 70, b.ID: 140, c.ID: 140},
+			MetricRevenue: {lot.ID: 3500, b.ID: 7000, c.ID: 7000},
+			MetricReports: {lot.ID: 1, b.ID: 2, c.ID: 2},
+		}
+	}
+	ev := func(kind string, ids ...bson.ObjectID) []database.RiskEvidence {
+		var out []database.RiskEvidence
+		for _, id := range ids {
+			out = append(out, evidence(kind, id.Hex()))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		lot      database.ParkingLot
+		lots     fakeLots
+		totals   func(f fakeTotals)
+		score    int
+		counts   []map[string]int // a subset of each finding's counts
+		evidence [][]database.RiskEvidence
+	}{
+		{name: "in line with the area"},
+		{
+			name:   "few entries",
+			totals: func(f fakeTotals) { f[MetricEntries][lot.ID] = 100 },
+			score:  15,
+			counts: []map[string]int{{
+				"lotPer100SlotsPerDay": 29, "peerMedianPer100SlotsPerDay": 100,
+				"lotTotal": 100, "peers": 2, "days": 7,
+			}},
+			evidence: [][]database.RiskEvidence{ev("session", entered.ID)},
+		},
+		{name: "entries low but within factor", totals: func(f fakeTotals) { f[MetricEntries][lot.ID] = 120 }},
+		{
+			name: "few tickets and little revenue",
+			totals: func(f fakeTotals) {
+				f[MetricTickets][lot.ID] = 10
+				f[MetricRevenue][lot.ID] = 500
+			},
+			score: 30,
+			counts: []map[string]int{
+				{"lotPer100SlotsPerDay": 3, "peerMedianPer100SlotsPerDay": 20, "lotTotal": 10},
+				{"lotPer100SlotsPerDay": 143, "peerMedianPer100SlotsPerDay": 1000, "lotTotal": 500},
+			},
+			evidence: [][]database.RiskEvidence{ev("ticket", issued.ID), ev("ticket", issued.ID)},
+		},
+		{
+			name:     "many reports",
+			totals:   func(f fakeTotals) { f[MetricReports][lot.ID] = 6 },
+			score:    15,
+			counts:   []map[string]int{{"lotTotal": 6, "lotPer100SlotsPerDay": 2, "peerMedianPer100SlotsPerDay": 0}},
+			evidence: [][]database.RiskEvidence{ev("report", reported.ID)},
+		},
+		{
+			name: "too few reports to be an outlier",
+			totals: func(f fakeTotals) {
+				f[MetricReports] = map[bson.ObjectID]float64{lot.ID: 2}
+			},
+		},
+		{
+			name:   "no peer activity to compare with",
+			totals: func(f fakeTotals) { f[MetricEntries] = map[bson.ObjectID]float64{} },
+		},
+		{
+			name:   "too few peers with capacity",
+			lots:   fakeLots{lot, b, unsized, elsewhere},
+			totals: func(f fakeTotals) { f[MetricEntries][lot.ID] = 0 },
+		},
+		{
+			name:   "no area",
+			lot:    database.ParkingLot{ID: lot.ID, Capacity: 50},
+			totals: func(f fakeTotals) { f[MetricEntries][lot.ID] = 0 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totals := usual()
+			if tt.totals != nil {
+				tt.totals(totals)
+			}
+			lots, judged := area, lot
+			if tt.lots != nil {
+				lots = tt.lots
+			}
+			if !tt.lot.ID.IsZero() {
+				judged = tt.lot
+			}
+			r := PeerComparisonRule{
+				Totals:   totals,
+				Lots:     lots,
+				Sessions: fakeSessions{entered, stillIn, peerEntry},
+				Tickets:  fakeTickets{issued},
+				Reports:  fakeReports{reported},
+			}
+
+			res, err := r.Evaluate(context.Background(), judged, w, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Score != tt.score {
+				t.Fatalf("score = %d, want %d (%+v)", res.Score, tt.score, res.Findings)
+			}
+			if len(res.Findings) != len(tt.counts) {
+				t.Fatalf("got %d findings, want %d: %+v", len(res.Findings), len(tt.counts), res.Findings)
+			}
+			for i, f := range res.Findings {
+				for k, v := range tt.counts[i] {
+					if got, ok := f.Counts[k]; !ok || got != v {
+						t.Errorf("finding %d counts[%s] = %d (set %v), want %d", i, k, got, ok, v)
+					}
+				}
+				if !reflect.DeepEqual(f.Evidence, tt.evidence[i]) {
+					t.Errorf("finding %d evidence = %+v, want %+v", i, f.Evidence, tt.evidence[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Rule 4: Occupancy Plateau
+// Digital occupancy that flattens out well below capacity at peak hours,
+// day after day, suggests entries are being capped and the rest taken in
+// cash off the books
+type OccupancyPlateauRule struct {
+	Sessions SessionSource
+}
+
+func (OccupancyPlateauRule) Name() string { return "occupancy-plateau" }
+
+func (r OccupancyPlateauRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.OccupancyPlateau
+	if lot.Capacity <= 0 {
+		return Result{}, nil
+	}
+
+	from := w.End.AddDate(0, 0, -cfg.Days)
+	sessions, err := r.Sessions.SessionsOverlapping(ctx, id, from.Add(-staleSessionAge), w.End)
+	if err != nil {
+		return Result{}, err
+	}
+
+	step := time.Duration(cfg.SampleMinutes) * time.Minute
+	minSamples := cfg.MinPlateauMinutes / cfg.SampleMinutes
+	ceiling := int(float64(lot.Capacity) * cfg.MaxFill)
+
+	days := 0
+	var levels []int
+	var plateaus []Window
+	longest := 0
+	for _, peak := range p.PeakWindows(from, w.End) {
+		samples := occupancySamples(sessions, peak, step)
+		if len(samples) < minSamples {
+			continue
+		}
+		days++
+
+		// An empty lot is flat too, but that's not capping
+		start, length, level := longestPlateau(samples, cfg.Tolerance)
+		if length >= minSamples && level > 0 && level+cfg.Tolerance <= ceiling {
+			levels = append(levels, level)
+			longest = max(longest, length*cfg.SampleMinutes)
+			plateauStart := peak.Start.Add(time.Duration(start) * step)
+			plateaus = append(plateaus, Window{Start: plateauStart, End: plateauStart.Add(time.Duration(length) * step)})
+		}
+	}
+
+	log.Printf("Lot %s: Occupancy plateau on %d of %d peak periods (R4)", id, len(levels), days)
+
+	if len(levels) < cfg.MinDays {
+		return Result{}, nil
+	}
+
+	sort.Ints(levels)
+	median := levels[len(levels)/2]
+	msg := fmt.Sprintf("R4: Occupancy plateau around %d/%d at peak hours on %d of the last %d days", median, lot.Capacity, len(levels), days)
+	counts := map[string]int{
+		"plateauDays":           len(levels),
+		"daysChecked":           days,
+		"medianPlateauLevel":    median,
+		"capacity":              lot.Capacity,
+		"longestPlateauMinutes": longest,
+		"sessions":              len(sessions),
+	}
+	// The sessions let in while occupancy sat flat
+	var refs []database.RiskEvidence
+	for _, s := range sessions {
+		for _, pw := range plateaus {
+			if !s.EntryTime.Before(pw.Start) && s.EntryTime.Before(pw.End) {
+				refs = appendEvidence(refs, evidence("session", s.ID.Hex()))
+				break
+			}
+		}
+	}
+	return Result{Score: cfg.Points, Findings: []Finding{{Points: cfg.Points, Message: msg, Counts: counts, Evidence: refs}}}, nil
+}
@@ -0,0 +1,67 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Rule 3: Ignored Queries
+type IgnoredQueriesRule struct {
+	Queries QuerySource
+}
+
+func (IgnoredQueriesRule) Name() string { return "ignored-queries" }
+
+func (r IgnoredQueriesRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.IgnoredQueries
+	idle := time.Duration(cfg.IdleMinutes) * time.Minute
+	queries, err := r.Queries.QueriesForLot(ctx, id)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ignoredCount, openCount, askedCount, ignoredChecks := 0, 0, 0, 0
+	var ignored []database.RiskEvidence
+	for _, q := range queries {
+		// Judge each query as it stood at w.End: not sent yet, or open
+		// because the reply came later
+		if q.Time.After(w.End) {
+			continue
+		}
+		askedCount++
+		open := q.Status == database.QueryStatusOpen || q.RepliedAt.After(w.End)
+		if open {
+			openCount++
+		}
+		// Check if status is OPEN and created more than the idle limit ago
+		if open && w.End.Sub(q.Time) > idle {
+			ignoredCount++
+			if q.Type == verificationQueryType {
+				ignoredChecks++
+			}
+			ignored = appendEvidence(ignored, evidence("query", q.ID))
+		}
+	}
+
+	if ignoredCount > 0 {
+		// Log the finding
+		log.Printf("Lot %s: Found %d ignored queries (>%dm)", id, ignoredCount, cfg.IdleMinutes)
+		// If even one query is ignored past the idle limit, it's a risk.
+		// Flat penalty, similar to the other rules.
+		msg := fmt.Sprintf("R3: Attendant ignoring queries (>%dm idle)", cfg.IdleMinutes)
+		counts := map[string]int{
+			"queries":        askedCount,
+			"openQueries":    openCount,
+			"ignoredQueries": ignoredCount,
+			"ignoredChecks":  ignoredChecks, // verification queries the engine sent
+			"idleMinutes":    cfg.IdleMinutes,
+		}
+		return Result{Score: cfg.Points, Findings: []Finding{{Points: cfg.Points, Message: msg, Counts: counts, Evidence: ignored}}}, nil
+	}
+
+	return Result{}, nil
+}
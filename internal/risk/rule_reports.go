@@ -0,0 +1,93 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Rule 1: Citizen Report Density
+// Unique reports over the window, against fixed minimums and, once the lot
+// or its area has a history of reports, against what's usual for the hours
+// covered. A lot that's always reported a lot isn't news.
+type ReportDensityRule struct {
+	Reports   ReportSource
+	Baselines *Baselines // nil judges by the fixed counts alone
+}
+
+func (ReportDensityRule) Name() string { return "report-density" }
+
+func (r ReportDensityRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.ReportDensity
+	window := time.Duration(cfg.WindowHours) * time.Hour
+	reports, err := r.Reports.ReportsLastWindow(ctx, id, w.End, window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Track the last counted report time for each user, so one user can
+	// only count once per 24h
+	userLastCounted := make(map[string]time.Time)
+	count := 0
+	var counted []database.RiskEvidence
+
+	for _, rep := range reports {
+		uid := rep.UserID.Hex()
+
+		// If UserID is not set, maybe count as distinct?
+		// For now we skip or tracking as "anonymous" rate limited together.
+		if rep.UserID.IsZero() {
+			uid = "anonymous"
+		}
+
+		lastTime, seen := userLastCounted[uid]
+
+		// If never seen, or if this report is more than 24h after the last COUNTED report
+		if !seen || rep.CreatedAt.Sub(lastTime) >= 24*time.Hour {
+			count++
+			userLastCounted[uid] = rep.CreatedAt
+			counted = appendEvidence(counted, evidence("report", rep.ID.Hex()))
+		}
+	}
+
+	log.Printf("Lot %s: Found %d raw reports, %d valid reports after deduplication (R1)", id, len(reports), count)
+
+	counts := map[string]int{
+		"reports":       len(reports),
+		"uniqueReports": count,
+		"windowHours":   cfg.WindowHours,
+	}
+
+	// The baseline counts every report, so judging unique ones against it
+	// errs towards not firing
+	var exp Expectation
+	if r.Baselines != nil {
+		if exp, err = r.Baselines.ExpectWindow(ctx, lot, MetricReports, w.End.Add(-window), w.End, p); err != nil {
+			return Result{}, err
+		}
+	}
+	zScore := math.Inf(1) // with no baseline only the counts decide
+	usual := ""
+	if exp.Known() {
+		zScore = exp.Z(float64(count))
+		counts["expectedReports"] = int(math.Round(exp.Mean))
+		counts["zScoreHundredths"] = int(math.Round(zScore * 100))
+		usual = fmt.Sprintf("; ~%.1f expected from %s history, z=%.1f", exp.Mean, exp.Source, zScore)
+	}
+
+	if count >= cfg.HighCount && zScore >= cfg.HighZ {
+		msg := fmt.Sprintf("R1: High density of citizen reports (>=%d unique in %dh%s)", cfg.HighCount, cfg.WindowHours, usual)
+		counts["threshold"] = cfg.HighCount
+		return Result{Score: cfg.HighPoints, Findings: []Finding{{Points: cfg.HighPoints, Message: msg, Counts: counts, Evidence: counted}}}, nil
+	}
+	if count >= cfg.MediumCount && zScore >= cfg.MediumZ {
+		msg := fmt.Sprintf("R1: Medium density of citizen reports (>=%d unique in %dh%s)", cfg.MediumCount, cfg.WindowHours, usual)
+		counts["threshold"] = cfg.MediumCount
+		return Result{Score: cfg.MediumPoints, Findings: []Finding{{Points: cfg.MediumPoints, Message: msg, Counts: counts, Evidence: counted}}}, nil
+	}
+	return Result{}, nil
+}
@@ -0,0 +1,151 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestReportDensityRule(t *testing.T) {
+	p := DefaultPolicy()
+	loc := p.Location()
+	end := time.Date(2026, 3, 14, 12, 0, 0, 0, loc)
+	w := Window{Start: end.Add(-24 * time.Hour), End: end}
+	lot := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 40}
+
+	// byUsers has n different users report the lot an hour apart
+	byUsers := func(n int) []database.Report {
+		var out []database.Report
+		for i := range n {
+			out = append(out, report(lot.ID, bson.NewObjectID(), end.Add(-time.Duration(n-i)*time.Hour)))
+		}
+		return out
+	}
+	refs := func(rs ...database.Report) []database.RiskEvidence {
+		var out []database.RiskEvidence
+		for _, r := range rs {
+			out = append(out, evidence("report", r.ID.Hex()))
+		}
+		return out
+	}
+
+	// A user's reports count once per 24h, from the last one counted
+	regular := bson.NewObjectID()
+	first := report(lot.ID, regular, end.Add(-40*time.Hour))
+	again := report(lot.ID, regular, end.Add(-30*time.Hour))
+	later := report(lot.ID, regular, end.Add(-10*time.Hour))
+	others := byUsers(2)
+	repeats := append([]database.Report{first, again, later}, others...)
+
+	anon := []database.Report{
+		report(lot.ID, bson.ObjectID{}, end.Add(-20*time.Hour)),
+		report(lot.ID, bson.ObjectID{}, end.Add(-10*time.Hour)),
+		report(lot.ID, bson.ObjectID{}, end.Add(-5*time.Hour)),
+	}
+	stale := report(lot.ID, bson.NewObjectID(), end.Add(-50*time.Hour))
+	three, five, six, seven := byUsers(3), byUsers(5), byUsers(6), byUsers(7)
+
+	tests := []struct {
+		name     string
+		reports  []database.Report
+		history  bool // the lot usually gets 4 reports in 48h
+		score    int
+		counts   map[string]int // a subset of the finding's counts
+		evidence []database.RiskEvidence
+	}{
+		{name: "no reports"},
+		{name: "below mediumCount", reports: byUsers(2)},
+		{name: "reports before the window", reports: append([]database.Report{stale}, byUsers(2)...)},
+		{
+			name:     "medium",
+			reports:  three,
+			score:    30,
+			counts:   map[string]int{"reports": 3, "uniqueReports": 3, "threshold": 3, "windowHours": 48},
+			evidence: refs(three...),
+		},
+		{
+			name:     "high",
+			reports:  five,
+			score:    50,
+			counts:   map[string]int{"reports": 5, "uniqueReports": 5, "threshold": 5},
+			evidence: refs(five...),
+		},
+		{
+			name:     "a user's repeat within 24h counts once",
+			reports:  repeats,
+			score:    30,
+			counts:   map[string]int{"reports": 5, "uniqueReports": 4, "threshold": 3},
+			evidence: refs(append([]database.Report{first, later}, others...)...),
+		},
+		{name: "anonymous reports count as one user", reports: append(anon, byUsers(1)...)},
+		{name: "usual for the lot", reports: five, history: true},
+		{
+			name:     "medium against the lot's history",
+			reports:  six,
+			history:  true,
+			score:    30,
+			counts:   map[string]int{"uniqueReports": 6, "expectedReports": 4, "zScoreHundredths": 200, "threshold": 3},
+			evidence: refs(six...),
+		},
+		{
+			name:     "high against the lot's history",
+			reports:  seven,
+			history:  true,
+			score:    50,
+			counts:   map[string]int{"uniqueReports": 7, "expectedReports": 4, "zScoreHundredths": 300, "threshold": 5},
+			evidence: refs(seven...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ReportDensityRule{Reports: fakeReports(tt.reports)}
+			if tt.history {
+				// One report every 12 hours of the week, so any 48h holds 4
+				byHour := make(map[time.Time]int)
+				for h := end.AddDate(0, 0, -7*(p.Baselines.Weeks+1)); h.Before(end); h = h.Add(time.Hour) {
+					if HourOfWeek(h, loc)%12 == 0 {
+						byHour[h.UTC()] = 1
+					} else {
+						byHour[h.UTC()] = 0
+					}
+				}
+				r.Baselines = &Baselines{Counts: &fakeCounts{byLot: map[bson.ObjectID]map[time.Time]int{lot.ID: byHour}}}
+			}
+
+			res, err := r.Evaluate(context.Background(), lot, w, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Score != tt.score {
+				t.Fatalf("score = %d, want %d (%+v)", res.Score, tt.score, res.Findings)
+			}
+			if tt.score == 0 {
+				if len(res.Findings) != 0 {
+					t.Errorf("findings = %+v, want none", res.Findings)
+				}
+				return
+			}
+			if len(res.Findings) != 1 {
+				t.Fatalf("got %d findings, want 1", len(res.Findings))
+			}
+			f := res.Findings[0]
+			for k, v := range tt.counts {
+				if got, ok := f.Counts[k]; !ok || got != v {
+					t.Errorf("counts[%s] = %d (set %v), want %d", k, got, ok, v)
+				}
+			}
+			if !tt.history {
+				if _, ok := f.Counts["zScoreHundredths"]; ok {
+					t.Errorf("z-score reported without a baseline: %v", f.Counts)
+				}
+			}
+			if !reflect.DeepEqual(f.Evidence, tt.evidence) {
+				t.Errorf("evidence = %+v, want %+v", f.Evidence, tt.evidence)
+			}
+		})
+	}
+}
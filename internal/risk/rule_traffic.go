@@ -0,0 +1,99 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Rule 2: Traffic vs Ticket Mismatch
+// Congestion comes from Traffic, or the configured source when it's nil.
+// "Low" ticket activity is judged against the lot's baseline for the hour
+// of the week, or a fixed count when there's no baseline yet.
+type TrafficMismatchRule struct {
+	Tickets   TicketSource
+	Traffic   TrafficSource
+	Baselines *Baselines
+}
+
+func (TrafficMismatchRule) Name() string { return "traffic-mismatch" }
+
+func (r TrafficMismatchRule) Evaluate(ctx context.Context, lot database.ParkingLot, w Window, p *Policy) (Result, error) {
+	id := lot.ID.Hex()
+	cfg := p.TrafficMismatch
+
+	traffic := r.Traffic
+	if traffic == nil {
+		traffic = currentTrafficSource()
+	}
+	reading, ok, err := traffic.Latest(ctx, lot, w.End)
+	if err != nil {
+		return Result{}, fmt.Errorf("traffic source %s: %w", traffic.Name(), err)
+	}
+	// No reading, a stale one, or free-flowing traffic: nothing to compare
+	maxAge := time.Duration(cfg.MaxReadingAgeMinutes) * time.Minute
+	if !ok || w.End.Sub(reading.ObservedAt) > maxAge || reading.Congestion < cfg.CongestedAt {
+		return Result{}, nil
+	}
+	source := fmt.Sprintf("congestion %.2f from %s at %s", reading.Congestion, traffic.Name(), reading.ObservedAt.UTC().Format(time.RFC3339))
+
+	// Case 1: Low Ticket Count (short window)
+	short := time.Duration(cfg.ShortWindowMinutes) * time.Minute
+	tickets, err := r.Tickets.TicketsLastWindow(ctx, id, w.End, short)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ticketCount := len(tickets)
+	expectedTickets := cfg.ExpectedTickets // Threshold for "Low Ticket Count"
+	lowActivity := ticketCount < expectedTickets
+
+	counts := map[string]int{
+		"congestionPercent":  int(reading.Congestion * 100),
+		"tickets":            ticketCount,
+		"shortWindowMinutes": cfg.ShortWindowMinutes,
+	}
+
+	var exp Expectation
+	if r.Baselines != nil {
+		if exp, err = r.Baselines.Expect(ctx, lot, MetricTickets, w.End.Add(-short/2), w.End, p); err != nil {
+			return Result{}, err
+		}
+	}
+	if exp.Known() {
+		exp = exp.Scaled(short)
+		z := exp.Z(float64(ticketCount))
+		lowActivity = z <= cfg.LowTicketsZ
+		expectedTickets = int(math.Round(exp.Mean))
+		counts["zScoreHundredths"] = int(math.Round(z * 100))
+		counts["baselineWeeks"] = exp.Samples
+		source += fmt.Sprintf("; %d tickets vs ~%.1f expected from %s history, z=%.1f", ticketCount, exp.Mean, exp.Source, z)
+	}
+	counts["expectedTickets"] = expectedTickets
+	// Traffic readings aren't stored, so there's nothing to link to
+	refs := []database.RiskEvidence{{Kind: "traffic", ID: traffic.Name() + "@" + reading.ObservedAt.UTC().Format(time.RFC3339)}}
+	for _, t := range tickets {
+		refs = appendEvidence(refs, evidence("ticket", t.ID.Hex()))
+	}
+
+	if lowActivity {
+		// Refine Case 2: Ticketing Stalled (Zero tickets in the long window)
+		// We already checked the short one. If count is 0, let's check deeper.
+		if ticketCount == 0 {
+			longWindowTickets, err := r.Tickets.TicketsLastWindow(ctx, id, w.End, time.Duration(cfg.LongWindowMinutes)*time.Minute)
+			if err == nil && len(longWindowTickets) == 0 {
+				counts["longWindowTickets"] = 0
+				counts["longWindowMinutes"] = cfg.LongWindowMinutes
+				msg := "R2: Ticketing Stalled + Persistent Congestion (Potential off-app parking; " + source + ")"
+				return Result{Score: cfg.StalledPoints, Findings: []Finding{{Points: cfg.StalledPoints, Message: msg, Counts: counts, Evidence: refs}}}, nil
+			}
+		}
+
+		msg := "R2: Traffic congestion with low ticket activity (" + source + ")"
+		return Result{Score: cfg.LowActivityPoints, Findings: []Finding{{Points: cfg.LowActivityPoints, Message: msg, Counts: counts, Evidence: refs}}}, nil
+	}
+
+	return Result{}, nil
+}
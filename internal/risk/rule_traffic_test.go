@@ -0,0 +1,182 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestTrafficMismatchRule(t *testing.T) {
+	p := DefaultPolicy()
+	end := time.Date(2026, 3, 14, 12, 0, 0, 0, p.Location())
+	w := Window{Start: end.Add(-24 * time.Hour), End: end}
+	lot := database.ParkingLot{ID: bson.NewObjectID(), PID: "P-7", Area: "north", Capacity: 40}
+	// neighbour is twice lot's size, so its history scales to half for lot
+	neighbour := database.ParkingLot{ID: bson.NewObjectID(), Area: "north", Capacity: 80}
+	id := lot.ID.Hex()
+
+	fresh := end.Add(-10 * time.Minute)
+	jammed := TrafficReading{LotID: id, ObservedAt: fresh, Congestion: 0.9}
+	trafficRef := database.RiskEvidence{Kind: "traffic", ID: "fixture@" + fresh.UTC().Format(time.RFC3339)}
+
+	recent := []database.Ticket{ticket(lot.ID, end.Add(-20*time.Minute)), ticket(lot.ID, end.Add(-40*time.Minute))}
+	earlier := ticket(lot.ID, end.Add(-90*time.Minute))
+	var busy []database.Ticket
+	for i := range 6 {
+		busy = append(busy, ticket(lot.ID, end.Add(-time.Duration(5+i*5)*time.Minute)))
+	}
+	refs := func(ts ...database.Ticket) []database.RiskEvidence {
+		out := []database.RiskEvidence{trafficRef}
+		for _, t := range ts {
+			out = append(out, evidence("ticket", t.ID.Hex()))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		readings []TrafficReading
+		tickets  []database.Ticket
+		history  int  // tickets an hour over the baseline weeks; 0 leaves no baseline
+		area     bool // the history is neighbour's rather than lot's
+		score    int
+		counts   map[string]int // a subset of the finding's counts
+		evidence []database.RiskEvidence
+	}{
+		{name: "no reading"},
+		{
+			name:     "stale reading",
+			readings: []TrafficReading{{LotID: id, ObservedAt: end.Add(-45 * time.Minute), Congestion: 0.95}},
+		},
+		{
+			name:     "below congestedAt",
+			readings: []TrafficReading{{LotID: id, ObservedAt: fresh, Congestion: 0.6}},
+		},
+		{
+			name:     "newer free-flowing reading wins",
+			readings: []TrafficReading{jammed, {LotID: id, ObservedAt: end.Add(-time.Minute), Congestion: 0.2}},
+		},
+		{
+			name:     "stalled",
+			readings: []TrafficReading{jammed},
+			score:    60,
+			counts:   map[string]int{"congestionPercent": 90, "tickets": 0, "expectedTickets": 5, "longWindowTickets": 0, "longWindowMinutes": 120},
+			evidence: refs(),
+		},
+		{
+			name:     "stalled by the lot's PID",
+			readings: []TrafficReading{{LotID: "P-7", ObservedAt: fresh, Congestion: 0.9}},
+			score:    60,
+			evidence: refs(),
+		},
+		{
+			name:     "quiet hour after earlier tickets is low, not stalled",
+			readings: []TrafficReading{jammed},
+			tickets:  []database.Ticket{earlier},
+			score:    40,
+			counts:   map[string]int{"tickets": 0, "expectedTickets": 5},
+			evidence: refs(),
+		},
+		{
+			name:     "low activity",
+			readings: []TrafficReading{jammed},
+			tickets:  append([]database.Ticket{earlier}, recent...),
+			score:    40,
+			counts:   map[string]int{"tickets": 2, "expectedTickets": 5, "shortWindowMinutes": 60},
+			evidence: refs(recent...),
+		},
+		{
+			name:     "enough tickets",
+			readings: []TrafficReading{jammed},
+			tickets:  busy,
+		},
+		{
+			name:     "few tickets for a quiet lot",
+			readings: []TrafficReading{jammed},
+			tickets:  recent,
+			history:  2,
+		},
+		{
+			name:     "below a busy lot's baseline",
+			readings: []TrafficReading{jammed},
+			tickets:  busy,
+			history:  10,
+			score:    40,
+			counts:   map[string]int{"tickets": 6, "expectedTickets": 10, "zScoreHundredths": -400, "baselineWeeks": 8},
+			evidence: refs(busy...),
+		},
+		{
+			name:     "below the area's baseline for a new lot",
+			readings: []TrafficReading{jammed},
+			tickets:  busy,
+			history:  20,
+			area:     true,
+			score:    40,
+			counts:   map[string]int{"tickets": 6, "expectedTickets": 10, "zScoreHundredths": -400, "baselineWeeks": 8},
+			evidence: refs(busy...),
+		},
+		{
+			name:     "within a busy lot's baseline",
+			readings: []TrafficReading{jammed},
+			tickets:  append(append([]database.Ticket{ticket(lot.ID, end.Add(-50*time.Minute))}, busy...), recent...),
+			history:  10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := TrafficMismatchRule{Tickets: fakeTickets(tt.tickets), Traffic: NewFixtureTrafficSource(tt.readings...)}
+			if tt.history > 0 {
+				byHour := make(map[time.Time]int)
+				for h := end.AddDate(0, 0, -7*(p.Baselines.Weeks+1)); h.Before(end); h = h.Add(time.Hour) {
+					byHour[h.UTC()] = tt.history
+				}
+				owner := lot.ID
+				if tt.area {
+					owner = neighbour.ID
+				}
+				r.Baselines = &Baselines{
+					Counts: &fakeCounts{byLot: map[bson.ObjectID]map[time.Time]int{owner: byHour}},
+					Lots:   fakeLots{lot, neighbour},
+				}
+			}
+
+			res, err := r.Evaluate(context.Background(), lot, w, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Score != tt.score {
+				t.Fatalf("score = %d, want %d (%+v)", res.Score, tt.score, res.Findings)
+			}
+			if tt.score == 0 {
+				if len(res.Findings) != 0 {
+					t.Errorf("findings = %+v, want none", res.Findings)
+				}
+				return
+			}
+			if len(res.Findings) != 1 {
+				t.Fatalf("got %d findings, want 1", len(res.Findings))
+			}
+			f := res.Findings[0]
+			if f.Points != tt.score {
+				t.Errorf("points = %d, want %d", f.Points, tt.score)
+			}
+			for k, v := range tt.counts {
+				if got, ok := f.Counts[k]; !ok || got != v {
+					t.Errorf("counts[%s] = %d (set %v), want %d", k, got, ok, v)
+				}
+			}
+			if tt.history == 0 {
+				if _, ok := f.Counts["zScoreHundredths"]; ok {
+					t.Errorf("z-score reported without a baseline: %v", f.Counts)
+				}
+			}
+			if !reflect.DeepEqual(f.Evidence, tt.evidence) {
+				t.Errorf("evidence = %+v, want %+v", f.Evidence, tt.evidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// What started a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	// ErrRunInProgress is returned when asked for a run while another is
+	// still going here or on another server
+	ErrRunInProgress = errors.New("risk: an analysis is already running")
+	// ErrRunNotActive is returned when cancelling a run that isn't running
+	ErrRunNotActive = errors.New("risk: run is not in progress")
+	// ErrShuttingDown is returned for runs asked for after StopRuns
+	ErrShuttingDown = errors.New("risk: server is shutting down")
+
+	errRunNotDue = errors.New("another server analyzed every lot recently")
+)
+
+// runStore is where runs record their heartbeat and cancel requests
+type runStore interface {
+	// RequestCancel asks a run's server to stop it, returning false if it
+	// isn't running
+	RequestCancel(id string) (bool, error)
+	// Touch renews a run's heartbeat, returning whether it was asked to
+	// stop
+	Touch(id string) (bool, error)
+	FailStale(before time.Time) (int64, error)
+}
+
+type dbRuns struct{}
+
+func (dbRuns) RequestCancel(id string) (bool, error) { return database.RequestRiskRunCancel(id) }
+func (dbRuns) Touch(id string) (bool, error)         { return database.TouchRiskRun(id) }
+func (dbRuns) FailStale(before time.Time) (int64, error) {
+	return database.FailStaleRiskRuns(before)
+}
+
+var (
+	runsMu     sync.Mutex
+	activeRuns = make(map[string]context.CancelFunc) // runs in progress in this process
+	runsWG     sync.WaitGroup
+	stopping   bool
+)
+
+// StartRun starts an analysis in the background and returns its record.
+// An empty lotID analyzes every lot. Only one run, of one lot or all of
+// them, goes at a time across all servers. ctx covers starting the run;
+// the run itself goes on after it's done.
+func StartRun(ctx context.Context, trigger, lotID string) (database.RiskRun, error) {
+	var lot *database.ParkingLot
+	if lotID != "" {
+		l, err := database.GetParkingLot(ctx, lotID)
+		if err != nil {
+			return database.RiskRun{}, err
+		}
+		lot = &l
+	}
+
+	runsMu.Lock()
+	defer runsMu.Unlock()
+	if stopping {
+		return database.RiskRun{}, ErrShuttingDown
+	}
+	cfg := schedulerConfig
+	// The lock's owner is this process, so it doesn't stop a second run here
+	if len(activeRuns) > 0 {
+		return database.RiskRun{}, ErrRunInProgress
+	}
+	if err := lockRun(ctx, trigger, cfg); err != nil {
+		return database.RiskRun{}, err
+	}
+
+	run := database.RiskRun{
+		ID:           uuid.New().String(),
+		Trigger:      trigger,
+		ParkingLotID: lotID,
+		Status:       database.RiskRunRunning,
+		Owner:        database.InstanceID,
+		StartedAt:    time.Now(),
+	}
+	run.HeartbeatAt = run.StartedAt
+	if lot != nil {
+		run.Lots = 1
+	}
+	if err := database.InsertRiskRun(run); err != nil {
+		unlockRun()
+		return run, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	activeRuns[run.ID] = cancel
+	runsWG.Add(1)
+	go func() {
+		defer runsWG.Done()
+		held := make(chan struct{})
+		go func() {
+			defer close(held)
+			holdLock(ctx, cfg.LockTTL, cancel)
+		}()
+
+		beating := make(chan struct{})
+		go func() {
+			defer close(beating)
+			heartbeat(ctx, run.ID, cfg.LockTTL/3, cancel)
+		}()
+
+		executeRun(ctx, run, lot, cfg)
+
+		cancel()
+		<-beating
+		<-held // so a last renewal can't retake the lock after it's released
+		unlockRun()
+		runsMu.Lock()
+		delete(activeRuns, run.ID)
+		runsMu.Unlock()
+	}()
+	return run, nil
+}
+
+// lockRun takes the run lock. Scheduled runs also give
+// way if another server's scheduled run started within half an interval.
+func lockRun(ctx context.Context, trigger string, cfg SchedulerConfig) error {
+	ok, err := database.AcquireLock(ctx, runLockName, database.InstanceID, cfg.LockTTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRunInProgress
+	}
+	if trigger != TriggerSchedule {
+		return nil
+	}
+
+	last, err := database.GetLastRiskRun(TriggerSchedule)
+	if err == nil && last != nil && time.Since(last.StartedAt) < cfg.Interval/2 {
+		err = errRunNotDue
+	}
+	if err != nil {
+		unlockRun()
+	}
+	return err
+}
+
+// unlockRun releases the run lock. The run's own context is done by then,
+// so it doesn't take one.
+func unlockRun() {
+	if err := database.ReleaseLock(context.Background(), runLockName, database.InstanceID); err != nil {
+		log.Println("Error releasing risk analysis lock:", err)
+	}
+}
+
+// CancelRun stops a run in progress. Lots already being scored finish;
+// the rest are skipped and the run ends as cancelled. A run on another
+// server stops at its next heartbeat.
+func CancelRun(id string) error {
+	return cancelRunFrom(dbRuns{}, id)
+}
+
+func cancelRunFrom(store runStore, id string) error {
+	runsMu.Lock()
+	cancel, ok := activeRuns[id]
+	runsMu.Unlock()
+	if ok {
+		cancel()
+		return nil
+	}
+
+	ok, err := store.RequestCancel(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRunNotActive
+	}
+	return nil
+}
+
+// StopRuns refuses new runs, cancels those in progress and waits up to
+// timeout for them to record how far they got
+func StopRuns(timeout time.Duration) {
+	runsMu.Lock()
+	stopping = true
+	for _, cancel := range activeRuns {
+		cancel()
+	}
+	runsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		runsWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Println("Gave up waiting for risk runs to stop")
+	}
+}
+
+func executeRun(ctx context.Context, run database.RiskRun, lot *database.ParkingLot, cfg SchedulerConfig) {
+	log.Printf("Starting Risk Analysis (run %s)...", run.ID)
+
+	var lots []database.ParkingLot
+	if lot != nil {
+		lots = []database.ParkingLot{*lot}
+	} else {
+		var err error
+		if lots, err = database.GetAllParkingLots(ctx); err != nil {
+			log.Println("Error getting parking lots:", err)
+			finishRun(run, database.RiskRunFailed, err.Error())
+			return
+		}
+		if err := database.SetRiskRunLots(run.ID, len(lots)); err != nil {
+			log.Println("Error updating risk run:", err)
+		}
+	}
+
+	// A fixed pool of workers, so thousands of lots don't all hit
+	// MongoDB at once
+	queue := make(chan database.ParkingLot)
+	var wg sync.WaitGroup
+	for range min(cfg.Concurrency, len(lots)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for lot := range queue {
+				runLot(ctx, run, lot, cfg.LotTimeout)
+			}
+		}()
+	}
+feed:
+	for _, lot := range lots {
+		select {
+		case queue <- lot:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		log.Printf("Risk Analysis cancelled (run %s).", run.ID)
+		finishRun(run, database.RiskRunCancelled, "")
+		return
+	}
+	log.Printf("Risk Analysis completed for %d lots (run %s).", len(lots), run.ID)
+	finishRun(run, database.RiskRunCompleted, "")
+}
+
+// heartbeat renews a run's heartbeat until ctx is done, so other servers
+// can tell it from one whose server died (see failStaleRuns). It calls
+// cancel once someone asks for the run to stop.
+func heartbeat(ctx context.Context, runID string, every time.Duration, cancel func()) {
+	heartbeatFrom(ctx, dbRuns{}, runID, every, cancel)
+}
+
+func heartbeatFrom(ctx context.Context, store runStore, runID string, every time.Duration, cancel func()) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stop, err := store.Touch(runID)
+			if err != nil {
+				log.Println("Error renewing risk run heartbeat:", err)
+				continue
+			}
+			if stop {
+				log.Printf("Risk run %s was cancelled; stopping it", runID)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// failStaleRuns marks runs left "running" by a server that crashed or was
+// killed as failed. A run's heartbeat is renewed three times per lock TTL,
+// so one silent for a whole TTL has no server behind it.
+func failStaleRuns(cfg SchedulerConfig) {
+	failStaleRunsFrom(dbRuns{}, cfg, time.Now())
+}
+
+func failStaleRunsFrom(store runStore, cfg SchedulerConfig, now time.Time) {
+	n, err := store.FailStale(now.Add(-cfg.LockTTL))
+	if err != nil {
+		log.Println("Error failing abandoned risk runs:", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Marked %d abandoned risk runs as failed", n)
+	}
+}
+
+// runLot scores one lot within timeout and records it on the run. A lot
+// cut short because the run was cancelled isn't counted.
+func runLot(ctx context.Context, run database.RiskRun, lot database.ParkingLot, timeout time.Duration) {
+	lotCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var failure *database.RiskRunFailure
+	if err := analyzeLot(lotCtx, lot, run); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Error analyzing lot %s: %v", lot.ID.Hex(), err)
+		failure = &database.RiskRunFailure{ParkingLotID: lot.ID.Hex(), Error: err.Error()}
+	}
+	if err := database.AddRiskRunProgress(run.ID, failure); err != nil {
+		log.Println("Error updating risk run:", err)
+	}
+}
+
+func finishRun(run database.RiskRun, status, runErr string) {
+	if err := database.FinishRiskRun(run.ID, status, runErr, run.StartedAt, time.Now()); err != nil {
+		log.Println("Error finishing risk run:", err)
+	}
+}
@@ -0,0 +1,210 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRuns holds the runs other servers are running, by whether they were
+// asked to stop
+type fakeRuns struct {
+	mu      sync.Mutex
+	running map[string]bool
+	err     error
+	touches int
+	before  time.Time // the cutoff FailStale was given
+}
+
+func (f *fakeRuns) RequestCancel(id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	if _, ok := f.running[id]; !ok {
+		return false, nil
+	}
+	f.running[id] = true
+	return true, nil
+}
+
+func (f *fakeRuns) Touch(id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touches++
+	return f.running[id], f.err
+}
+
+func (f *fakeRuns) FailStale(before time.Time) (int64, error) {
+	f.before = before
+	return 1, f.err
+}
+
+// withRuns swaps in a clean set of this process's runs for the test
+func withRuns(t *testing.T) {
+	t.Helper()
+	runsMu.Lock()
+	saved, wasStopping := activeRuns, stopping
+	activeRuns, stopping = make(map[string]context.CancelFunc), false
+	runsMu.Unlock()
+	t.Cleanup(func() {
+		runsMu.Lock()
+		activeRuns, stopping = saved, wasStopping
+		runsMu.Unlock()
+	})
+}
+
+// startFake registers a run in this process that ends when cancelled, or
+// never if stubborn
+func startFake(id string, stubborn bool) (ctx context.Context, finish func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runsMu.Lock()
+	activeRuns[id] = cancel
+	runsMu.Unlock()
+	runsWG.Add(1)
+	done := make(chan struct{})
+	finish = sync.OnceFunc(func() { close(done) })
+	go func() {
+		defer runsWG.Done()
+		if stubborn {
+			<-done
+		} else {
+			<-ctx.Done()
+		}
+		runsMu.Lock()
+		delete(activeRuns, id)
+		runsMu.Unlock()
+	}()
+	return ctx, finish
+}
+
+func TestCancelRun(t *testing.T) {
+	withRuns(t)
+	local, finish := startFake("here", false)
+	t.Cleanup(finish)
+	store := &fakeRuns{running: map[string]bool{"elsewhere": false}}
+
+	if err := cancelRunFrom(store, "here"); err != nil {
+		t.Fatalf("cancelling a local run: %v", err)
+	}
+	if local.Err() == nil {
+		t.Error("local run wasn't cancelled")
+	}
+	if store.running["here"] {
+		t.Error("local run's cancel was sent to the store")
+	}
+
+	if err := cancelRunFrom(store, "elsewhere"); err != nil {
+		t.Fatalf("cancelling another server's run: %v", err)
+	}
+	if !store.running["elsewhere"] {
+		t.Error("cancel request wasn't stored on the run")
+	}
+
+	if err := cancelRunFrom(store, "finished"); !errors.Is(err, ErrRunNotActive) {
+		t.Errorf("cancelling a run that isn't running: err = %v, want ErrRunNotActive", err)
+	}
+
+	store.err = errors.New("db down")
+	if err := cancelRunFrom(store, "elsewhere"); err == nil || errors.Is(err, ErrRunNotActive) {
+		t.Errorf("store failing: err = %v, want the store's error", err)
+	}
+}
+
+func TestHeartbeatStopsCancelledRun(t *testing.T) {
+	store := &fakeRuns{running: map[string]bool{"run-1": false}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		heartbeatFrom(ctx, store, "run-1", time.Millisecond, cancel)
+	}()
+
+	// Beats while nobody asks it to stop
+	deadline := time.After(time.Second)
+	for {
+		store.mu.Lock()
+		n := store.touches
+		store.mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("heartbeat didn't renew the run")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if ctx.Err() != nil {
+		t.Fatal("run cancelled before it was asked to stop")
+	}
+
+	if _, err := store.RequestCancel("run-1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat didn't stop the cancelled run")
+	}
+	if ctx.Err() == nil {
+		t.Error("run wasn't cancelled")
+	}
+}
+
+func TestStopRuns(t *testing.T) {
+	withRuns(t)
+	a, finishA := startFake("a", false)
+	b, finishB := startFake("b", false)
+	t.Cleanup(finishA)
+	t.Cleanup(finishB)
+
+	StopRuns(time.Second)
+	if a.Err() == nil || b.Err() == nil {
+		t.Error("runs in progress weren't cancelled")
+	}
+	runsMu.Lock()
+	left := len(activeRuns)
+	runsMu.Unlock()
+	if left != 0 {
+		t.Errorf("%d runs still active after StopRuns returned", left)
+	}
+	if _, err := StartRun(context.Background(), TriggerManual, ""); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("starting a run after StopRuns: err = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestStopRunsGivesUp(t *testing.T) {
+	withRuns(t)
+	hung, finish := startFake("hung", true)
+	t.Cleanup(func() {
+		finish()
+		runsWG.Wait()
+	})
+
+	start := time.Now()
+	StopRuns(20 * time.Millisecond)
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("StopRuns waited %v on a hung run", took)
+	}
+	if hung.Err() == nil {
+		t.Error("hung run wasn't cancelled")
+	}
+}
+
+func TestFailStaleRuns(t *testing.T) {
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	store := &fakeRuns{}
+	failStaleRunsFrom(store, SchedulerConfig{LockTTL: 2 * time.Minute}, now)
+	if want := now.Add(-2 * time.Minute); !store.before.Equal(want) {
+		t.Errorf("failed runs silent since %v, want %v", store.before, want)
+	}
+
+	// An error is only logged
+	store.err = errors.New("db down")
+	failStaleRunsFrom(store, SchedulerConfig{LockTTL: time.Minute}, now)
+}
@@ -0,0 +1,139 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchedulerConfig controls how analysis runs are scheduled and executed
+type SchedulerConfig struct {
+	Interval    time.Duration // between scheduled runs of every lot
+	Jitter      time.Duration // each wait is Interval plus up to this much
+	Concurrency int           // lots scored at once per run
+	LotTimeout  time.Duration // a lot taking longer is recorded as failed
+	LockTTL     time.Duration // lease on the run lock, renewed while running
+}
+
+var schedulerConfig = SchedulerConfig{
+	Interval:    1 * time.Hour,
+	Jitter:      5 * time.Minute,
+	Concurrency: 8,
+	LotTimeout:  2 * time.Minute,
+	LockTTL:     2 * time.Minute,
+}
+
+// runLockName is the lock replicas take before any analysis run
+const runLockName = "risk-analysis"
+
+// LoadSchedulerConfig overrides the scheduler defaults from a spec such as
+// "concurrency=16,lotTimeout=1m,interval=1h,jitter=5m,lockTTL=2m". An
+// empty spec keeps the defaults.
+func LoadSchedulerConfig(spec string) error {
+	cfg := schedulerConfig
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("risk scheduler %q: expected key=value", entry)
+		}
+
+		var err error
+		switch key {
+		case "concurrency":
+			cfg.Concurrency, err = strconv.Atoi(value)
+		case "interval":
+			cfg.Interval, err = time.ParseDuration(value)
+		case "jitter":
+			cfg.Jitter, err = time.ParseDuration(value)
+		case "lotTimeout":
+			cfg.LotTimeout, err = time.ParseDuration(value)
+		case "lockTTL":
+			cfg.LockTTL, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("risk scheduler %q: %w", entry, err)
+		}
+	}
+
+	if cfg.Concurrency <= 0 || cfg.Interval <= 0 || cfg.Jitter < 0 || cfg.LotTimeout <= 0 || cfg.LockTTL <= 0 {
+		return fmt.Errorf("risk scheduler %q: concurrency and durations must be positive", spec)
+	}
+	schedulerConfig = cfg
+	return nil
+}
+
+// StartRiskAnalysisScheduler analyzes every lot about once per interval
+// until ctx is done. Replicas share a lock, so only one of them runs at a
+// time, and a tick soon after another replica's run is skipped. Runs a
+// crashed server left "running" are marked failed at startup and on every
+// tick.
+func StartRiskAnalysisScheduler(ctx context.Context) {
+	cfg := schedulerConfig
+	failStaleRuns(cfg)
+	go func() {
+		// Run once shortly after startup, spread out so replicas started
+		// together don't all try at once
+		wait := jitter(cfg.Jitter)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			runAnalysis(ctx)
+			wait = cfg.Interval + jitter(cfg.Jitter)
+		}
+	}()
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// runAnalysis starts a scheduled run of every lot, unless one is going or
+// just went
+func runAnalysis(ctx context.Context) {
+	failStaleRuns(schedulerConfig)
+	if _, err := StartRun(ctx, TriggerSchedule, ""); err != nil {
+		log.Println("Skipping scheduled risk analysis:", err)
+	}
+}
+
+// holdLock renews the run lock until ctx is done, calling lost if another
+// replica ends up with it
+func holdLock(ctx context.Context, ttl time.Duration, lost func()) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := database.AcquireLock(ctx, runLockName, database.InstanceID, ttl)
+			if err != nil {
+				// Keep going; the lease lasts a while yet
+				log.Println("Error renewing risk analysis lock:", err)
+				continue
+			}
+			if !ok {
+				log.Println("Lost the risk analysis lock to another server; stopping run")
+				lost()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Data the rules read, behind interfaces so each rule can be tested against
+// fake data. dbSource is the MongoDB-backed implementation of all of them.
+// Every read takes the run's context, so a lot that times out stops
+// querying.
+
+type ReportSource interface {
+	// ReportsLastWindow returns reports made in the d before asOf
+	ReportsLastWindow(ctx context.Context, lotID string, asOf time.Time, d time.Duration) ([]database.Report, error)
+}
+
+type TicketSource interface {
+	// TicketsLastWindow returns tickets issued in the d before asOf
+	TicketsLastWindow(ctx context.Context, lotID string, asOf time.Time, d time.Duration) ([]database.Ticket, error)
+}
+
+type QuerySource interface {
+	QueriesForLot(ctx context.Context, lotID string) ([]database.Query, error)
+}
+
+type SessionSource interface {
+	// SessionsOverlapping returns sessions that were open at any point in
+	// [from, to)
+	SessionsOverlapping(ctx context.Context, lotID string, from, to time.Time) ([]database.ParkingSession, error)
+}
+
+// Metrics the count sources know. All but revenue can be counted per hour;
+// all of them can be totalled per lot.
+const (
+	MetricEntries = "entries" // session entries
+	MetricTickets = "tickets" // tickets issued
+	MetricRevenue = "revenue" // ticket amounts
+	MetricReports = "reports" // citizen reports
+)
+
+type CountSource interface {
+	// HourlyCounts counts a metric in [from, to) per lot and local hour;
+	// the map keys are the hours' start in UTC
+	HourlyCounts(ctx context.Context, metric string, lotIDs []bson.ObjectID, from, to time.Time, loc *time.Location) (map[bson.ObjectID]map[time.Time]int, error)
+}
+
+type TotalSource interface {
+	// LotTotals totals a metric in [from, to) per lot
+	LotTotals(ctx context.Context, metric string, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error)
+}
+
+type LotSource interface {
+	LotsInArea(ctx context.Context, area string) ([]database.ParkingLot, error)
+}
+
+// ruleSource is everything the built-in rules read
+type ruleSource interface {
+	ReportSource
+	TicketSource
+	QuerySource
+	SessionSource
+	CountSource
+	TotalSource
+	LotSource
+	BaselineStore
+}
+
+type dbSource struct{}
+
+func (dbSource) ReportsLastWindow(ctx context.Context, lotID string, asOf time.Time, d time.Duration) ([]database.Report, error) {
+	return database.GetReportsLastWindow(ctx, lotID, asOf, d)
+}
+
+func (dbSource) TicketsLastWindow(ctx context.Context, lotID string, asOf time.Time, d time.Duration) ([]database.Ticket, error) {
+	return database.GetTicketsLastWindow(ctx, lotID, asOf, d)
+}
+
+func (dbSource) QueriesForLot(ctx context.Context, lotID string) ([]database.Query, error) {
+	return database.GetQueryByParkingLot(ctx, lotID)
+}
+
+func (dbSource) SessionsOverlapping(ctx context.Context, lotID string, from, to time.Time) ([]database.ParkingSession, error) {
+	return database.GetSessionsOverlapping(ctx, lotID, from, to)
+}
+
+func (dbSource) HourlyCounts(ctx context.Context, metric string, lotIDs []bson.ObjectID, from, to time.Time, loc *time.Location) (map[bson.ObjectID]map[time.Time]int, error) {
+	_, offset := from.In(loc).Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	tz := fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)
+	switch metric {
+	case MetricEntries:
+		return database.CountEntriesByHour(ctx, lotIDs, from, to, tz)
+	case MetricTickets:
+		return database.CountTicketsByHour(ctx, lotIDs, from, to, tz)
+	case MetricReports:
+		return database.CountReportsByHour(ctx, lotIDs, from, to, tz)
+	}
+	return nil, fmt.Errorf("unknown metric %q", metric)
+}
+
+func (dbSource) LotTotals(ctx context.Context, metric string, lotIDs []bson.ObjectID, from, to time.Time) (map[bson.ObjectID]float64, error) {
+	switch metric {
+	case MetricEntries:
+		return database.CountEntriesByLot(ctx, lotIDs, from, to)
+	case MetricTickets:
+		return database.CountTicketsByLot(ctx, lotIDs, from, to)
+	case MetricRevenue:
+		return database.SumTicketRevenueByLot(ctx, lotIDs, from, to)
+	case MetricReports:
+		return database.CountReportsByLot(ctx, lotIDs, from, to)
+	}
+	return nil, fmt.Errorf("unknown metric %q", metric)
+}
+
+func (dbSource) LotsInArea(ctx context.Context, area string) ([]database.ParkingLot, error) {
+	return database.GetParkingLotsByArea(ctx, area)
+}
+
+// LoadBaseline returns the stored baseline, unless it covers data after
+// through. Only the newest baseline is kept, so backtests that step past it
+// recompute theirs.
+func (dbSource) LoadBaseline(ctx context.Context, scope, key, metric string, through time.Time) (*database.RiskBaseline, error) {
+	return database.GetRiskBaseline(ctx, scope, key, metric, through)
+}
+
+func (dbSource) SaveBaseline(ctx context.Context, b database.RiskBaseline) error {
+	return database.SaveRiskBaseline(ctx, b)
+}
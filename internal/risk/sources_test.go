@@ -0,0 +1,124 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Fakes of the sources in sources.go, holding their data in memory
+
+type fakeSessions []database.ParkingSession
+
+func (f fakeSessions) SessionsOverlapping(_ context.Context, lotID string, from, to time.Time) ([]database.ParkingSession, error) {
+	var out []database.ParkingSession
+	for _, s := range f {
+		if s.ParkingLotID.Hex() != lotID || !s.EntryTime.Before(to) {
+			continue
+		}
+		if s.ExitTime != nil && s.ExitTime.Before(from) {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// fakeReports must be oldest first, as ReportsLastWindow returns them
+type fakeReports []database.Report
+
+func (f fakeReports) ReportsLastWindow(_ context.Context, lotID string, asOf time.Time, d time.Duration) ([]database.Report, error) {
+	var out []database.Report
+	for _, r := range f {
+		if r.ParkingLotID.Hex() == lotID && !r.CreatedAt.Before(asOf.Add(-d)) && r.CreatedAt.Before(asOf) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+type fakeTickets []database.Ticket
+
+func (f fakeTickets) TicketsLastWindow(_ context.Context, lotID string, asOf time.Time, d time.Duration) ([]database.Ticket, error) {
+	var out []database.Ticket
+	for _, t := range f {
+		if t.ParkingLotID.Hex() == lotID && !t.CreatedAt.Before(asOf.Add(-d)) && t.CreatedAt.Before(asOf) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// fakeCounts holds hourly counts of one metric per lot, keyed by the UTC
+// start of the hour. calls counts HourlyCounts calls, to tell a stored
+// baseline from a recomputed one.
+type fakeCounts struct {
+	byLot map[bson.ObjectID]map[time.Time]int
+	calls int
+}
+
+func (f *fakeCounts) HourlyCounts(_ context.Context, _ string, lotIDs []bson.ObjectID, from, to time.Time, _ *time.Location) (map[bson.ObjectID]map[time.Time]int, error) {
+	f.calls++
+	out := make(map[bson.ObjectID]map[time.Time]int)
+	for _, id := range lotIDs {
+		for h, n := range f.byLot[id] {
+			if h.Before(from) || !h.Before(to) {
+				continue
+			}
+			if out[id] == nil {
+				out[id] = make(map[time.Time]int)
+			}
+			out[id][h] = n
+		}
+	}
+	return out, nil
+}
+
+// fakeTotals holds each metric's total per lot over whatever window is
+// asked for
+type fakeTotals map[string]map[bson.ObjectID]float64
+
+func (f fakeTotals) LotTotals(_ context.Context, metric string, lotIDs []bson.ObjectID, _, _ time.Time) (map[bson.ObjectID]float64, error) {
+	out := make(map[bson.ObjectID]float64)
+	for _, id := range lotIDs {
+		if v, ok := f[metric][id]; ok {
+			out[id] = v
+		}
+	}
+	return out, nil
+}
+
+type fakeLots []database.ParkingLot
+
+func (f fakeLots) LotsInArea(_ context.Context, area string) ([]database.ParkingLot, error) {
+	var out []database.ParkingLot
+	for _, l := range f {
+		if l.Area == area {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// report is a report about lot made by user at at; a zero user is
+// anonymous
+func report(lot, user bson.ObjectID, at time.Time) database.Report {
+	return database.Report{ID: bson.NewObjectID(), ParkingLotID: lot, UserID: user, CreatedAt: at}
+}
+
+// ticket is a ticket issued at lot at at
+func ticket(lot bson.ObjectID, at time.Time) database.Ticket {
+	return database.Ticket{ID: bson.NewObjectID(), ParkingLotID: lot, CreatedAt: at}
+}
+
+// session is a parking session at lot from entry to exit; a zero exit
+// leaves it open
+func session(lot bson.ObjectID, entry, exit time.Time) database.ParkingSession {
+	s := database.ParkingSession{ID: bson.NewObjectID(), ParkingLotID: lot, EntryTime: entry}
+	if !exit.IsZero() {
+		s.ExitTime = &exit
+	}
+	return s
+}
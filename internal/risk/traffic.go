@@ -0,0 +1,109 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrafficReading is one congestion observation near a lot. Congestion runs
+// from 0 (free flow) to 1 (standstill).
+type TrafficReading struct {
+	LotID      string    `json:"lotId"`
+	ObservedAt time.Time `json:"observedAt"`
+	Congestion float64   `json:"congestion"`
+}
+
+// TrafficSource supplies congestion readings for rule 2
+type TrafficSource interface {
+	// Name identifies the source in score reasons, e.g. "file:traffic.csv"
+	Name() string
+	// Latest returns the newest reading for the lot taken at or before at,
+	// or ok=false if the source has none
+	Latest(ctx context.Context, lot database.ParkingLot, at time.Time) (r TrafficReading, ok bool, err error)
+}
+
+// noTraffic is used until a source is configured: no readings, so rule 2
+// never fires instead of guessing
+type noTraffic struct{}
+
+func (noTraffic) Name() string { return "none" }
+
+func (noTraffic) Latest(context.Context, database.ParkingLot, time.Time) (TrafficReading, bool, error) {
+	return TrafficReading{}, false, nil
+}
+
+var (
+	trafficMu     sync.RWMutex
+	trafficSource TrafficSource = noTraffic{}
+)
+
+// SetTrafficSource replaces the source rule 2 reads from
+func SetTrafficSource(s TrafficSource) {
+	trafficMu.Lock()
+	defer trafficMu.Unlock()
+	trafficSource = s
+}
+
+func currentTrafficSource() TrafficSource {
+	trafficMu.RLock()
+	defer trafficMu.RUnlock()
+	return trafficSource
+}
+
+// LoadTrafficSource configures the traffic source from spec:
+//
+//	file:<path>  CSV or JSON feed of readings (see FileTrafficSource)
+//	http:<url>   traffic provider (see HTTPTrafficSource)
+//
+// An empty spec leaves rule 2 without traffic data.
+func LoadTrafficSource(spec string) error {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil
+	}
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok || target == "" {
+		return fmt.Errorf("risk traffic source %q: expected kind:target", spec)
+	}
+
+	var s TrafficSource
+	var err error
+	switch kind {
+	case "file":
+		s, err = NewFileTrafficSource(target)
+	case "http":
+		s = NewHTTPTrafficSource(target)
+	default:
+		err = fmt.Errorf("unknown kind %q", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("risk traffic source %q: %w", spec, err)
+	}
+	SetTrafficSource(s)
+	return nil
+}
+
+// readingKeys are the lot IDs a feed may use for a lot: the ObjectID hex or
+// the operator-facing PID
+func readingKeys(lot database.ParkingLot) []string {
+	keys := []string{lot.ID.Hex()}
+	if lot.PID != "" {
+		keys = append(keys, lot.PID)
+	}
+	return keys
+}
+
+// latestBefore picks the newest reading at or before at from readings
+// sorted by ObservedAt
+func latestBefore(readings []TrafficReading, at time.Time) (TrafficReading, bool) {
+	for i := len(readings) - 1; i >= 0; i-- {
+		if !readings[i].ObservedAt.After(at) {
+			return readings[i], true
+		}
+	}
+	return TrafficReading{}, false
+}
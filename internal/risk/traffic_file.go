@@ -0,0 +1,121 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileTrafficSource reads congestion readings from a file that an external
+// feed keeps up to date. The file is re-read whenever its mtime changes.
+//
+// Files ending in .json hold an array of TrafficReading objects. Anything
+// else is CSV with the columns lotId,observedAt,congestion (RFC 3339 time,
+// optional header row). lotId may be the lot's ObjectID or its PID.
+type FileTrafficSource struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	readings map[string][]TrafficReading
+}
+
+func NewFileTrafficSource(path string) (*FileTrafficSource, error) {
+	s := &FileTrafficSource{path: path}
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileTrafficSource) Name() string {
+	return "file:" + filepath.Base(s.path)
+}
+
+func (s *FileTrafficSource) Latest(_ context.Context, lot database.ParkingLot, at time.Time) (TrafficReading, bool, error) {
+	if err := s.refresh(); err != nil {
+		return TrafficReading{}, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := lookupReading(s.readings, lot, at)
+	return r, ok, nil
+}
+
+func (s *FileTrafficSource) refresh() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.readings != nil && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var readings []TrafficReading
+	if strings.EqualFold(filepath.Ext(s.path), ".json") {
+		err = json.NewDecoder(f).Decode(&readings)
+	} else {
+		readings, err = parseTrafficCSV(f)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	for _, r := range readings {
+		if r.Congestion < 0 || r.Congestion > 1 {
+			return fmt.Errorf("%s: congestion %v for lot %s is outside [0, 1]", s.path, r.Congestion, r.LotID)
+		}
+	}
+
+	s.readings = groupReadings(readings)
+	s.modTime = info.ModTime()
+	return nil
+}
+
+func parseTrafficCSV(r io.Reader) ([]TrafficReading, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+
+	var readings []TrafficReading
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return readings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(rec[0], "lotId") {
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339, rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		congestion, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		readings = append(readings, TrafficReading{LotID: rec[0], ObservedAt: at, Congestion: congestion})
+	}
+}
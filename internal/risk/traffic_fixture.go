@@ -0,0 +1,48 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"sort"
+	"time"
+)
+
+// FixtureTrafficSource serves a fixed set of readings. It's deterministic, so
+// scores computed against it can be reproduced exactly.
+type FixtureTrafficSource struct {
+	readings map[string][]TrafficReading
+}
+
+func NewFixtureTrafficSource(readings ...TrafficReading) *FixtureTrafficSource {
+	return &FixtureTrafficSource{readings: groupReadings(readings)}
+}
+
+func (*FixtureTrafficSource) Name() string { return "fixture" }
+
+func (s *FixtureTrafficSource) Latest(_ context.Context, lot database.ParkingLot, at time.Time) (TrafficReading, bool, error) {
+	r, ok := lookupReading(s.readings, lot, at)
+	return r, ok, nil
+}
+
+// groupReadings indexes readings by lot, oldest first
+func groupReadings(readings []TrafficReading) map[string][]TrafficReading {
+	byLot := make(map[string][]TrafficReading)
+	for _, r := range readings {
+		byLot[r.LotID] = append(byLot[r.LotID], r)
+	}
+	for _, rs := range byLot {
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].ObservedAt.Before(rs[j].ObservedAt) })
+	}
+	return byLot
+}
+
+func lookupReading(byLot map[string][]TrafficReading, lot database.ParkingLot, at time.Time) (TrafficReading, bool) {
+	var best TrafficReading
+	found := false
+	for _, key := range readingKeys(lot) {
+		if r, ok := latestBefore(byLot[key], at); ok && (!found || r.ObservedAt.After(best.ObservedAt)) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,77 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPTrafficSource asks a traffic provider for the congestion near a lot:
+//
+//	GET <url>?lotId=<id>&pid=<pid>&lat=<lat>&lng=<lng>&at=<RFC 3339>
+//
+// The provider answers with a TrafficReading as JSON, or 404 when it has no
+// data for the lot.
+type HTTPTrafficSource struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPTrafficSource(url string) *HTTPTrafficSource {
+	return &HTTPTrafficSource{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPTrafficSource) Name() string {
+	return "http:" + s.url
+}
+
+func (s *HTTPTrafficSource) Latest(ctx context.Context, lot database.ParkingLot, at time.Time) (TrafficReading, bool, error) {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return TrafficReading{}, false, err
+	}
+	q := u.Query()
+	q.Set("lotId", lot.ID.Hex())
+	q.Set("pid", lot.PID)
+	q.Set("lat", fmt.Sprint(lot.Lat))
+	q.Set("lng", fmt.Sprint(lot.Lng))
+	q.Set("at", at.UTC().Format(time.RFC3339))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return TrafficReading{}, false, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return TrafficReading{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return TrafficReading{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return TrafficReading{}, false, fmt.Errorf("traffic provider returned %s: %s", resp.Status, body)
+	}
+
+	var r TrafficReading
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&r); err != nil {
+		return TrafficReading{}, false, err
+	}
+	if r.Congestion < 0 || r.Congestion > 1 {
+		return TrafficReading{}, false, fmt.Errorf("traffic provider returned congestion %v outside [0, 1]", r.Congestion)
+	}
+	if r.ObservedAt.IsZero() {
+		r.ObservedAt = at
+	}
+	if r.ObservedAt.After(at) {
+		return TrafficReading{}, false, nil
+	}
+	return r, true, nil
+}
@@ -0,0 +1,78 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"log"
+	"time"
+)
+
+// verificationQueryType is the Query.Type of queries the engine sends: the
+// same as an admin's text query, so attendants can't tell them apart
+const verificationQueryType = "TEXT"
+
+// queryStore is where requestVerification looks up and sends queries
+type queryStore interface {
+	// LastRiskQuery returns the newest query the engine sent to the lot,
+	// or nil
+	LastRiskQuery(ctx context.Context, lotID string) (*database.Query, error)
+	CreateQuery(ctx context.Context, q database.Query) (database.Query, error)
+}
+
+type dbQueries struct{}
+
+func (dbQueries) LastRiskQuery(ctx context.Context, lotID string) (*database.Query, error) {
+	return database.GetLastRiskQuery(ctx, lotID)
+}
+
+func (dbQueries) CreateQuery(ctx context.Context, q database.Query) (database.Query, error) {
+	return database.CreateQuery(ctx, q)
+}
+
+// requestVerification sends the policy's verification query to a lot that
+// a scheduled run just scored HIGH, unless the engine already sent one
+// within the cooldown. A manual run is someone already looking, so it
+// doesn't ask.
+func requestVerification(ctx context.Context, lot database.ParkingLot, s Scored, p *Policy, run database.RiskRun) {
+	q, err := requestVerificationFrom(ctx, dbQueries{}, lot, s, p, run)
+	if err != nil {
+		log.Println("Error sending verification query:", err)
+		return
+	}
+	if q != nil {
+		log.Printf("Lot %s: sent verification query %s (run %s)", lot.ID.Hex(), q.ID, run.ID)
+	}
+}
+
+// requestVerificationFrom is requestVerification against store. It returns
+// the query sent, or nil if none was due.
+func requestVerificationFrom(ctx context.Context, store queryStore, lot database.ParkingLot, s Scored, p *Policy, run database.RiskRun) (*database.Query, error) {
+	cfg := p.VerificationQueries
+	if !cfg.Enabled || s.Level != "HIGH" || run.Trigger != TriggerSchedule {
+		return nil, nil
+	}
+	id := lot.ID.Hex()
+
+	last, err := store.LastRiskQuery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cooldown := time.Duration(cfg.CooldownHours) * time.Hour
+	if last != nil && s.At.Sub(last.Time) < cooldown {
+		return nil, nil
+	}
+
+	q, err := store.CreateQuery(ctx, database.Query{
+		Query:            cfg.Query,
+		ToParkingLot:     id,
+		ResponseRequired: true,
+		Time:             s.At,
+		WithInTime:       cfg.WithInMinutes,
+		Type:             verificationQueryType,
+		RiskRunID:        run.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
@@ -0,0 +1,91 @@
+package risk
+
+import (
+	"app/internal/database"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// fakeQueries holds the engine's last query to a lot and what it sends
+type fakeQueries struct {
+	last *database.Query
+	err  error
+	sent []database.Query
+}
+
+func (f *fakeQueries) LastRiskQuery(context.Context, string) (*database.Query, error) {
+	return f.last, f.err
+}
+
+func (f *fakeQueries) CreateQuery(_ context.Context, q database.Query) (database.Query, error) {
+	q.ID = "query-" + q.RiskRunID
+	f.sent = append(f.sent, q)
+	return q, nil
+}
+
+func TestRequestVerification(t *testing.T) {
+	at := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	lot := database.ParkingLot{ID: bson.NewObjectID()}
+	scheduled := database.RiskRun{ID: "run-1", Trigger: TriggerSchedule}
+	high := Scored{At: at, Score: 85, Level: "HIGH"}
+	ago := func(d time.Duration) *database.Query { return &database.Query{Time: at.Add(-d)} }
+
+	tests := []struct {
+		name     string
+		disabled bool
+		s        Scored
+		run      database.RiskRun
+		last     *database.Query
+		lastErr  error
+		wantSent bool
+		wantErr  bool
+	}{
+		{name: "first HIGH of a scheduled run", s: high, run: scheduled, wantSent: true},
+		{name: "off in the policy", disabled: true, s: high, run: scheduled},
+		{name: "MEDIUM", s: Scored{At: at, Score: 50, Level: "MEDIUM"}, run: scheduled},
+		{name: "manual run", s: high, run: database.RiskRun{ID: "run-2", Trigger: TriggerManual}},
+		{name: "asked within the cooldown", s: high, run: scheduled, last: ago(5 * time.Hour)},
+		{name: "asked a cooldown ago", s: high, run: scheduled, last: ago(6 * time.Hour), wantSent: true},
+		{name: "asked long ago", s: high, run: scheduled, last: ago(72 * time.Hour), wantSent: true},
+		{name: "lookup fails", s: high, run: scheduled, lastErr: errors.New("down"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultPolicy()
+			p.VerificationQueries.Enabled = !tt.disabled
+			store := &fakeQueries{last: tt.last, err: tt.lastErr}
+
+			q, err := requestVerificationFrom(context.Background(), store, lot, tt.s, p, tt.run)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			wantN := 0
+			if tt.wantSent {
+				wantN = 1
+			}
+			if (q != nil) != tt.wantSent || len(store.sent) != wantN {
+				t.Fatalf("sent %v (returned %v), want sent %v", store.sent, q, tt.wantSent)
+			}
+			if !tt.wantSent {
+				return
+			}
+			want := database.Query{
+				ID:               "query-run-1",
+				Query:            p.VerificationQueries.Query,
+				ToParkingLot:     lot.ID.Hex(),
+				ResponseRequired: true,
+				Time:             at,
+				WithInTime:       p.VerificationQueries.WithInMinutes,
+				Type:             verificationQueryType,
+				RiskRunID:        "run-1",
+			}
+			if store.sent[0] != want || *q != want {
+				t.Errorf("sent %+v, want %+v", store.sent[0], want)
+			}
+		})
+	}
+}
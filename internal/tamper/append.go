@@ -0,0 +1,97 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// How many times Append re-reads the tip after losing a race to another writer
+const maxAppendAttempts = 5
+
+// chainLocks serialize appends to each chain within this process; the
+// unique indexes on (chainId, seq) and (chainId, prevHash) catch races with
+// other backend instances
+var (
+	chainLocksMu sync.Mutex
+	chainLocks   = make(map[string]*sync.Mutex)
+)
+
+func chainLock(chainID string) *sync.Mutex {
+	chainLocksMu.Lock()
+	defer chainLocksMu.Unlock()
+	mu, ok := chainLocks[chainID]
+	if !ok {
+		mu = &sync.Mutex{}
+		chainLocks[chainID] = mu
+	}
+	return mu
+}
+
+var ErrAppendContention = errors.New("tamper log: too much contention, giving up")
+
+// chainStore is where Append reads a chain's tip and writes new records.
+// Insert returns database.ErrTamperLogConflict when the unique indexes
+// reject a record because another writer got there first.
+type chainStore interface {
+	LastLog(chainID string) (*database.TamperLog, error)
+	Insert(l database.TamperLog) error
+}
+
+type dbChainStore struct{}
+
+func (dbChainStore) LastLog(chainID string) (*database.TamperLog, error) {
+	return database.GetLastTamperLog(chainID)
+}
+
+func (dbChainStore) Insert(l database.TamperLog) error {
+	return database.InsertTamperLog(l)
+}
+
+// Append links l to the current tip of its parking lot's chain and stores
+// it. Concurrent appends never fork the chain: the loser of a race gets a
+// duplicate key error, re-reads the tip and tries again.
+func Append(l database.TamperLog) (database.TamperLog, error) {
+	return appendTo(dbChainStore{}, l)
+}
+
+func appendTo(store chainStore, l database.TamperLog) (database.TamperLog, error) {
+	l.ChainID = l.ParkingLotID
+
+	mu := chainLock(l.ChainID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		lastLog, err := store.LastLog(l.ChainID)
+		if err != nil {
+			return l, err
+		}
+
+		l.Seq = 1
+		l.PrevHash = GenesisHash
+		if lastLog != nil {
+			l.Seq = lastLog.Seq + 1
+			l.PrevHash = lastLog.Hash
+		}
+
+		// Stored at millisecond precision in UTC, which is exactly what
+		// MongoDB gives back, so the hash can be recomputed
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		l.ID = bson.NewObjectID()
+		l.EntryExitTime = now
+		l.CreatedAt = now
+		l.HashVersion = CurrentHashVersion
+		l.Hash = Hash(l)
+
+		err = store.Insert(l)
+		if errors.Is(err, database.ErrTamperLogConflict) {
+			continue
+		}
+		return l, err
+	}
+	return l, ErrAppendContention
+}
@@ -0,0 +1,172 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// fakeChains stores chains in memory and enforces the unique (chainId, seq)
+// and (chainId, prevHash) indexes. beforeInsert runs ahead of every insert,
+// standing in for another backend instance writing to the same chain.
+type fakeChains struct {
+	mu           sync.Mutex
+	chains       map[string][]database.TamperLog
+	inserts      int
+	beforeInsert func(f *fakeChains, l database.TamperLog) error
+}
+
+func (f *fakeChains) LastLog(chainID string) (*database.TamperLog, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	logs := f.chains[chainID]
+	if len(logs) == 0 {
+		return nil, nil
+	}
+	last := logs[len(logs)-1]
+	return &last, nil
+}
+
+func (f *fakeChains) Insert(l database.TamperLog) error {
+	if f.beforeInsert != nil {
+		if err := f.beforeInsert(f, l); err != nil {
+			return err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inserts++
+	return f.insertLocked(l)
+}
+
+func (f *fakeChains) insertLocked(l database.TamperLog) error {
+	if f.chains == nil {
+		f.chains = make(map[string][]database.TamperLog)
+	}
+	for _, existing := range f.chains[l.ChainID] {
+		if existing.Seq == l.Seq || existing.PrevHash == l.PrevHash {
+			return database.ErrTamperLogConflict
+		}
+	}
+	f.chains[l.ChainID] = append(f.chains[l.ChainID], l)
+	return nil
+}
+
+// rival appends a record the way another instance would
+func (f *fakeChains) rival(chainID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l := database.TamperLog{ID: bson.NewObjectID(), ChainID: chainID, ParkingLotID: chainID, Seq: 1, PrevHash: GenesisHash, HashVersion: CurrentHashVersion}
+	l.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	if logs := f.chains[chainID]; len(logs) > 0 {
+		l.Seq, l.PrevHash = logs[len(logs)-1].Seq+1, logs[len(logs)-1].Hash
+	}
+	l.Hash = Hash(l)
+	f.insertLocked(l)
+}
+
+func entry(lot, vehicle string) database.TamperLog {
+	return database.TamperLog{ParkingLotID: lot, VehicleNo: vehicle, VehicleType: "CAR", Action: "ENTRY"}
+}
+
+func TestAppendAssignsSeq(t *testing.T) {
+	other := "75f2b3c4d5e6f7a8b9c0d1e2"
+	store := &fakeChains{}
+	for i, lot := range []string{testChain, testChain, other, testChain, other} {
+		l, err := appendTo(store, entry(lot, "KA01AB1234"))
+		if err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+		if l.ChainID != lot {
+			t.Errorf("append %d: chainId %q, want the lot %q", i, l.ChainID, lot)
+		}
+	}
+
+	for chainID, wantLen := range map[string]int{testChain: 3, other: 2} {
+		logs := store.chains[chainID]
+		if len(logs) != wantLen {
+			t.Fatalf("chain %s has %d records, want %d", chainID, len(logs), wantLen)
+		}
+		for i, l := range logs {
+			if l.Seq != int64(i+1) {
+				t.Errorf("chain %s record %d: seq %d, want %d", chainID, i, l.Seq, i+1)
+			}
+		}
+		if r := verifyLogs(chainID, logs); !r.Valid {
+			t.Errorf("chain %s doesn't verify: %+v", chainID, r.FirstBroken)
+		}
+	}
+}
+
+func TestAppendRetriesAfterLosingARace(t *testing.T) {
+	store := &fakeChains{}
+	if _, err := appendTo(store, entry(testChain, "KA01AB0001")); err != nil {
+		t.Fatal(err)
+	}
+
+	lost := 0
+	store.beforeInsert = func(f *fakeChains, l database.TamperLog) error {
+		if lost < 2 {
+			lost++
+			f.rival(l.ChainID)
+		}
+		return nil
+	}
+	l, err := appendTo(store, entry(testChain, "KA01AB0002"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Seq != 4 || store.inserts != 4 {
+		t.Errorf("seq %d after %d inserts, want seq 4 after 4 (1 + 2 lost + 1)", l.Seq, store.inserts)
+	}
+	if r := verifyLogs(testChain, store.chains[testChain]); !r.Valid {
+		t.Errorf("chain forked: %+v", r.FirstBroken)
+	}
+}
+
+func TestAppendGivesUp(t *testing.T) {
+	store := &fakeChains{beforeInsert: func(f *fakeChains, l database.TamperLog) error {
+		f.rival(l.ChainID)
+		return nil
+	}}
+	if _, err := appendTo(store, entry(testChain, "KA01AB0001")); !errors.Is(err, ErrAppendContention) {
+		t.Fatalf("err = %v, want %v", err, ErrAppendContention)
+	}
+	if store.inserts != maxAppendAttempts {
+		t.Errorf("%d inserts, want %d", store.inserts, maxAppendAttempts)
+	}
+}
+
+func TestAppendReturnsOtherErrors(t *testing.T) {
+	failed := errors.New("connection reset")
+	store := &fakeChains{beforeInsert: func(*fakeChains, database.TamperLog) error { return failed }}
+	if _, err := appendTo(store, entry(testChain, "KA01AB0001")); !errors.Is(err, failed) {
+		t.Fatalf("err = %v, want %v", err, failed)
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	store := &fakeChains{}
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := appendTo(store, entry(testChain, "KA01AB1234")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	logs := store.chains[testChain]
+	if len(logs) != 20 {
+		t.Fatalf("%d records, want 20", len(logs))
+	}
+	if r := verifyLogs(testChain, logs); !r.Valid {
+		t.Errorf("chain forked: %+v", r.FirstBroken)
+	}
+}
@@ -0,0 +1,179 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Upper bound on leaves per batch, keeping batch documents well under
+// MongoDB's document size limit
+const maxBatchSize = 10000
+
+// Batches cover fixed windows of CreatedAt. A window is sealed once it has
+// been over for batchSettle, so appends in flight at its end make it in.
+const (
+	batchWindow = checkpointInterval
+	batchSettle = 1 * time.Minute
+)
+
+// SealBatches seals every finished window's unbatched records into Merkle
+// batches and chains their roots. A window with more than maxBatchSize
+// records gets several batches; a record that somehow arrives after its
+// window was sealed gets a later batch for the same window.
+func SealBatches() ([]database.TamperBatch, error) {
+	if err := finishLastBatch(); err != nil {
+		return nil, err
+	}
+
+	var sealed []database.TamperBatch
+	for {
+		b, err := sealBatch(time.Now())
+		if err != nil || b == nil {
+			return sealed, err
+		}
+		sealed = append(sealed, *b)
+	}
+}
+
+// finishLastBatch marks the newest batch's records, in case whoever sealed
+// it stopped between storing the batch and marking them. Without this they
+// would be sealed a second time.
+func finishLastBatch() error {
+	last, err := database.GetLastTamperBatch()
+	if err != nil || last == nil {
+		return err
+	}
+	return database.MarkTamperLogsBatched(last.LogIDs, last.Seq)
+}
+
+func sealBatch(now time.Time) (*database.TamperBatch, error) {
+	oldest, err := database.GetOldestUnbatchedTamperLog()
+	if err != nil || oldest == nil {
+		return nil, err
+	}
+	from := oldest.CreatedAt.Truncate(batchWindow)
+	to := from.Add(batchWindow)
+	if now.Before(to.Add(batchSettle)) {
+		return nil, nil
+	}
+
+	logs, err := database.GetUnbatchedTamperLogs(from, to, maxBatchSize)
+	if err != nil || len(logs) == 0 {
+		return nil, err
+	}
+	last, err := database.GetLastTamperBatch()
+	if err != nil {
+		return nil, err
+	}
+
+	b := database.TamperBatch{
+		Seq:       1,
+		From:      from,
+		To:        to,
+		Size:      len(logs),
+		PrevHash:  GenesisHash,
+		CreatedAt: now.UTC().Truncate(time.Millisecond),
+	}
+	if last != nil {
+		b.Seq = last.Seq + 1
+		b.PrevHash = last.Hash
+	}
+	for _, l := range logs {
+		b.LogIDs = append(b.LogIDs, l.ID)
+		b.Leaves = append(b.Leaves, l.Hash)
+	}
+	b.Root = MerkleRoot(b.Leaves)
+	b.Hash = BatchHash(b)
+	b.KeyID, b.Signature = sign(signedBatch, b.Hash)
+
+	// Another instance sealed this seq first; it will mark these records,
+	// or the next finishLastBatch will, so leave them
+	err = database.InsertTamperBatch(b)
+	if errors.Is(err, database.ErrTamperLogConflict) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.MarkTamperLogsBatched(b.LogIDs, b.Seq); err != nil {
+		return nil, err
+	}
+	log.Printf("Tamper batch %d sealed %d records from %s, root %s", b.Seq, b.Size, from.Format(time.RFC3339), b.Root)
+	return &b, nil
+}
+
+// BatchHash chains batch roots using the same length-prefixed encoding as
+// canonicalHash
+func BatchHash(b database.TamperBatch) string {
+	h := sha256.New()
+	writeField := func(v string) { writeLengthPrefixed(h, v) }
+
+	writeField("parkproof/tamper-batch/v1")
+	writeField(strconv.FormatInt(b.Seq, 10))
+	writeField(b.From.UTC().Format(time.RFC3339Nano))
+	writeField(b.To.UTC().Format(time.RFC3339Nano))
+	writeField(strconv.Itoa(b.Size))
+	writeField(b.Root)
+	writeField(b.CreatedAt.UTC().Format(time.RFC3339Nano))
+	writeField(b.PrevHash)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type InclusionProof struct {
+	Log   database.TamperLog   `json:"log"`
+	Index int                  `json:"index"`
+	Proof []ProofStep          `json:"proof"`
+	Batch database.TamperBatch `json:"batch"` // without leaves
+}
+
+var ErrNotBatched = errors.New("tamper log: record not sealed into a batch yet")
+
+// Prove builds the inclusion proof of one record in its batch's Merkle root.
+// It returns nil if there is no such record.
+func Prove(id bson.ObjectID) (*InclusionProof, error) {
+	l, err := database.GetTamperLogByID(id)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	if l.BatchSeq == 0 {
+		return nil, ErrNotBatched
+	}
+
+	b, err := database.GetTamperBatch(l.BatchSeq)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, ErrNotBatched
+	}
+
+	index := -1
+	for i, logID := range b.LogIDs {
+		if logID == l.ID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, ErrNotBatched
+	}
+
+	p := &InclusionProof{
+		Log:   *l,
+		Index: index,
+		Proof: MerkleProof(b.Leaves, index),
+		Batch: *b,
+	}
+	p.Batch.LogIDs = nil
+	p.Batch.Leaves = nil
+	return p, nil
+}
@@ -0,0 +1,458 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Bundle formats. Version 1 bundles anchored to their own first record and
+// carried no checkpoint; they still verify, with only the checks they allow.
+const (
+	BundleFormat   = "parkproof-audit-bundle/v2"
+	bundleFormatV1 = "parkproof-audit-bundle/v1"
+)
+
+// Bundles are meant to be carried around and checked by hand; keep them to a
+// size a laptop can open
+const maxBundleRecords = 100000
+
+var ErrBundleTooLarge = fmt.Errorf("tamper bundle: more than %d records in range, narrow the dates", maxBundleRecords)
+
+// BundleVerifierDescription tells an auditor how to check a bundle without
+// ParkProof's code or database
+const BundleVerifierDescription = `To verify this bundle offline:
+1. Records are in chain order. Each record's chainId and parkingLotId must
+   both equal the bundle's parkingLotId. For each record compute its hash:
+   - hashVersion 2: SHA-256 over these fields, each written as a 4-byte
+     big-endian length followed by its UTF-8 bytes: "parkproof/tamper-log/v2",
+     hashVersion, id, chainId, seq, vehicleNo, vehicleType, parkingLotId,
+     action, entryExitTime, createdAt (both RFC 3339 in UTC, nanosecond
+     precision with trailing zeros dropped), prevHash. Numbers are written
+     in decimal.
+   - hashVersion 1: as version 2 with tag "parkproof/tamper-log/v1" and
+     without chainId.
+   - hashVersion 0 (legacy): SHA-256 of vehicleNo + vehicleType +
+     parkingLotId + entryExitTime (Go time.Time.String() in UTC) + prevHash.
+   Lowercase hex of the digest must equal "hash".
+2. anchor.record is the lot's last record created before "from" (absent if
+   there is none, in which case anchor.prevHash is "0" and anchor.seq 0).
+   Check its hash as in step 1; anchor.prevHash must equal it. Then walk
+   records followed by following: the first one's prevHash must equal
+   anchor.prevHash, each later one's prevHash the hash of the one before,
+   with seq increasing by exactly one. Records must be created in
+   [from, to) and following at or after "to". This proves no record in the
+   range was removed, inserted or reordered.
+3. checkpoint commits to the head of every chain when it was made. Its hash
+   is SHA-256 over "parkproof/tamper-checkpoint/v1", seq, createdAt, the
+   number of heads, then chainId, seq and hash of each head, then prevHash,
+   in the encoding of step 1. Its head for this lot must be a record walked
+   in step 2 with the same seq and hash; a head past the last record walked
+   means records were dropped from the end. Records after the head (made
+   after the checkpoint) aren't covered by it.
+4. For each proof, start from leaf = SHA-256(0x00 || record hash as ASCII
+   hex). For each step, node = SHA-256(0x01 || sibling || node) if side is
+   "left", else SHA-256(0x01 || node || sibling), siblings hex-decoded. The
+   result must equal the root of the batch with the given seq.
+5. Each batch hash is SHA-256 over "parkproof/tamper-batch/v1", seq, from,
+   to, size, root, createdAt, prevHash in the encoding of step 1.
+6. If keys is not empty, or an earlier seal is signed, the checkpoint and
+   each batch must be signed. Signatures are Ed25519 (base64) over the bytes
+   "parkproof/signature/v1\n" + "checkpoint" or "batch" + "\n" + the hash,
+   by the key in keys with the matching keyId. Check that key against the
+   one published by MCD at /.well-known/parkproof-tamper-keys, not just
+   against this file.
+7. legacyRecords are the lot's records from before each lot had its own
+   chain. Their links run through other lots' records, so only their hashes
+   (step 1, with chainId empty) and inclusion proofs can be checked.`
+
+type BundleAnchor struct {
+	PrevHash string              `json:"prevHash"`         // what the first record must link to
+	Seq      int64               `json:"seq"`              // seq of the anchor record, 0 for genesis
+	LogID    string              `json:"logId,omitempty"`  // the anchor record itself, if any
+	Record   *database.TamperLog `json:"record,omitempty"` // the last record before the range
+}
+
+type BundleProof struct {
+	LogID    string      `json:"logId"`
+	BatchSeq int64       `json:"batchSeq"`
+	Index    int         `json:"index"`
+	Proof    []ProofStep `json:"proof"`
+}
+
+// Bundle is a self-contained extract of one lot's chain for a date range
+type Bundle struct {
+	Format       string                     `json:"format"`
+	ParkingLotID string                     `json:"parkingLotId"`
+	From         time.Time                  `json:"from"`
+	To           time.Time                  `json:"to"`
+	GeneratedAt  time.Time                  `json:"generatedAt"`
+	Anchor       BundleAnchor               `json:"anchor"`
+	Records      []database.TamperLog       `json:"records"`
+	Following    []database.TamperLog       `json:"following"`            // after the range, up to the checkpoint's head
+	Checkpoint   *database.TamperCheckpoint `json:"checkpoint,omitempty"` // first made at or after To, else the latest
+	Legacy       []database.TamperLog       `json:"legacyRecords"`        // from the shared pre-split chain
+	Proofs       []BundleProof              `json:"proofs"`               // records not yet sealed have none
+	Batches      []database.TamperBatch     `json:"batches"`              // without leaves
+	Keys         []PublicKey                `json:"keys"`
+	Verifier     string                     `json:"verifier"`
+}
+
+// bundleStore is where Export reads a lot's chain, its seals and the legacy
+// chain from
+type bundleStore interface {
+	LogsInRange(chainID string, from, to time.Time, limit int64) ([]database.TamperLog, error)
+	LegacyLogsForLot(lotID string, from, to time.Time, limit int64) ([]database.TamperLog, error)
+	LogBySeq(chainID string, seq int64) (*database.TamperLog, error)
+	LastLogBefore(chainID string, t time.Time) (*database.TamperLog, error)
+	LogsAfterSeq(chainID string, after, through int64, limit int64) ([]database.TamperLog, error)
+	CheckpointCovering(t time.Time) (*database.TamperCheckpoint, error)
+	Batch(seq int64) (*database.TamperBatch, error)
+}
+
+type dbBundleStore struct{}
+
+func (dbBundleStore) LogsInRange(chainID string, from, to time.Time, limit int64) ([]database.TamperLog, error) {
+	return database.GetTamperLogsInRange(chainID, from, to, limit)
+}
+
+func (dbBundleStore) LegacyLogsForLot(lotID string, from, to time.Time, limit int64) ([]database.TamperLog, error) {
+	return database.GetLegacyTamperLogsForLot(lotID, from, to, limit)
+}
+
+func (dbBundleStore) LogBySeq(chainID string, seq int64) (*database.TamperLog, error) {
+	return database.GetTamperLogBySeq(chainID, seq)
+}
+
+func (dbBundleStore) LastLogBefore(chainID string, t time.Time) (*database.TamperLog, error) {
+	return database.GetLastTamperLogBefore(chainID, t)
+}
+
+func (dbBundleStore) LogsAfterSeq(chainID string, after, through int64, limit int64) ([]database.TamperLog, error) {
+	return database.GetTamperLogsAfterSeq(chainID, after, through, limit)
+}
+
+func (dbBundleStore) CheckpointCovering(t time.Time) (*database.TamperCheckpoint, error) {
+	return database.GetTamperCheckpointCovering(t)
+}
+
+func (dbBundleStore) Batch(seq int64) (*database.TamperBatch, error) {
+	return database.GetTamperBatch(seq)
+}
+
+// Export builds the audit bundle for a parking lot's records created in
+// [from, to)
+func Export(lotID string, from, to time.Time) (*Bundle, error) {
+	return exportFrom(dbBundleStore{}, lotID, from, to)
+}
+
+func exportFrom(store bundleStore, lotID string, from, to time.Time) (*Bundle, error) {
+	if lotID == "" {
+		return nil, errors.New("tamper bundle: parking lot is required")
+	}
+	if !from.Before(to) {
+		return nil, errors.New("tamper bundle: from must be before to")
+	}
+
+	logs, err := store.LogsInRange(lotID, from, to, maxBundleRecords+1)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := store.LegacyLogsForLot(lotID, from, to, maxBundleRecords+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs)+len(legacy) > maxBundleRecords {
+		return nil, ErrBundleTooLarge
+	}
+
+	b := &Bundle{
+		Format:       BundleFormat,
+		ParkingLotID: lotID,
+		From:         from,
+		To:           to,
+		GeneratedAt:  time.Now().UTC(),
+		Anchor:       BundleAnchor{PrevHash: GenesisHash},
+		Records:      append([]database.TamperLog{}, logs...),
+		Following:    []database.TamperLog{},
+		Legacy:       legacy,
+		Proofs:       []BundleProof{},
+		Batches:      []database.TamperBatch{},
+		Keys:         PublicKeys(),
+		Verifier:     BundleVerifierDescription,
+	}
+
+	var anchor *database.TamperLog
+	if len(logs) > 0 {
+		if logs[0].Seq > 1 {
+			anchor, err = store.LogBySeq(lotID, logs[0].Seq-1)
+		}
+	} else {
+		anchor, err = store.LastLogBefore(lotID, from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	lastSeq := int64(0)
+	if anchor != nil {
+		b.Anchor = BundleAnchor{PrevHash: anchor.Hash, Seq: anchor.Seq, LogID: anchor.ID.Hex(), Record: anchor}
+		lastSeq = anchor.Seq
+	}
+	if len(logs) > 0 {
+		lastSeq = logs[len(logs)-1].Seq
+	}
+
+	// The checkpoint after the range pins down where the chain was, and the
+	// records up to its head show the range ends where the chain says
+	cp, err := store.CheckpointCovering(to)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil {
+		b.Checkpoint = cp
+		if head, ok := chainHead(cp, lotID); ok && head.Seq > lastSeq {
+			room := int64(maxBundleRecords - len(logs) - len(legacy))
+			following, err := store.LogsAfterSeq(lotID, lastSeq, head.Seq, room+1)
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(following)) > room {
+				return nil, ErrBundleTooLarge
+			}
+			b.Following = following
+		}
+	}
+
+	batches := make(map[int64]*database.TamperBatch)
+	for _, l := range append(logs, legacy...) {
+		if l.BatchSeq == 0 {
+			continue
+		}
+		batch, ok := batches[l.BatchSeq]
+		if !ok {
+			batch, err = store.Batch(l.BatchSeq)
+			if err != nil {
+				return nil, err
+			}
+			batches[l.BatchSeq] = batch
+			if batch != nil {
+				stripped := *batch
+				stripped.LogIDs = nil
+				stripped.Leaves = nil
+				b.Batches = append(b.Batches, stripped)
+			}
+		}
+		if batch == nil {
+			continue
+		}
+		for i, id := range batch.LogIDs {
+			if id == l.ID {
+				b.Proofs = append(b.Proofs, BundleProof{
+					LogID:    l.ID.Hex(),
+					BatchSeq: batch.Seq,
+					Index:    i,
+					Proof:    MerkleProof(batch.Leaves, i),
+				})
+				break
+			}
+		}
+	}
+	sort.Slice(b.Batches, func(i, j int) bool { return b.Batches[i].Seq < b.Batches[j].Seq })
+	return b, nil
+}
+
+// chainHead returns a checkpoint's head for one chain
+func chainHead(cp *database.TamperCheckpoint, chainID string) (database.ChainHead, bool) {
+	for _, head := range cp.Heads {
+		if head.ChainID == chainID {
+			return head, true
+		}
+	}
+	return database.ChainHead{}, false
+}
+
+// BundleReport is the result of checking a bundle offline
+type BundleReport struct {
+	Valid         bool     `json:"valid"`
+	Records       int      `json:"records"`
+	Legacy        int      `json:"legacyRecords"`
+	Proven        int      `json:"proven"`   // records with a valid inclusion proof
+	Unsealed      int      `json:"unsealed"` // records with no proof yet
+	CheckpointSeq int64    `json:"checkpointSeq,omitempty"`
+	Uncovered     int      `json:"uncovered"` // records made after the checkpoint, so it can't vouch for them
+	Problems      []string `json:"problems"`
+}
+
+// VerifyBundle checks a bundle using only its own contents, following
+// BundleVerifierDescription. Whether the bundle's keys are the real server
+// keys has to be checked separately.
+func VerifyBundle(b Bundle) BundleReport {
+	r := BundleReport{Records: len(b.Records), Legacy: len(b.Legacy), Problems: []string{}}
+	problem := func(format string, args ...any) {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	}
+
+	v1 := b.Format == bundleFormatV1
+	if b.Format != BundleFormat && !v1 {
+		problem("unknown bundle format %q", b.Format)
+	}
+
+	checkRecord := func(what string, i int, l database.TamperLog, chainID string) {
+		if l.ChainID != chainID {
+			problem("%s %d (%s) belongs to chain %q", what, i, l.ID.Hex(), l.ChainID)
+		} else if l.ParkingLotID != b.ParkingLotID {
+			problem("%s %d (%s) is for parking lot %q", what, i, l.ID.Hex(), l.ParkingLotID)
+		}
+		if h := Hash(l); h != l.Hash {
+			problem("%s %d (%s) hash mismatch: computed %s, stored %s", what, i, l.ID.Hex(), h, l.Hash)
+		}
+	}
+
+	prevHash := b.Anchor.PrevHash
+	prevSeq := b.Anchor.Seq
+	walked := make(map[int64]string) // seq -> hash of every record walked
+	if a := b.Anchor.Record; a != nil {
+		checkRecord("anchor", 0, *a, b.ParkingLotID)
+		if a.Hash != b.Anchor.PrevHash || a.Seq != b.Anchor.Seq {
+			problem("anchor record doesn't match anchor prevHash and seq")
+		}
+		if !a.CreatedAt.Before(b.From) {
+			problem("anchor record (%s) was created inside the range", a.ID.Hex())
+		}
+		walked[a.Seq] = a.Hash
+	} else if !v1 && (b.Anchor.PrevHash != GenesisHash || b.Anchor.Seq != 0) {
+		problem("anchor record is missing")
+	}
+
+	walk := func(what string, logs []database.TamperLog, inRange bool) {
+		for i, l := range logs {
+			checkRecord(what, i, l, b.ParkingLotID)
+			if l.PrevHash != prevHash {
+				problem("%s %d (%s) does not link to the previous record", what, i, l.ID.Hex())
+			}
+			if prevSeq > 0 && l.Seq != prevSeq+1 {
+				problem("%s %d (%s) has seq %d, expected %d", what, i, l.ID.Hex(), l.Seq, prevSeq+1)
+			}
+			if in := !l.CreatedAt.Before(b.From) && l.CreatedAt.Before(b.To); in != inRange {
+				problem("%s %d (%s) was created at %s, outside where it belongs", what, i, l.ID.Hex(), l.CreatedAt.Format(time.RFC3339))
+			}
+			prevHash = l.Hash
+			prevSeq = l.Seq
+			walked[l.Seq] = l.Hash
+		}
+	}
+	walk("record", b.Records, true)
+	walk("following record", b.Following, false)
+
+	byID := make(map[string]database.TamperLog)
+	for _, l := range b.Records {
+		byID[l.ID.Hex()] = l
+	}
+	for i, l := range b.Legacy {
+		checkRecord("legacy record", i, l, database.LegacyChainID)
+		byID[l.ID.Hex()] = l
+	}
+
+	if cp := b.Checkpoint; cp != nil {
+		r.CheckpointSeq = cp.Seq
+		if h := CheckpointHash(*cp); h != cp.Hash {
+			problem("checkpoint %d hash mismatch: computed %s, stored %s", cp.Seq, h, cp.Hash)
+		}
+		sigs := signatureCheck{keys: b.Keys, kind: signedCheckpoint}
+		if issue := sigs.check(cp.Hash, cp.KeyID, cp.Signature); issue != nil {
+			problem("checkpoint %d signature: %s", cp.Seq, issue.Kind)
+		}
+
+		// No head is only right if the lot's chain started after the
+		// checkpoint was made
+		head, ok := chainHead(cp, b.ParkingLotID)
+		if !ok {
+			head.Seq = b.Anchor.Seq
+			first := b.Anchor.Record
+			if first == nil && len(b.Records) > 0 {
+				first = &b.Records[0]
+			}
+			if first != nil && first.CreatedAt.Before(cp.CreatedAt) {
+				problem("checkpoint %d has no head for this lot", cp.Seq)
+			}
+		}
+		switch {
+		case !ok:
+		case head.Seq > prevSeq:
+			problem("checkpoint %d head is seq %d but the bundle ends at seq %d: records are missing", cp.Seq, head.Seq, prevSeq)
+		case walked[head.Seq] != head.Hash && head.Seq >= b.Anchor.Seq:
+			problem("checkpoint %d head (seq %d) doesn't match the bundle's record", cp.Seq, head.Seq)
+		}
+		for _, l := range b.Records {
+			if l.Seq > head.Seq {
+				r.Uncovered++
+			}
+		}
+	} else if !v1 {
+		r.Uncovered = len(b.Records)
+	}
+
+	sigs := signatureCheck{keys: b.Keys, kind: signedBatch}
+	batches := make(map[int64]database.TamperBatch)
+	for _, batch := range b.Batches {
+		if h := BatchHash(batch); h != batch.Hash {
+			problem("batch %d hash mismatch: computed %s, stored %s", batch.Seq, h, batch.Hash)
+		}
+		if issue := sigs.check(batch.Hash, batch.KeyID, batch.Signature); issue != nil {
+			if issue.Kind == IssueUnsigned {
+				problem("batch %d is not signed", batch.Seq)
+			} else {
+				problem("batch %d signature does not verify", batch.Seq)
+			}
+		}
+		batches[batch.Seq] = batch
+	}
+
+	proven := make(map[string]bool)
+	hasProof := make(map[string]bool)
+	for _, p := range b.Proofs {
+		hasProof[p.LogID] = true
+		l, ok := byID[p.LogID]
+		if !ok {
+			problem("proof for unknown record %s", p.LogID)
+			continue
+		}
+		batch, ok := batches[p.BatchSeq]
+		if !ok {
+			problem("proof for record %s refers to missing batch %d", p.LogID, p.BatchSeq)
+			continue
+		}
+		if !VerifyMerkleProof(l.Hash, p.Proof, batch.Root) {
+			problem("inclusion proof for record %s does not reach batch %d root", p.LogID, p.BatchSeq)
+			continue
+		}
+		proven[p.LogID] = true
+	}
+	r.Proven = len(proven)
+	for id := range byID {
+		if !hasProof[id] {
+			r.Unsealed++
+		}
+	}
+
+	r.Valid = len(r.Problems) == 0
+	return r
+}
+
+// ParseRangeTime reads a range bound given as RFC 3339 or a bare date. A bare
+// date used as the end of a range covers that whole day.
+func ParseRangeTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
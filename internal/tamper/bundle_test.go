@@ -0,0 +1,386 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBundleStore serves one lot's chain, the legacy chain and their seals
+// from memory, answering each query the way the database would
+type fakeBundleStore struct {
+	logs        []database.TamperLog // testChain, in chain order
+	legacy      []database.TamperLog
+	checkpoints []database.TamperCheckpoint
+	batches     []database.TamperBatch
+}
+
+func (f *fakeBundleStore) LogsInRange(chainID string, from, to time.Time, limit int64) ([]database.TamperLog, error) {
+	var logs []database.TamperLog
+	for _, l := range f.logs {
+		if l.ChainID == chainID && !l.CreatedAt.Before(from) && l.CreatedAt.Before(to) && int64(len(logs)) < limit {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (f *fakeBundleStore) LegacyLogsForLot(lotID string, from, to time.Time, limit int64) ([]database.TamperLog, error) {
+	logs := []database.TamperLog{}
+	for _, l := range f.legacy {
+		if l.ParkingLotID == lotID && !l.CreatedAt.Before(from) && l.CreatedAt.Before(to) && int64(len(logs)) < limit {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (f *fakeBundleStore) LogBySeq(chainID string, seq int64) (*database.TamperLog, error) {
+	for _, l := range f.logs {
+		if l.ChainID == chainID && l.Seq == seq {
+			return &l, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeBundleStore) LastLogBefore(chainID string, t time.Time) (*database.TamperLog, error) {
+	var last *database.TamperLog
+	for _, l := range f.logs {
+		if l.ChainID == chainID && l.CreatedAt.Before(t) {
+			last = &l
+		}
+	}
+	return last, nil
+}
+
+func (f *fakeBundleStore) LogsAfterSeq(chainID string, after, through int64, limit int64) ([]database.TamperLog, error) {
+	var logs []database.TamperLog
+	for _, l := range f.logs {
+		if l.ChainID == chainID && l.Seq > after && l.Seq <= through && int64(len(logs)) < limit {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (f *fakeBundleStore) CheckpointCovering(t time.Time) (*database.TamperCheckpoint, error) {
+	for _, cp := range f.checkpoints {
+		if !cp.CreatedAt.Before(t) {
+			return &cp, nil
+		}
+	}
+	if len(f.checkpoints) == 0 {
+		return nil, nil
+	}
+	return &f.checkpoints[len(f.checkpoints)-1], nil
+}
+
+func (f *fakeBundleStore) Batch(seq int64) (*database.TamperBatch, error) {
+	for _, b := range f.batches {
+		if b.Seq == seq {
+			return &b, nil
+		}
+	}
+	return nil, nil
+}
+
+// bundleFixture is testChain with ten records created a minute apart from
+// 08:00, three legacy records for the same lot, a batch sealing records 1-6
+// and the legacy ones, and a checkpoint at 08:08:30 whose head is record 9.
+// Seals are signed with whatever key is loaded.
+func bundleFixture() *fakeBundleStore {
+	f := &fakeBundleStore{
+		logs:   buildChain(testChain, 10, CurrentHashVersion),
+		legacy: buildChain(database.LegacyChainID, 3, 0),
+	}
+	start := f.logs[0].CreatedAt
+
+	batch := database.TamperBatch{Seq: 1, From: start, To: start.Add(batchWindow), PrevHash: GenesisHash, CreatedAt: start.Add(20 * time.Minute)}
+	seal := func(l *database.TamperLog) {
+		l.BatchSeq = batch.Seq
+		batch.LogIDs = append(batch.LogIDs, l.ID)
+		batch.Leaves = append(batch.Leaves, l.Hash)
+	}
+	for i := range f.legacy {
+		seal(&f.legacy[i])
+	}
+	for i := range 6 {
+		seal(&f.logs[i])
+	}
+	batch.Size = len(batch.Leaves)
+	batch.Root = MerkleRoot(batch.Leaves)
+	batch.Hash = BatchHash(batch)
+	batch.KeyID, batch.Signature = sign(signedBatch, batch.Hash)
+	f.batches = append(f.batches, batch)
+
+	head := f.logs[8]
+	cp := database.TamperCheckpoint{
+		Seq:       1,
+		Heads:     []database.ChainHead{{ChainID: testChain, Seq: head.Seq, Hash: head.Hash}},
+		PrevHash:  GenesisHash,
+		CreatedAt: head.CreatedAt.Add(30 * time.Second),
+	}
+	cp.Hash = CheckpointHash(cp)
+	cp.KeyID, cp.Signature = sign(signedCheckpoint, cp.Hash)
+	f.checkpoints = append(f.checkpoints, cp)
+	return f
+}
+
+// roundTrip exports a bundle and reads it back as an auditor would get it
+func roundTrip(t *testing.T, store bundleStore, from, to time.Time) Bundle {
+	t.Helper()
+	b, err := exportFrom(store, testChain, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Bundle
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	resetKeys(t)
+	store := bundleFixture()
+	start := store.logs[0].CreatedAt
+	b := roundTrip(t, store, start.Add(2*time.Minute), start.Add(7*time.Minute))
+
+	if b.Anchor.Seq != 2 || b.Anchor.Record == nil || b.Anchor.PrevHash != store.logs[1].Hash {
+		t.Errorf("anchor = seq %d, want record 2", b.Anchor.Seq)
+	}
+	if len(b.Records) != 5 || b.Records[0].Seq != 3 {
+		t.Errorf("%d records from seq %d, want 5 from seq 3", len(b.Records), b.Records[0].Seq)
+	}
+	if len(b.Following) != 2 || b.Following[1].Seq != 9 {
+		t.Errorf("%d following records, want 2 up to the checkpoint head (seq 9)", len(b.Following))
+	}
+	if len(b.Legacy) != 1 {
+		t.Errorf("%d legacy records, want the one created in range", len(b.Legacy))
+	}
+	if len(b.Batches) != 1 || b.Batches[0].Leaves != nil || b.Batches[0].LogIDs != nil {
+		t.Errorf("batches = %+v, want batch 1 without leaves", b.Batches)
+	}
+
+	r := VerifyBundle(b)
+	want := BundleReport{Valid: true, Records: 5, Legacy: 1, Proven: 5, Unsealed: 1, CheckpointSeq: 1, Problems: []string{}}
+	if !r.Valid || r.Records != want.Records || r.Legacy != want.Legacy || r.Proven != want.Proven ||
+		r.Unsealed != want.Unsealed || r.CheckpointSeq != want.CheckpointSeq || r.Uncovered != want.Uncovered {
+		t.Errorf("report = %+v, want %+v", r, want)
+	}
+}
+
+func TestExportRejectsBadRange(t *testing.T) {
+	at := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name     string
+		lot      string
+		from, to time.Time
+	}{
+		{"no lot", "", at, at.Add(time.Hour)},
+		{"empty range", testChain, at, at},
+		{"backwards", testChain, at.Add(time.Hour), at},
+	} {
+		if _, err := exportFrom(&fakeBundleStore{}, tt.lot, tt.from, tt.to); err == nil {
+			t.Errorf("%s: exported", tt.name)
+		}
+	}
+}
+
+func TestVerifyBundle(t *testing.T) {
+	signer := testSeed("server")
+	tests := []struct {
+		name     string
+		signed   bool
+		from, to time.Duration // after 08:00
+		mutate   func(b *Bundle)
+		want     string // in one of the problems, "" for a valid bundle
+	}{
+		{name: "valid", from: 2 * time.Minute, to: 7 * time.Minute},
+		{name: "valid and signed", signed: true, from: 2 * time.Minute, to: 7 * time.Minute},
+		{
+			name: "range after the last record",
+			from: 20 * time.Minute, to: 30 * time.Minute,
+		},
+		{
+			name: "range from the start of the chain",
+			to:   3 * time.Minute,
+		},
+		{
+			name: "version 1 bundle without anchor or checkpoint",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Format = bundleFormatV1
+				b.Anchor = BundleAnchor{PrevHash: b.Records[0].PrevHash}
+				b.Checkpoint = nil
+				b.Following = nil
+			},
+		},
+		{
+			name: "edited record",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Records[1].VehicleNo = "KA01ZZ9999" },
+			want:   "hash mismatch",
+		},
+		{
+			name: "edited and rehashed record",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Records[1].VehicleNo = "KA01ZZ9999"
+				rehash(&b.Records[1])
+			},
+			want: "does not link to the previous record",
+		},
+		{
+			name: "deleted record",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Records = append(b.Records[:2], b.Records[3:]...) },
+			want:   "does not link to the previous record",
+		},
+		{
+			name: "edited legacy record",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Legacy[0].VehicleType = "BIKE" },
+			want:   "legacy record 0",
+		},
+		{
+			name: "record moved into another lot",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.ParkingLotID = "75f2b3c4d5e6f7a8b9c0d1e2" },
+			want:   "belongs to chain",
+		},
+		{
+			name: "missing anchor",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Anchor.Record = nil },
+			want:   "anchor record is missing",
+		},
+		{
+			name: "anchor that isn't the record before",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Anchor = BundleAnchor{PrevHash: GenesisHash}
+			},
+			want: "record 0 (",
+		},
+		{
+			name: "anchor created inside the range",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.From = b.Anchor.Record.CreatedAt },
+			want:   "was created inside the range",
+		},
+		{
+			name: "ends before the checkpoint head",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Following = b.Following[:1] },
+			want:   "records are missing",
+		},
+		{
+			name: "last records dropped with their following records",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Records = b.Records[:3]
+				b.Following = nil
+			},
+			want: "records are missing",
+		},
+		{
+			name: "checkpoint head rewritten to match an edited chain",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Checkpoint.Heads[0].Hash = b.Records[0].Hash
+				b.Checkpoint.Hash = CheckpointHash(*b.Checkpoint)
+			},
+			want: "doesn't match the bundle's record",
+		},
+		{
+			name: "edited checkpoint",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Checkpoint.Heads[0].Seq = 8 },
+			want:   "checkpoint 1 hash mismatch",
+		},
+		{
+			name: "checkpoint without this lot",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Checkpoint.Heads = nil
+				b.Checkpoint.Hash = CheckpointHash(*b.Checkpoint)
+			},
+			want: "has no head for this lot",
+		},
+		{
+			name: "proof for another record",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Proofs[1].LogID = b.Proofs[2].LogID },
+			want:   "does not reach batch 1 root",
+		},
+		{
+			name: "batch left out",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Batches = nil },
+			want:   "refers to missing batch 1",
+		},
+		{
+			name:   "signatures stripped",
+			signed: true, from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Batches[0].KeyID, b.Batches[0].Signature = "", ""
+			},
+			want: "batch 1 is not signed",
+		},
+		{
+			name:   "batch signature replayed on the checkpoint",
+			signed: true, from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) {
+				b.Checkpoint.KeyID, b.Checkpoint.Signature = b.Batches[0].KeyID, b.Batches[0].Signature
+			},
+			want: "checkpoint 1 signature",
+		},
+		{
+			name: "unknown format",
+			from: 2 * time.Minute, to: 7 * time.Minute,
+			mutate: func(b *Bundle) { b.Format = "parkproof-audit-bundle/v9" },
+			want:   "unknown bundle format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.signed {
+				useKeys(t, signer)
+			} else {
+				resetKeys(t)
+			}
+			store := bundleFixture()
+			start := store.logs[0].CreatedAt
+			b := roundTrip(t, store, start.Add(tt.from), start.Add(tt.to))
+			if tt.mutate != nil {
+				tt.mutate(&b)
+			}
+
+			r := VerifyBundle(b)
+			if tt.want == "" {
+				if !r.Valid {
+					t.Errorf("valid bundle rejected: %q", r.Problems)
+				}
+				return
+			}
+			if r.Valid {
+				t.Fatalf("accepted, want a problem containing %q", tt.want)
+			}
+			found := false
+			for _, p := range r.Problems {
+				found = found || strings.Contains(p, tt.want)
+			}
+			if !found {
+				t.Errorf("problems %q, want one containing %q", r.Problems, tt.want)
+			}
+		})
+	}
+}
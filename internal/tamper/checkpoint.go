@@ -0,0 +1,147 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	checkpointInterval = 15 * time.Minute
+
+	// One replica at a time seals, checkpoints and witnesses. Two sealing
+	// at once could seal the same records twice, and every replica would
+	// pay for the same witness submissions.
+	checkpointLockName = "tamper-checkpoint"
+	checkpointLockTTL  = checkpointInterval / 2
+)
+
+// StartCheckpointScheduler periodically seals new records into Merkle
+// batches, commits the head of every lot chain into the global checkpoint
+// chain and anchors the latest checkpoints with the configured witnesses.
+// One replica at a time does it; the others skip the tick.
+func StartCheckpointScheduler() {
+	ticker := time.NewTicker(checkpointInterval)
+	go func() {
+		for range ticker.C {
+			runCheckpointTick()
+		}
+	}()
+}
+
+func runCheckpointTick() {
+	_, err := WithCheckpointLease(context.Background(), func() {
+		if _, err := SealBatches(); err != nil {
+			log.Println("Error sealing tamper batch:", err)
+		}
+		if _, err := Checkpoint(); err != nil {
+			log.Println("Error creating tamper checkpoint:", err)
+		}
+		// Witnesses the new checkpoint and any earlier one a witness
+		// failed on
+		if err := RetryWitnesses(); err != nil {
+			log.Println("Error witnessing tamper checkpoints:", err)
+		}
+	})
+	if err != nil {
+		log.Println("Error taking tamper checkpoint lock:", err)
+	}
+}
+
+// WithCheckpointLease runs fn while holding the lease the checkpoint
+// scheduler takes. It reports false without running fn if another instance
+// holds it.
+func WithCheckpointLease(ctx context.Context, fn func()) (bool, error) {
+	ok, err := database.AcquireLock(ctx, checkpointLockName, database.InstanceID, checkpointLockTTL)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer func() {
+		if err := database.ReleaseLock(ctx, checkpointLockName, database.InstanceID); err != nil {
+			log.Println("Error releasing tamper checkpoint lock:", err)
+		}
+	}()
+	fn()
+	return true, nil
+}
+
+// Checkpoint records the current heads of all chains. It returns nil if
+// nothing changed since the last checkpoint.
+func Checkpoint() (*database.TamperCheckpoint, error) {
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		heads, err := database.GetTamperChainHeads()
+		if err != nil {
+			return nil, err
+		}
+		last, err := database.GetLastTamperCheckpoint()
+		if err != nil {
+			return nil, err
+		}
+
+		cp := database.TamperCheckpoint{
+			Seq:       1,
+			Heads:     heads,
+			PrevHash:  GenesisHash,
+			CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+		}
+		if last != nil {
+			if sameHeads(last.Heads, heads) {
+				return nil, nil
+			}
+			cp.Seq = last.Seq + 1
+			cp.PrevHash = last.Hash
+		}
+		cp.Hash = CheckpointHash(cp)
+		cp.ID = bson.NewObjectID()
+		cp.KeyID, cp.Signature = sign(signedCheckpoint, cp.Hash)
+
+		err = database.InsertTamperCheckpoint(cp)
+		if errors.Is(err, database.ErrTamperLogConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Tamper checkpoint %d committed %d chain heads", cp.Seq, len(cp.Heads))
+		return &cp, nil
+	}
+	return nil, ErrAppendContention
+}
+
+// CheckpointHash uses the same length-prefixed encoding as canonicalHash
+func CheckpointHash(cp database.TamperCheckpoint) string {
+	h := sha256.New()
+	writeField := func(v string) { writeLengthPrefixed(h, v) }
+
+	writeField("parkproof/tamper-checkpoint/v1")
+	writeField(strconv.FormatInt(cp.Seq, 10))
+	writeField(cp.CreatedAt.UTC().Format(time.RFC3339Nano))
+	writeField(strconv.Itoa(len(cp.Heads)))
+	for _, head := range cp.Heads {
+		writeField(head.ChainID)
+		writeField(strconv.FormatInt(head.Seq, 10))
+		writeField(head.Hash)
+	}
+	writeField(cp.PrevHash)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sameHeads(a, b []database.ChainHead) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// GenesisHash is the PrevHash of the first record in a chain
+const GenesisHash = "0"
+
+// Hash versions stored in TamperLog.HashVersion
+const (
+	HashVersionLegacy    = 0 // concatenated fields, see legacyHash
+	HashVersionCanonical = 1 // length-prefixed encoding of every field but chainId, see canonicalHash
+	HashVersionChained   = 2 // as 1, plus chainId
+
+	CurrentHashVersion = HashVersionChained
+)
+
+// Hash computes the chain hash of a tamper log using the scheme named by its
+// HashVersion. Unknown versions hash to "" so they never verify.
+func Hash(l database.TamperLog) string {
+	switch l.HashVersion {
+	case HashVersionLegacy:
+		return legacyHash(l)
+	case HashVersionCanonical, HashVersionChained:
+		return canonicalHash(l)
+	}
+	return ""
+}
+
+// legacyHash is the original SHA256(VehicleNo + VehicleType + ParkingLotID +
+// EntryExitTime + PrevHash). It leaves out Action and is ambiguous at field
+// boundaries; it's kept only so chains written with it stay checkable.
+func legacyHash(l database.TamperLog) string {
+	// MongoDB hands times back in UTC, so hash the UTC form to get the same
+	// string on append and on verification. Records appended before the
+	// timestamp was normalised hashed time.Now().String() (local zone plus
+	// monotonic reading) and will show up as HASH_MISMATCH.
+	dataString := fmt.Sprintf("%s%s%s%s%s", l.VehicleNo, l.VehicleType, l.ParkingLotID, l.EntryExitTime.UTC().String(), l.PrevHash)
+	hash := sha256.Sum256([]byte(dataString))
+	return hex.EncodeToString(hash[:])
+}
+
+// canonicalHash is SHA256 over a domain tag followed by every field except
+// Hash itself, each as a 4-byte big-endian length and the value's bytes, in
+// a fixed order. Times are RFC 3339 in UTC so the encoding doesn't depend on
+// the server's zone or monotonic clock. Version 1 records predate chainId
+// being hashed; the verifier checks it against parkingLotId instead.
+func canonicalHash(l database.TamperLog) string {
+	h := sha256.New()
+	writeField := func(v string) { writeLengthPrefixed(h, v) }
+
+	writeField("parkproof/tamper-log/v" + strconv.Itoa(l.HashVersion))
+	writeField(strconv.Itoa(l.HashVersion))
+	writeField(l.ID.Hex())
+	if l.HashVersion >= HashVersionChained {
+		writeField(l.ChainID)
+	}
+	writeField(strconv.FormatInt(l.Seq, 10))
+	writeField(l.VehicleNo)
+	writeField(l.VehicleType)
+	writeField(l.ParkingLotID)
+	writeField(l.Action)
+	writeField(l.EntryExitTime.UTC().Format(time.RFC3339Nano))
+	writeField(l.CreatedAt.UTC().Format(time.RFC3339Nano))
+	writeField(l.PrevHash)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeLengthPrefixed writes v as a 4-byte big-endian length and its bytes
+func writeLengthPrefixed(w io.Writer, v string) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(v)))
+	w.Write(n[:])
+	io.WriteString(w, v)
+}
@@ -0,0 +1,112 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func sampleLog(version int) database.TamperLog {
+	at := time.Date(2026, 3, 14, 9, 26, 53, 589000000, time.UTC)
+	lot := "65f2b3c4d5e6f7a8b9c0d1e2"
+	return database.TamperLog{
+		ID:            bson.NewObjectIDFromTimestamp(at),
+		ChainID:       lot,
+		Seq:           42,
+		VehicleNo:     "KA01AB1234",
+		VehicleType:   "CAR",
+		ParkingLotID:  lot,
+		EntryExitTime: at,
+		HashVersion:   version,
+		PrevHash:      "ab12",
+		Action:        "ENTRY",
+		CreatedAt:     at.Add(time.Second),
+	}
+}
+
+func TestCanonicalHashCoversEveryField(t *testing.T) {
+	base := sampleLog(HashVersionChained)
+	want := canonicalHash(base)
+
+	tests := []struct {
+		name   string
+		mutate func(*database.TamperLog)
+	}{
+		{"id", func(l *database.TamperLog) { l.ID = bson.NewObjectID() }},
+		{"chain", func(l *database.TamperLog) { l.ChainID = "other" }},
+		{"seq", func(l *database.TamperLog) { l.Seq++ }},
+		{"vehicle", func(l *database.TamperLog) { l.VehicleNo = "KA01AB1235" }},
+		{"vehicle type", func(l *database.TamperLog) { l.VehicleType = "BIKE" }},
+		{"lot", func(l *database.TamperLog) { l.ParkingLotID = "other" }},
+		{"action", func(l *database.TamperLog) { l.Action = "EXIT" }},
+		{"entry time", func(l *database.TamperLog) { l.EntryExitTime = l.EntryExitTime.Add(time.Millisecond) }},
+		{"created", func(l *database.TamperLog) { l.CreatedAt = l.CreatedAt.Add(time.Nanosecond) }},
+		{"prev hash", func(l *database.TamperLog) { l.PrevHash = "ab13" }},
+		{"version", func(l *database.TamperLog) { l.HashVersion = HashVersionCanonical }},
+		// Without length prefixes these would hash the same bytes
+		{"field boundary", func(l *database.TamperLog) { l.VehicleNo, l.VehicleType = "KA01AB1234C", "AR" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := base
+			tt.mutate(&l)
+			if canonicalHash(l) == want {
+				t.Error("hash didn't change")
+			}
+		})
+	}
+}
+
+func TestCanonicalHashIgnores(t *testing.T) {
+	base := sampleLog(HashVersionChained)
+	want := canonicalHash(base)
+
+	tests := []struct {
+		name   string
+		mutate func(*database.TamperLog)
+	}{
+		{"stored hash", func(l *database.TamperLog) { l.Hash = "anything" }},
+		{"batch", func(l *database.TamperLog) { l.BatchSeq = 7 }},
+		{"time zone", func(l *database.TamperLog) {
+			ist := time.FixedZone("IST", 330*60)
+			l.EntryExitTime = l.EntryExitTime.In(ist)
+			l.CreatedAt = l.CreatedAt.In(ist)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := base
+			tt.mutate(&l)
+			if got := canonicalHash(l); got != want {
+				t.Errorf("hash changed: %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestHashVersions(t *testing.T) {
+	// Version 1 predates chainId being hashed
+	v1 := sampleLog(HashVersionCanonical)
+	moved := v1
+	moved.ChainID = "other"
+	if Hash(v1) != Hash(moved) {
+		t.Error("version 1 hash depends on chainId")
+	}
+
+	// The legacy scheme ignores the action
+	legacy := sampleLog(HashVersionLegacy)
+	exit := legacy
+	exit.Action = "EXIT"
+	if Hash(legacy) != Hash(exit) {
+		t.Error("legacy hash depends on action")
+	}
+	if Hash(legacy) == canonicalHash(legacy) {
+		t.Error("legacy records hash canonically")
+	}
+
+	if h := Hash(sampleLog(CurrentHashVersion + 1)); h != "" {
+		t.Errorf("unknown version hashed to %q, want empty", h)
+	}
+}
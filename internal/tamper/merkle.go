@@ -0,0 +1,101 @@
+package tamper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Merkle trees follow RFC 6962: leaves and interior nodes are hashed with
+// different prefixes, and a tree of n leaves splits at the largest power of
+// two below n.
+
+type ProofStep struct {
+	Hash string `json:"hash"`
+	Side string `json:"side"` // "left" or "right": where the sibling sits
+}
+
+// LeafHash is SHA256(0x00 || record hash)
+func LeafHash(recordHash string) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write([]byte(recordHash))
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// MerkleRoot returns the hex root over the given record hashes
+func MerkleRoot(recordHashes []string) string {
+	return hex.EncodeToString(merkleRoot(leafHashes(recordHashes)))
+}
+
+// MerkleProof returns the audit path for the record at index, bottom up
+func MerkleProof(recordHashes []string, index int) []ProofStep {
+	return append([]ProofStep{}, merklePath(index, leafHashes(recordHashes))...)
+}
+
+// VerifyMerkleProof recomputes the root from a record hash and its audit path
+func VerifyMerkleProof(recordHash string, proof []ProofStep, root string) bool {
+	node := LeafHash(recordHash)
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		switch step.Side {
+		case "left":
+			node = nodeHash(sibling, node)
+		case "right":
+			node = nodeHash(node, sibling)
+		default:
+			return false
+		}
+	}
+	return hex.EncodeToString(node) == root
+}
+
+func leafHashes(recordHashes []string) [][]byte {
+	leaves := make([][]byte, len(recordHashes))
+	for i, h := range recordHashes {
+		leaves[i] = LeafHash(h)
+	}
+	return leaves
+}
+
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return nodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+func merklePath(m int, leaves [][]byte) []ProofStep {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(merklePath(m, leaves[:k]), ProofStep{Hash: hex.EncodeToString(merkleRoot(leaves[k:])), Side: "right"})
+	}
+	return append(merklePath(m-k, leaves[k:]), ProofStep{Hash: hex.EncodeToString(merkleRoot(leaves[:k])), Side: "left"})
+}
+
+// splitPoint is the largest power of two smaller than n (n > 1)
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
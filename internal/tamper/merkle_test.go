@@ -0,0 +1,128 @@
+package tamper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func recordHashes(n int) []string {
+	hashes := make([]string, n)
+	for i := range hashes {
+		sum := sha256.Sum256([]byte(fmt.Sprint("record ", i)))
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+func TestMerkleRoot(t *testing.T) {
+	hs := recordHashes(7)
+	leaf := func(i int) []byte { return LeafHash(hs[i]) }
+	empty := sha256.Sum256(nil)
+
+	tests := []struct {
+		name string
+		n    int
+		want []byte
+	}{
+		{"empty", 0, empty[:]},
+		{"one leaf is its own root", 1, leaf(0)},
+		{"two", 2, nodeHash(leaf(0), leaf(1))},
+		{"three splits 2+1", 3, nodeHash(nodeHash(leaf(0), leaf(1)), leaf(2))},
+		{"four", 4, nodeHash(nodeHash(leaf(0), leaf(1)), nodeHash(leaf(2), leaf(3)))},
+		{"five splits 4+1", 5, nodeHash(
+			nodeHash(nodeHash(leaf(0), leaf(1)), nodeHash(leaf(2), leaf(3))),
+			leaf(4))},
+		{"seven splits 4+3", 7, nodeHash(
+			nodeHash(nodeHash(leaf(0), leaf(1)), nodeHash(leaf(2), leaf(3))),
+			nodeHash(nodeHash(leaf(4), leaf(5)), leaf(6)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, want := MerkleRoot(hs[:tt.n]), hex.EncodeToString(tt.want); got != want {
+				t.Errorf("MerkleRoot = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		hs := recordHashes(n)
+		root := MerkleRoot(hs)
+		for i := range hs {
+			proof := MerkleProof(hs, i)
+			if !VerifyMerkleProof(hs[i], proof, root) {
+				t.Errorf("n=%d index %d: proof doesn't verify", n, i)
+			}
+			// A power-of-two tree has a full path; others are at most that long
+			if maxLen := bitLen(n - 1); len(proof) > maxLen {
+				t.Errorf("n=%d index %d: proof has %d steps, want at most %d", n, i, len(proof), maxLen)
+			}
+		}
+	}
+}
+
+func TestMerkleProofRejectsTampering(t *testing.T) {
+	hs := recordHashes(6)
+	root := MerkleRoot(hs)
+	proof := MerkleProof(hs, 2)
+
+	tests := []struct {
+		name   string
+		record string
+		proof  func() []ProofStep
+		root   string
+	}{
+		{"other record", hs[3], func() []ProofStep { return proof }, root},
+		{"other record's path", hs[2], func() []ProofStep { return MerkleProof(hs, 3) }, root},
+		{"other root", hs[2], func() []ProofStep { return proof }, MerkleRoot(hs[:5])},
+		{"flipped side", hs[2], func() []ProofStep {
+			p := append([]ProofStep{}, proof...)
+			if p[0].Side == "left" {
+				p[0].Side = "right"
+			} else {
+				p[0].Side = "left"
+			}
+			return p
+		}, root},
+		{"unknown side", hs[2], func() []ProofStep {
+			p := append([]ProofStep{}, proof...)
+			p[0].Side = "up"
+			return p
+		}, root},
+		{"sibling not hex", hs[2], func() []ProofStep {
+			p := append([]ProofStep{}, proof...)
+			p[1].Hash = "zz"
+			return p
+		}, root},
+		{"step dropped", hs[2], func() []ProofStep { return proof[:len(proof)-1] }, root},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyMerkleProof(tt.record, tt.proof(), tt.root) {
+				t.Error("tampered proof verified")
+			}
+		})
+	}
+}
+
+func TestSplitPoint(t *testing.T) {
+	tests := []struct{ n, want int }{{2, 1}, {3, 2}, {4, 2}, {5, 4}, {8, 4}, {9, 8}, {16, 8}, {17, 16}}
+	for _, tt := range tests {
+		if got := splitPoint(tt.n); got != tt.want {
+			t.Errorf("splitPoint(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+// bitLen is the number of bits needed for n, so a tree of n+1 leaves is at
+// most bitLen(n) deep
+func bitLen(n int) int {
+	l := 0
+	for ; n > 0; n >>= 1 {
+		l++
+	}
+	return l
+}
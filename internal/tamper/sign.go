@@ -0,0 +1,133 @@
+package tamper
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const SignatureAlgorithm = "Ed25519"
+
+// What a signature attests to, kept apart so a checkpoint signature can't be
+// replayed as a batch signature
+const (
+	signedCheckpoint  = "checkpoint"
+	signedBatch       = "batch"
+	signedWitnessHead = "witness-head" // a checkpoint sent to a peer witness
+)
+
+type PublicKey struct {
+	KeyID     string `json:"keyId"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"` // base64, 32 bytes
+}
+
+var (
+	signingKey ed25519.PrivateKey
+	signingID  string
+	trusted    []PublicKey // verification-only keys, e.g. rotated-out ones
+)
+
+// LoadSigningKey sets the Ed25519 key used to sign checkpoints and batch
+// roots. encoded is base64 of either the 32-byte seed or the 64-byte private
+// key. An empty string leaves signing off.
+func LoadSigningKey(encoded string) error {
+	if encoded == "" {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("tamper signing key: %w", err)
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		signingKey = ed25519.NewKeyFromSeed(raw)
+	case ed25519.PrivateKeySize:
+		signingKey = ed25519.PrivateKey(raw)
+	default:
+		return errors.New("tamper signing key: expected a 32-byte seed or 64-byte private key")
+	}
+	signingID = keyID(signingKey.Public().(ed25519.PublicKey))
+	return nil
+}
+
+// LoadTrustedKeys adds comma-separated base64 Ed25519 public keys that
+// signatures are also checked against, so seals made with a rotated-out key
+// (or on another instance) still verify
+func LoadTrustedKeys(encoded string) error {
+	for _, k := range strings.Split(encoded, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return fmt.Errorf("tamper trusted key %q: expected base64 of a 32-byte Ed25519 public key", k)
+		}
+		trusted = append(trusted, PublicKey{KeyID: keyID(pub), Algorithm: SignatureAlgorithm, PublicKey: k})
+	}
+	return nil
+}
+
+// SigningEnabled reports whether a signing key was loaded
+func SigningEnabled() bool {
+	return signingKey != nil
+}
+
+// PublicKeys returns the keys signatures can be checked against, the
+// current signing key first
+func PublicKeys() []PublicKey {
+	keys := []PublicKey{}
+	if signingKey != nil {
+		keys = append(keys, PublicKey{
+			KeyID:     signingID,
+			Algorithm: SignatureAlgorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(signingKey.Public().(ed25519.PublicKey)),
+		})
+	}
+	return append(keys, trusted...)
+}
+
+// keyID is the first 8 bytes of SHA256(public key), hex encoded
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+func signedMessage(kind, hash string) []byte {
+	return []byte("parkproof/signature/v1\n" + kind + "\n" + hash)
+}
+
+// sign returns the key ID and base64 signature over hash, or empty strings
+// if signing is off
+func sign(kind, hash string) (string, string) {
+	if signingKey == nil {
+		return "", ""
+	}
+	sig := ed25519.Sign(signingKey, signedMessage(kind, hash))
+	return signingID, base64.StdEncoding.EncodeToString(sig)
+}
+
+// VerifySignature checks a signature over hash against a known public key
+func VerifySignature(keys []PublicKey, kind, hash, keyID, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	for _, k := range keys {
+		if k.KeyID != keyID || k.Algorithm != SignatureAlgorithm {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(pub, signedMessage(kind, hash), sig)
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package tamper
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+)
+
+// testSeed derives a deterministic Ed25519 seed from name
+func testSeed(name string) []byte {
+	sum := sha256.Sum256([]byte(name))
+	return sum[:]
+}
+
+func publicKeyOf(seed []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))
+}
+
+// resetKeys turns signing off and forgets trusted keys, now and after t
+func resetKeys(t *testing.T) {
+	t.Helper()
+	reset := func() { signingKey, signingID, trusted = nil, "", nil }
+	reset()
+	t.Cleanup(reset)
+}
+
+// useKeys loads seed as TAMPER_SIGNING_KEY and the others as
+// TAMPER_TRUSTED_KEYS
+func useKeys(t *testing.T, seed []byte, trustedSeeds ...[]byte) {
+	t.Helper()
+	resetKeys(t)
+	if seed != nil {
+		if err := LoadSigningKey(base64.StdEncoding.EncodeToString(seed)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range trustedSeeds {
+		if err := LoadTrustedKeys(publicKeyOf(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	seed := testSeed("server")
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+		wantOn  bool
+	}{
+		{"unset", "", false, false},
+		{"seed", base64.StdEncoding.EncodeToString(seed), false, true},
+		{"private key", base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed)), false, true},
+		{"not base64", "not a key!", true, false},
+		{"wrong length", base64.StdEncoding.EncodeToString(seed[:16]), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetKeys(t)
+			err := LoadSigningKey(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if SigningEnabled() != tt.wantOn {
+				t.Errorf("SigningEnabled = %v, want %v", SigningEnabled(), tt.wantOn)
+			}
+		})
+	}
+
+	// Seed and private key are the same key
+	useKeys(t, seed)
+	fromSeed := PublicKeys()[0]
+	resetKeys(t)
+	LoadSigningKey(base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed)))
+	if PublicKeys()[0] != fromSeed {
+		t.Errorf("private key loads as %+v, seed as %+v", PublicKeys()[0], fromSeed)
+	}
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	resetKeys(t)
+	if err := LoadTrustedKeys(" " + publicKeyOf(testSeed("a")) + ", ," + publicKeyOf(testSeed("b"))); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(PublicKeys()); n != 2 {
+		t.Errorf("%d keys loaded, want 2", n)
+	}
+	for _, bad := range []string{"zzz", base64.StdEncoding.EncodeToString(testSeed("a")[:31])} {
+		if err := LoadTrustedKeys(bad); err == nil {
+			t.Errorf("LoadTrustedKeys(%q) accepted", bad)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	old, current := testSeed("rotated out"), testSeed("current")
+	const hash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	// Signed with the old key before rotation
+	useKeys(t, old)
+	oldID, oldSig := sign(signedCheckpoint, hash)
+	useKeys(t, current, old)
+	id, sig := sign(signedCheckpoint, hash)
+	keys := PublicKeys()
+	raw, _ := base64.StdEncoding.DecodeString(sig)
+	raw[0] ^= 1
+	altered := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name                string
+		kind, hash, id, sig string
+		want                bool
+	}{
+		{"current key", signedCheckpoint, hash, id, sig, true},
+		{"rotated-out key", signedCheckpoint, hash, oldID, oldSig, true},
+		{"other hash", signedCheckpoint, "00" + hash[2:], id, sig, false},
+		{"replayed as a batch", signedBatch, hash, id, sig, false},
+		{"claims the other key", signedCheckpoint, hash, oldID, sig, false},
+		{"unknown key", signedCheckpoint, hash, "0123456789abcdef", sig, false},
+		{"altered signature", signedCheckpoint, hash, id, altered, false},
+		{"not base64", signedCheckpoint, hash, id, "%%%", false},
+		{"unsigned", signedCheckpoint, hash, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySignature(keys, tt.kind, tt.hash, tt.id, tt.sig); got != tt.want {
+				t.Errorf("VerifySignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignatureCheck(t *testing.T) {
+	const hash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	ours, theirs := testSeed("ours"), testSeed("theirs")
+
+	// seal is how one checkpoint in the chain was signed, nil for unsigned
+	type seal struct{ signedWith []byte }
+	tests := []struct {
+		name    string
+		signing []byte   // TAMPER_SIGNING_KEY
+		trusted [][]byte // TAMPER_TRUSTED_KEYS
+		seals   []seal
+		want    []IssueKind // per seal, "" for none
+	}{
+		{
+			name:  "signing never configured",
+			seals: []seal{{}, {}},
+			want:  []IssueKind{"", ""},
+		},
+		{
+			name:    "unsigned once a signing key is set",
+			signing: ours,
+			seals:   []seal{{}, {ours}},
+			want:    []IssueKind{IssueUnsigned, ""},
+		},
+		{
+			name:    "unsigned once a trusted key is set",
+			trusted: [][]byte{ours},
+			seals:   []seal{{ours}, {}},
+			want:    []IssueKind{"", IssueUnsigned},
+		},
+		{
+			name:    "signed by a key nobody trusts",
+			signing: ours,
+			seals:   []seal{{theirs}},
+			want:    []IssueKind{IssueBadSignature},
+		},
+		{
+			name:  "signatures dropped after the chain was signed",
+			seals: []seal{{}, {theirs}, {}},
+			want:  []IssueKind{"", IssueBadSignature, IssueUnsigned},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sign the seals first, then configure the verifier
+			sigs := make([][2]string, len(tt.seals))
+			for i, s := range tt.seals {
+				if s.signedWith != nil {
+					useKeys(t, s.signedWith)
+					sigs[i][0], sigs[i][1] = sign(signedCheckpoint, hash)
+				}
+			}
+			useKeys(t, tt.signing, tt.trusted...)
+
+			c := signatureCheck{keys: PublicKeys(), kind: signedCheckpoint}
+			for i := range tt.seals {
+				var got IssueKind
+				if issue := c.check(hash, sigs[i][0], sigs[i][1]); issue != nil {
+					got = issue.Kind
+				}
+				if got != tt.want[i] {
+					t.Errorf("seal %d: issue %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
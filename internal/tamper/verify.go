@@ -0,0 +1,409 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"fmt"
+	"time"
+)
+
+type IssueKind string
+
+const (
+	IssueHashMismatch IssueKind = "HASH_MISMATCH" // stored hash doesn't match the record's fields
+	IssueMissing      IssueKind = "MISSING"       // PrevHash or seq points at a record that isn't in the chain
+	IssueReordered    IssueKind = "REORDERED"     // PrevHash points at a record stored elsewhere in the chain
+	IssueBrokenLink   IssueKind = "BROKEN_LINK"   // checkpoint doesn't link to the one before it
+	IssueHeadMismatch IssueKind = "HEAD_MISMATCH" // checkpoint committed to a head the chain no longer has
+	IssueRootMismatch IssueKind = "ROOT_MISMATCH" // batch root doesn't match its leaves
+	IssueLeafMissing  IssueKind = "LEAF_MISSING"  // batch sealed a record hash no chain contains
+	IssueBadSignature IssueKind = "BAD_SIGNATURE" // signature doesn't verify against a known server key
+	IssueWrongChain   IssueKind = "WRONG_CHAIN"   // record's chainId or parkingLotId isn't the chain it's stored in
+	IssueUnsigned     IssueKind = "UNSIGNED"      // seal has no signature though one is required, see signatureCheck
+)
+
+type Issue struct {
+	Kind     IssueKind `json:"kind"`
+	ChainID  string    `json:"chainId,omitempty"`
+	Position int       `json:"position"` // 0-based position in the walk
+	LogID    string    `json:"logId"`
+	Expected string    `json:"expected,omitempty"`
+	Actual   string    `json:"actual,omitempty"`
+}
+
+// Report is the result of walking one chain
+type Report struct {
+	ChainID      string      `json:"chainId"`
+	Valid        bool        `json:"valid"`
+	Checked      int         `json:"checked"`
+	Head         string      `json:"head"`
+	HashVersions map[int]int `json:"hashVersions"` // records checked per hash scheme
+	FirstBroken  *Issue      `json:"firstBroken,omitempty"`
+	Tampered     []Issue     `json:"tampered"`
+	Missing      []Issue     `json:"missing"`
+	Reordered    []Issue     `json:"reordered"`
+	VerifiedAt   time.Time   `json:"verifiedAt"`
+}
+
+// SealReport is the result of walking a chain of seals over the tamper
+// log: the checkpoint chain or the Merkle batch chain
+type SealReport struct {
+	Valid       bool    `json:"valid"`
+	Checked     int     `json:"checked"`
+	Head        string  `json:"head"`
+	Signed      int     `json:"signed"`
+	Unsigned    int     `json:"unsigned"`
+	FirstBroken *Issue  `json:"firstBroken,omitempty"`
+	Issues      []Issue `json:"issues"`
+}
+
+// AuditReport covers a set of chains and every checkpoint's commitment to them
+type AuditReport struct {
+	Valid       bool       `json:"valid"`
+	Chains      []Report   `json:"chains"`
+	Checkpoints SealReport `json:"checkpoints"`
+	Batches     SealReport `json:"batches"`
+	VerifiedAt  time.Time  `json:"verifiedAt"`
+}
+
+// Verifier walks a chain one record at a time, so the whole collection never
+// has to be held in memory. Only the hashes seen so far are kept.
+type Verifier struct {
+	chainID     string
+	prevHash    string
+	prevSeq     int64
+	prevCreated time.Time
+	seen        map[string]int   // stored hash -> position
+	bySeq       map[int64]string // seq -> stored hash, for checking checkpoints
+	pending     map[string]Issue // unresolved links, keyed by the PrevHash they expect
+	report      Report
+}
+
+func NewVerifier(chainID string) *Verifier {
+	return &Verifier{
+		chainID:  chainID,
+		prevHash: GenesisHash,
+		seen:     make(map[string]int),
+		bySeq:    make(map[int64]string),
+		pending:  make(map[string]Issue),
+		report: Report{
+			ChainID:      chainID,
+			HashVersions: make(map[int]int),
+			Tampered:     []Issue{},
+			Missing:      []Issue{},
+			Reordered:    []Issue{},
+		},
+	}
+}
+
+// Add checks the next record in chain order
+func (v *Verifier) Add(l database.TamperLog) {
+	pos := v.report.Checked
+	v.report.Checked++
+	id := l.ID.Hex()
+	v.report.HashVersions[l.HashVersion]++
+
+	if h := Hash(l); h != l.Hash {
+		v.record(Issue{Kind: IssueHashMismatch, Position: pos, LogID: id, Expected: h, Actual: l.Hash})
+	}
+	// Only version 2 hashes chainId, so for older records it's derived: a
+	// lot's chain holds that lot's records and nothing else
+	if l.ChainID != v.chainID {
+		v.record(Issue{Kind: IssueWrongChain, Position: pos, LogID: id, Expected: v.chainID, Actual: l.ChainID})
+	} else if v.chainID != database.LegacyChainID && l.ParkingLotID != v.chainID {
+		v.record(Issue{Kind: IssueWrongChain, Position: pos, LogID: id, Expected: v.chainID, Actual: l.ParkingLotID})
+	}
+
+	if l.Seq > 0 && v.prevSeq > 0 && l.Seq != v.prevSeq+1 {
+		v.record(Issue{Kind: IssueMissing, Position: pos, LogID: id, Expected: fmt.Sprintf("seq %d", v.prevSeq+1), Actual: fmt.Sprintf("seq %d", l.Seq)})
+	}
+
+	// A link that points backwards past its neighbour means records were
+	// reordered. A link to something we haven't seen yet is either a record
+	// stored later (reordered) or a record that's gone (missing); we only know
+	// which once the walk is over.
+	if l.PrevHash != v.prevHash {
+		issue := Issue{Position: pos, LogID: id, Expected: v.prevHash, Actual: l.PrevHash}
+		if _, ok := v.seen[l.PrevHash]; ok {
+			issue.Kind = IssueReordered
+			v.record(issue)
+		} else {
+			v.pending[l.PrevHash] = issue
+		}
+	} else if !v.prevCreated.IsZero() && l.CreatedAt.Before(v.prevCreated) {
+		v.record(Issue{Kind: IssueReordered, Position: pos, LogID: id, Expected: v.prevCreated.String(), Actual: l.CreatedAt.String()})
+	}
+
+	if issue, ok := v.pending[l.Hash]; ok {
+		delete(v.pending, l.Hash)
+		issue.Kind = IssueReordered
+		v.record(issue)
+	}
+
+	v.seen[l.Hash] = pos
+	if l.Seq > 0 {
+		v.bySeq[l.Seq] = l.Hash
+	}
+	v.prevHash = l.Hash
+	v.prevSeq = l.Seq
+	v.prevCreated = l.CreatedAt
+}
+
+// HashAt returns the hash the chain had at seq. Seq 0 stands for the head of
+// a legacy chain written before sequence numbers existed.
+func (v *Verifier) HashAt(seq int64) (string, bool) {
+	if seq == 0 {
+		return v.prevHash, v.report.Checked > 0
+	}
+	h, ok := v.bySeq[seq]
+	return h, ok
+}
+
+// Report finishes the walk and returns the result
+func (v *Verifier) Report() Report {
+	for _, issue := range v.pending {
+		issue.Kind = IssueMissing
+		v.record(issue)
+	}
+	v.pending = make(map[string]Issue)
+
+	r := v.report
+	r.Head = v.prevHash
+	r.Valid = r.FirstBroken == nil
+	r.VerifiedAt = time.Now()
+	return r
+}
+
+func (v *Verifier) record(issue Issue) {
+	issue.ChainID = v.chainID
+	switch issue.Kind {
+	case IssueHashMismatch, IssueWrongChain:
+		v.report.Tampered = append(v.report.Tampered, issue)
+	case IssueMissing:
+		v.report.Missing = append(v.report.Missing, issue)
+	case IssueReordered:
+		v.report.Reordered = append(v.report.Reordered, issue)
+	}
+	if v.report.FirstBroken == nil || issue.Position < v.report.FirstBroken.Position {
+		first := issue
+		v.report.FirstBroken = &first
+	}
+}
+
+// VerifyChain walks one stored chain in order
+func VerifyChain(chainID string) (*Verifier, error) {
+	v := NewVerifier(chainID)
+	err := database.EachTamperLog(chainID, func(l database.TamperLog) error {
+		v.Add(l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Verify checks the given lot chains and every checkpoint's commitment to
+// them. With no chain IDs it checks every chain, including the legacy one.
+func Verify(chainIDs ...string) (AuditReport, error) {
+	all := len(chainIDs) == 0
+	if all {
+		ids, err := database.GetTamperChainIDs()
+		if err != nil {
+			return AuditReport{}, err
+		}
+		chainIDs = append([]string{database.LegacyChainID}, ids...)
+	}
+
+	audit := AuditReport{Valid: true, Chains: []Report{}}
+	verifiers := make(map[string]*Verifier)
+	for _, id := range chainIDs {
+		v, err := VerifyChain(id)
+		if err != nil {
+			return AuditReport{}, err
+		}
+		verifiers[id] = v
+
+		r := v.Report()
+		audit.Valid = audit.Valid && r.Valid
+		audit.Chains = append(audit.Chains, r)
+	}
+
+	cpReport, err := verifyCheckpoints(verifiers, all)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	audit.Checkpoints = cpReport
+	audit.Valid = audit.Valid && cpReport.Valid
+
+	batchReport, err := verifyBatches(verifiers, all)
+	if err != nil {
+		return AuditReport{}, err
+	}
+	audit.Batches = batchReport
+	audit.Valid = audit.Valid && batchReport.Valid
+	audit.VerifiedAt = time.Now()
+	return audit, nil
+}
+
+// verifyCheckpoints walks the checkpoint chain and checks each committed head
+// against the walked chains. If strict, a head for a chain that wasn't walked
+// means the chain has disappeared.
+func verifyCheckpoints(verifiers map[string]*Verifier, strict bool) (SealReport, error) {
+	r := SealReport{Issues: []Issue{}}
+	record := func(issue Issue) {
+		r.Issues = append(r.Issues, issue)
+		if r.FirstBroken == nil {
+			first := issue
+			r.FirstBroken = &first
+		}
+	}
+
+	sigs := signatureCheck{keys: PublicKeys(), kind: signedCheckpoint}
+	prevHash := GenesisHash
+	var prevSeq int64
+	err := database.EachTamperCheckpoint(func(cp database.TamperCheckpoint) error {
+		pos := r.Checked
+		r.Checked++
+		id := cp.ID.Hex()
+
+		if h := CheckpointHash(cp); h != cp.Hash {
+			record(Issue{Kind: IssueHashMismatch, Position: pos, LogID: id, Expected: h, Actual: cp.Hash})
+		}
+		if issue := sigs.count(&r, cp.Hash, cp.KeyID, cp.Signature); issue != nil {
+			issue.Position, issue.LogID = pos, id
+			record(*issue)
+		}
+		if cp.Seq != prevSeq+1 {
+			record(Issue{Kind: IssueMissing, Position: pos, LogID: id, Expected: fmt.Sprintf("seq %d", prevSeq+1), Actual: fmt.Sprintf("seq %d", cp.Seq)})
+		} else if cp.PrevHash != prevHash {
+			record(Issue{Kind: IssueBrokenLink, Position: pos, LogID: id, Expected: prevHash, Actual: cp.PrevHash})
+		}
+
+		for _, head := range cp.Heads {
+			v, ok := verifiers[head.ChainID]
+			if !ok {
+				if strict {
+					record(Issue{Kind: IssueHeadMismatch, ChainID: head.ChainID, Position: pos, LogID: id, Expected: head.Hash, Actual: "chain missing"})
+				}
+				continue
+			}
+			if h, ok := v.HashAt(head.Seq); !ok || h != head.Hash {
+				record(Issue{Kind: IssueHeadMismatch, ChainID: head.ChainID, Position: pos, LogID: id, Expected: head.Hash, Actual: h})
+			}
+		}
+
+		prevHash = cp.Hash
+		prevSeq = cp.Seq
+		return nil
+	})
+	if err != nil {
+		return SealReport{}, err
+	}
+
+	r.Head = prevHash
+	r.Valid = r.FirstBroken == nil
+	return r, nil
+}
+
+// verifyBatches walks the batch chain and recomputes every Merkle root. If
+// strict (all chains were walked), every sealed leaf must also still exist
+// in some chain.
+func verifyBatches(verifiers map[string]*Verifier, strict bool) (SealReport, error) {
+	r := SealReport{Issues: []Issue{}}
+	record := func(issue Issue) {
+		r.Issues = append(r.Issues, issue)
+		if r.FirstBroken == nil {
+			first := issue
+			r.FirstBroken = &first
+		}
+	}
+
+	sigs := signatureCheck{keys: PublicKeys(), kind: signedBatch}
+	prevHash := GenesisHash
+	var prevSeq int64
+	err := database.EachTamperBatch(func(b database.TamperBatch) error {
+		pos := r.Checked
+		r.Checked++
+		id := b.ID.Hex()
+
+		if root := MerkleRoot(b.Leaves); root != b.Root || len(b.Leaves) != b.Size {
+			record(Issue{Kind: IssueRootMismatch, Position: pos, LogID: id, Expected: root, Actual: b.Root})
+		}
+		if h := BatchHash(b); h != b.Hash {
+			record(Issue{Kind: IssueHashMismatch, Position: pos, LogID: id, Expected: h, Actual: b.Hash})
+		}
+		if issue := sigs.count(&r, b.Hash, b.KeyID, b.Signature); issue != nil {
+			issue.Position, issue.LogID = pos, id
+			record(*issue)
+		}
+		if b.Seq != prevSeq+1 {
+			record(Issue{Kind: IssueMissing, Position: pos, LogID: id, Expected: fmt.Sprintf("seq %d", prevSeq+1), Actual: fmt.Sprintf("seq %d", b.Seq)})
+		} else if b.PrevHash != prevHash {
+			record(Issue{Kind: IssueBrokenLink, Position: pos, LogID: id, Expected: prevHash, Actual: b.PrevHash})
+		}
+
+		if strict {
+			for i, leaf := range b.Leaves {
+				if !anyChainHas(verifiers, leaf) {
+					record(Issue{Kind: IssueLeafMissing, Position: pos, LogID: b.LogIDs[i].Hex(), Expected: leaf})
+				}
+			}
+		}
+
+		prevHash = b.Hash
+		prevSeq = b.Seq
+		return nil
+	})
+	if err != nil {
+		return SealReport{}, err
+	}
+
+	r.Head = prevHash
+	r.Valid = r.FirstBroken == nil
+	return r, nil
+}
+
+func anyChainHas(verifiers map[string]*Verifier, hash string) bool {
+	for _, v := range verifiers {
+		if _, ok := v.seen[hash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureCheck applies one signing rule to a chain of seals, walked in
+// order: once any key is known, or once an earlier seal in the chain was
+// signed, every seal must carry a valid signature. Otherwise anyone able to
+// write to the database could recompute the hashes and drop the signatures.
+type signatureCheck struct {
+	keys   []PublicKey
+	kind   string
+	signed bool // an earlier seal was signed
+}
+
+// check returns an issue if the next seal's signature is missing when
+// required or doesn't verify
+func (c *signatureCheck) check(hash, keyID, signature string) *Issue {
+	if signature == "" {
+		if len(c.keys) > 0 || c.signed {
+			return &Issue{Kind: IssueUnsigned, Expected: "signature"}
+		}
+		return nil
+	}
+	c.signed = true
+	if !VerifySignature(c.keys, c.kind, hash, keyID, signature) {
+		return &Issue{Kind: IssueBadSignature, Expected: keyID, Actual: signature}
+	}
+	return nil
+}
+
+// count is check that also tallies signed and unsigned seals in r
+func (c *signatureCheck) count(r *SealReport, hash, keyID, signature string) *Issue {
+	if signature == "" {
+		r.Unsigned++
+	} else {
+		r.Signed++
+	}
+	return c.check(hash, keyID, signature)
+}
@@ -0,0 +1,226 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const testChain = "65f2b3c4d5e6f7a8b9c0d1e2"
+
+// buildChain appends n records to a chain the way Append does
+func buildChain(chainID string, n int, version int) []database.TamperLog {
+	start := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)
+	lot := chainID
+	if chainID == database.LegacyChainID {
+		lot = testChain
+	}
+	logs := make([]database.TamperLog, n)
+	prev := GenesisHash
+	for i := range logs {
+		at := start.Add(time.Duration(i) * time.Minute)
+		l := database.TamperLog{
+			ID:            bson.NewObjectIDFromTimestamp(at),
+			ChainID:       chainID,
+			VehicleNo:     fmt.Sprintf("KA01AB%04d", i),
+			VehicleType:   "CAR",
+			ParkingLotID:  lot,
+			EntryExitTime: at,
+			HashVersion:   version,
+			PrevHash:      prev,
+			Action:        "ENTRY",
+			CreatedAt:     at,
+		}
+		if chainID != database.LegacyChainID {
+			l.Seq = int64(i + 1)
+		}
+		l.Hash = Hash(l)
+		logs[i] = l
+		prev = l.Hash
+	}
+	return logs
+}
+
+// rehash recomputes a record's hash, as someone editing the collection
+// would to cover their tracks
+func rehash(l *database.TamperLog) {
+	l.Hash = Hash(*l)
+}
+
+func verifyLogs(chainID string, logs []database.TamperLog) Report {
+	v := NewVerifier(chainID)
+	for _, l := range logs {
+		v.Add(l)
+	}
+	return v.Report()
+}
+
+func issueKinds(r Report) []IssueKind {
+	var kinds []IssueKind
+	for _, list := range [][]Issue{r.Tampered, r.Missing, r.Reordered} {
+		for _, issue := range list {
+			if !slices.Contains(kinds, issue.Kind) {
+				kinds = append(kinds, issue.Kind)
+			}
+		}
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+func TestVerifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		chainID   string
+		version   int
+		mutate    func([]database.TamperLog) []database.TamperLog
+		wantKinds []IssueKind
+		wantFirst int // position of FirstBroken, when there is one
+	}{
+		{name: "intact", chainID: testChain, version: CurrentHashVersion},
+		{name: "intact version 1", chainID: testChain, version: HashVersionCanonical},
+		{name: "intact legacy chain", chainID: database.LegacyChainID, version: HashVersionLegacy},
+		{
+			name: "field edited", chainID: testChain, version: CurrentHashVersion,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				logs[2].VehicleNo = "KA01ZZ9999"
+				return logs
+			},
+			wantKinds: []IssueKind{IssueHashMismatch},
+			wantFirst: 2,
+		},
+		{
+			name: "field edited and rehashed", chainID: testChain, version: CurrentHashVersion,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				logs[2].VehicleNo = "KA01ZZ9999"
+				rehash(&logs[2])
+				return logs
+			},
+			wantKinds: []IssueKind{IssueMissing},
+			wantFirst: 3,
+		},
+		{
+			name: "record deleted", chainID: testChain, version: CurrentHashVersion,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				return slices.Delete(logs, 2, 3)
+			},
+			wantKinds: []IssueKind{IssueMissing},
+			wantFirst: 2,
+		},
+		{
+			name: "legacy record deleted", chainID: database.LegacyChainID, version: HashVersionLegacy,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				return slices.Delete(logs, 2, 3)
+			},
+			wantKinds: []IssueKind{IssueMissing},
+			wantFirst: 2,
+		},
+		{
+			name: "records swapped", chainID: testChain, version: CurrentHashVersion,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				logs[1], logs[2] = logs[2], logs[1]
+				return logs
+			},
+			// The seq gap is reported as missing too
+			wantKinds: []IssueKind{IssueMissing, IssueReordered},
+			wantFirst: 1,
+		},
+		{
+			name: "created before its predecessor", chainID: testChain, version: CurrentHashVersion,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				logs[4].CreatedAt = logs[2].CreatedAt
+				rehash(&logs[4])
+				return logs
+			},
+			wantKinds: []IssueKind{IssueReordered},
+			wantFirst: 4,
+		},
+		{
+			name: "moved to another lot", chainID: testChain, version: CurrentHashVersion,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				logs[4].ParkingLotID = "75f2b3c4d5e6f7a8b9c0d1e2"
+				rehash(&logs[4])
+				return logs
+			},
+			wantKinds: []IssueKind{IssueWrongChain},
+			wantFirst: 4,
+		},
+		{
+			name: "version 1 moved to another chain", chainID: testChain, version: HashVersionCanonical,
+			mutate: func(logs []database.TamperLog) []database.TamperLog {
+				// chainId isn't hashed in version 1, so only the lot check catches it
+				logs[4].ChainID = "75f2b3c4d5e6f7a8b9c0d1e2"
+				return logs
+			},
+			wantKinds: []IssueKind{IssueWrongChain},
+			wantFirst: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := buildChain(tt.chainID, 5, tt.version)
+			if tt.mutate != nil {
+				logs = tt.mutate(logs)
+			}
+			r := verifyLogs(tt.chainID, logs)
+
+			if r.Checked != len(logs) {
+				t.Errorf("Checked = %d, want %d", r.Checked, len(logs))
+			}
+			if r.HashVersions[tt.version] != len(logs) {
+				t.Errorf("HashVersions = %v, want %d of version %d", r.HashVersions, len(logs), tt.version)
+			}
+			if got := issueKinds(r); !slices.Equal(got, tt.wantKinds) {
+				t.Errorf("issues = %v, want %v", got, tt.wantKinds)
+			}
+			if r.Valid != (len(tt.wantKinds) == 0) {
+				t.Errorf("Valid = %v with issues %v", r.Valid, issueKinds(r))
+			}
+			if r.FirstBroken != nil && r.FirstBroken.Position != tt.wantFirst {
+				t.Errorf("FirstBroken at %d, want %d", r.FirstBroken.Position, tt.wantFirst)
+			}
+			if r.Head != logs[len(logs)-1].Hash {
+				t.Errorf("Head = %s, want the last record's hash", r.Head)
+			}
+		})
+	}
+}
+
+func TestVerifierWrongChainID(t *testing.T) {
+	logs := buildChain(testChain, 3, CurrentHashVersion)
+	r := verifyLogs("75f2b3c4d5e6f7a8b9c0d1e2", logs)
+	if r.Valid || len(r.Tampered) != len(logs) {
+		t.Fatalf("verified another lot's chain: %+v", r.Tampered)
+	}
+	for _, issue := range r.Tampered {
+		if issue.Kind != IssueWrongChain {
+			t.Errorf("issue %s, want %s", issue.Kind, IssueWrongChain)
+		}
+	}
+}
+
+func TestVerifierHashAt(t *testing.T) {
+	logs := buildChain(testChain, 4, CurrentHashVersion)
+	v := NewVerifier(testChain)
+	if _, ok := v.HashAt(0); ok {
+		t.Error("empty chain has a head")
+	}
+	for _, l := range logs {
+		v.Add(l)
+	}
+	for _, l := range logs {
+		if h, ok := v.HashAt(l.Seq); !ok || h != l.Hash {
+			t.Errorf("HashAt(%d) = %s, %v, want %s", l.Seq, h, ok, l.Hash)
+		}
+	}
+	if _, ok := v.HashAt(5); ok {
+		t.Error("HashAt past the head found a hash")
+	}
+	if h, ok := v.HashAt(0); !ok || h != logs[3].Hash {
+		t.Errorf("HashAt(0) = %s, %v, want the head", h, ok)
+	}
+}
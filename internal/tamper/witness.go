@@ -0,0 +1,111 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Witness publishes a checkpoint somewhere outside ParkProof's database, so
+// an operator with database access can't rewrite history unnoticed
+type Witness interface {
+	Name() string
+	// Witness returns a receipt that can later be checked against the
+	// witness itself
+	Witness(cp database.TamperCheckpoint) (string, error)
+}
+
+var witnesses []Witness
+
+// LoadWitnesses configures where checkpoints are anchored. spec is a
+// comma-separated list of:
+//
+//	file:<path>  append-only local file (see FileWitness)
+//	tsa:<url>    RFC 3161 timestamp authority
+//	peer:<url>   another ParkProof instance
+func LoadWitnesses(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, target, ok := strings.Cut(entry, ":")
+		if !ok || target == "" {
+			return fmt.Errorf("tamper witness %q: expected kind:target", entry)
+		}
+
+		var w Witness
+		var err error
+		switch kind {
+		case "file":
+			w, err = NewFileWitness(target)
+		case "tsa":
+			w = NewTSAWitness(target)
+		case "peer":
+			w = NewPeerWitness(target)
+		default:
+			err = fmt.Errorf("unknown kind %q", kind)
+		}
+		if err != nil {
+			return fmt.Errorf("tamper witness %q: %w", entry, err)
+		}
+		witnesses = append(witnesses, w)
+	}
+	return nil
+}
+
+// WitnessCheckpoint sends cp to every configured witness that hasn't given
+// a receipt for it yet and stores the receipts next to it. A failing witness
+// doesn't stop the others; RetryWitnesses gives it another chance.
+func WitnessCheckpoint(cp database.TamperCheckpoint) {
+	for _, w := range witnesses {
+		if hasReceipt(cp, w.Name()) {
+			continue
+		}
+		receipt, err := w.Witness(cp)
+		if err != nil {
+			log.Printf("Witness %s failed for checkpoint %d: %v", w.Name(), cp.Seq, err)
+			continue
+		}
+		r := database.WitnessReceipt{
+			Witness:     w.Name(),
+			Receipt:     receipt,
+			WitnessedAt: time.Now(),
+		}
+		if err := database.AddCheckpointWitness(cp.ID, r); err != nil {
+			log.Printf("Error saving %s receipt for checkpoint %d: %v", w.Name(), cp.Seq, err)
+		}
+	}
+}
+
+// How many of the latest checkpoints RetryWitnesses looks at, i.e. about
+// two hours of checkpoints at the scheduler's interval
+const witnessRetryDepth = 8
+
+// RetryWitnesses sends the latest checkpoints, oldest first, to the
+// witnesses that have no receipt for them yet, so a witness that was down
+// catches up instead of leaving those checkpoints unanchored
+func RetryWitnesses() error {
+	if len(witnesses) == 0 {
+		return nil
+	}
+	cps, err := database.GetTamperCheckpoints(witnessRetryDepth)
+	if err != nil {
+		return err
+	}
+	for i := len(cps) - 1; i >= 0; i-- {
+		WitnessCheckpoint(cps[i])
+	}
+	return nil
+}
+
+func hasReceipt(cp database.TamperCheckpoint, witness string) bool {
+	for _, r := range cp.Witnesses {
+		if r.Witness == witness {
+			return true
+		}
+	}
+	return false
+}
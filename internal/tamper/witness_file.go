@@ -0,0 +1,95 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileWitness appends checkpoints to a local file, one JSON line each. Every
+// line carries the hash of the line before it, so the file is itself a
+// chain. Put it on storage the database operator can't write to (another
+// host, or `chattr +a`) for it to mean anything; as-is it's also the stand-in
+// witness for development and tests.
+//
+// Receipt: {"line": <1-based line number>, "lineHash": <SHA256 of the line>}
+type FileWitness struct {
+	path string
+
+	mu       sync.Mutex
+	lines    int
+	lastHash string
+}
+
+type fileWitnessLine struct {
+	CheckpointSeq int64     `json:"checkpointSeq"`
+	Hash          string    `json:"hash"`
+	CreatedAt     time.Time `json:"createdAt"`
+	PrevLineHash  string    `json:"prevLineHash"`
+}
+
+func NewFileWitness(path string) (*FileWitness, error) {
+	w := &FileWitness{path: path, lastHash: GenesisHash}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w.lines++
+		w.lastHash = lineHash(scanner.Bytes())
+	}
+	return w, scanner.Err()
+}
+
+func (w *FileWitness) Name() string {
+	return "file:" + w.path
+}
+
+func (w *FileWitness) Witness(cp database.TamperCheckpoint) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line, err := json.Marshal(fileWitnessLine{
+		CheckpointSeq: cp.Seq,
+		Hash:          cp.Hash,
+		CreatedAt:     cp.CreatedAt,
+		PrevLineHash:  w.lastHash,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+
+	w.lines++
+	w.lastHash = lineHash(line)
+	return fmt.Sprintf(`{"line":%d,"lineHash":%q}`, w.lines, w.lastHash), nil
+}
+
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeerWitness sends checkpoints to another, independently operated ParkProof
+// instance, which keeps them in its own database and refuses a different
+// hash for a checkpoint it has already seen (POST /api/witness/heads). The
+// peer only accepts heads attested by a key it has configured for our
+// origin (see LoadWitnessPeers), so this needs a signing key.
+//
+// Receipt: the peer's JSON response, i.e. the stored WitnessedHead.
+type PeerWitness struct {
+	url    string
+	client *http.Client
+}
+
+// WitnessOrigin is how this instance identifies itself to peers
+var WitnessOrigin = defaultWitnessOrigin()
+
+func defaultWitnessOrigin() string {
+	if origin := os.Getenv("TAMPER_WITNESS_ORIGIN"); origin != "" {
+		return origin
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+func NewPeerWitness(url string) *PeerWitness {
+	return &PeerWitness{url: strings.TrimRight(url, "/"), client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (w *PeerWitness) Name() string {
+	return "peer:" + w.url
+}
+
+func (w *PeerWitness) Witness(cp database.TamperCheckpoint) (string, error) {
+	if !SigningEnabled() {
+		return "", errors.New("peer witnesses need TAMPER_SIGNING_KEY to attest heads")
+	}
+	head := database.WitnessedHead{
+		Origin:        WitnessOrigin,
+		CheckpointSeq: cp.Seq,
+		Hash:          cp.Hash,
+		KeyID:         cp.KeyID,
+		Signature:     cp.Signature,
+		CreatedAt:     cp.CreatedAt,
+	}
+	head.AttestedBy, head.Attestation = sign(signedWitnessHead, witnessHeadPayload(head))
+	body, err := json.Marshal(head)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := w.client.Post(w.url+"/api/witness/heads", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	receipt, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("peer returned %s: %s", resp.Status, receipt)
+	}
+	return string(receipt), nil
+}
+
+// Peers this instance witnesses for, by origin
+var peerKeys = make(map[string][]PublicKey)
+
+// LoadWitnessPeers sets which origins may send heads to be witnessed and
+// the keys their heads must be attested with. spec is a comma-separated
+// list of origin=<base64 Ed25519 public key>; an origin may be listed more
+// than once while it rotates keys.
+func LoadWitnessPeers(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		origin, k, ok := strings.Cut(entry, "=")
+		if !ok || origin == "" {
+			return fmt.Errorf("tamper witness peer %q: expected origin=key", entry)
+		}
+		pub, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return fmt.Errorf("tamper witness peer %q: expected base64 of a 32-byte Ed25519 public key", entry)
+		}
+		peerKeys[origin] = append(peerKeys[origin], PublicKey{KeyID: keyID(pub), Algorithm: SignatureAlgorithm, PublicKey: k})
+	}
+	return nil
+}
+
+var (
+	ErrUnknownOrigin  = errors.New("witness: origin is not a configured peer")
+	ErrBadSignature   = errors.New("witness: checkpoint is not signed by the origin's key")
+	ErrBadAttestation = errors.New("witness: head is not attested by the origin's key")
+)
+
+// CheckWitnessedHead accepts a head sent to be witnessed only if its origin
+// is a configured peer, the checkpoint is signed by one of its keys, and the
+// head is attested by one of them. The checkpoint signature alone doesn't
+// bind the seq, which a witness can't recompute without the chain heads.
+// Otherwise anyone could claim an origin's next checkpoint slot first and
+// make every real head look like equivocation.
+func CheckWitnessedHead(h database.WitnessedHead) error {
+	keys, ok := peerKeys[h.Origin]
+	if !ok {
+		return ErrUnknownOrigin
+	}
+	if h.Signature == "" || !VerifySignature(keys, signedCheckpoint, h.Hash, h.KeyID, h.Signature) {
+		return ErrBadSignature
+	}
+	if h.Attestation == "" || !VerifySignature(keys, signedWitnessHead, witnessHeadPayload(h), h.AttestedBy, h.Attestation) {
+		return ErrBadAttestation
+	}
+	return nil
+}
+
+// witnessHeadPayload is what an attestation signs, binding the hash to the
+// origin and checkpoint seq it's claimed for
+func witnessHeadPayload(h database.WitnessedHead) string {
+	return h.Origin + "\n" + strconv.FormatInt(h.CheckpointSeq, 10) + "\n" + h.Hash
+}
@@ -0,0 +1,200 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usePeers loads spec as TAMPER_WITNESS_PEERS, forgetting it after t
+func usePeers(t *testing.T, spec string) {
+	t.Helper()
+	saved := peerKeys
+	peerKeys = make(map[string][]PublicKey)
+	t.Cleanup(func() { peerKeys = saved })
+	if err := LoadWitnessPeers(spec); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// witnessedHead is the head origin sends for checkpoint seq, signed and
+// attested with seed the way PeerWitness does
+func witnessedHead(t *testing.T, seed []byte, origin string, seq int64) database.WitnessedHead {
+	t.Helper()
+	useKeys(t, seed)
+	h := database.WitnessedHead{
+		Origin:        origin,
+		CheckpointSeq: seq,
+		Hash:          "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		CreatedAt:     time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC),
+	}
+	h.KeyID, h.Signature = sign(signedCheckpoint, h.Hash)
+	h.AttestedBy, h.Attestation = sign(signedWitnessHead, witnessHeadPayload(h))
+	return h
+}
+
+func TestLoadWitnessPeers(t *testing.T) {
+	usePeers(t, "north="+publicKeyOf(testSeed("north"))+", north="+publicKeyOf(testSeed("north rotated"))+",,south="+publicKeyOf(testSeed("south")))
+	if len(peerKeys["north"]) != 2 || len(peerKeys["south"]) != 1 {
+		t.Errorf("peers = %v, want two keys for north and one for south", peerKeys)
+	}
+	for _, bad := range []string{"north", "=" + publicKeyOf(testSeed("north")), "north=zzz", "north=" + publicKeyOf(testSeed("north"))[:20]} {
+		if err := LoadWitnessPeers(bad); err == nil {
+			t.Errorf("LoadWitnessPeers(%q) accepted", bad)
+		}
+	}
+}
+
+func TestCheckWitnessedHead(t *testing.T) {
+	north, rotated, south := testSeed("north"), testSeed("north rotated"), testSeed("south")
+	tests := []struct {
+		name string
+		head func(t *testing.T) database.WitnessedHead
+		want error
+	}{
+		{
+			name: "attested by the origin's key",
+			head: func(t *testing.T) database.WitnessedHead { return witnessedHead(t, north, "north", 7) },
+		},
+		{
+			name: "attested by the origin's rotated key",
+			head: func(t *testing.T) database.WitnessedHead { return witnessedHead(t, rotated, "north", 7) },
+		},
+		{
+			name: "unknown origin",
+			head: func(t *testing.T) database.WitnessedHead { return witnessedHead(t, north, "west", 7) },
+			want: ErrUnknownOrigin,
+		},
+		{
+			name: "another peer claiming the origin",
+			head: func(t *testing.T) database.WitnessedHead { return witnessedHead(t, south, "north", 7) },
+			want: ErrBadSignature,
+		},
+		{
+			name: "unsigned checkpoint",
+			head: func(t *testing.T) database.WitnessedHead {
+				h := witnessedHead(t, north, "north", 7)
+				h.KeyID, h.Signature = "", ""
+				return h
+			},
+			want: ErrBadSignature,
+		},
+		{
+			name: "signature for another hash",
+			head: func(t *testing.T) database.WitnessedHead {
+				h := witnessedHead(t, north, "north", 7)
+				h.Hash = "00" + h.Hash[2:]
+				return h
+			},
+			want: ErrBadSignature,
+		},
+		{
+			name: "checkpoint signature replayed as the attestation",
+			head: func(t *testing.T) database.WitnessedHead {
+				h := witnessedHead(t, north, "north", 7)
+				h.AttestedBy, h.Attestation = h.KeyID, h.Signature
+				return h
+			},
+			want: ErrBadAttestation,
+		},
+		{
+			name: "no attestation",
+			head: func(t *testing.T) database.WitnessedHead {
+				h := witnessedHead(t, north, "north", 7)
+				h.AttestedBy, h.Attestation = "", ""
+				return h
+			},
+			want: ErrBadAttestation,
+		},
+		{
+			name: "real checkpoint moved to another seq",
+			head: func(t *testing.T) database.WitnessedHead {
+				h := witnessedHead(t, north, "north", 7)
+				h.CheckpointSeq = 8
+				return h
+			},
+			want: ErrBadAttestation,
+		},
+		{
+			name: "attested by another peer",
+			head: func(t *testing.T) database.WitnessedHead {
+				h := witnessedHead(t, north, "north", 7)
+				forged := witnessedHead(t, south, "north", 7)
+				h.AttestedBy, h.Attestation = forged.AttestedBy, forged.Attestation
+				return h
+			},
+			want: ErrBadAttestation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.head(t)
+			usePeers(t, "north="+publicKeyOf(north)+",north="+publicKeyOf(rotated)+",south="+publicKeyOf(south))
+			if err := CheckWitnessedHead(h); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerWitness(t *testing.T) {
+	origin := testSeed("north")
+	saved := WitnessOrigin
+	WitnessOrigin = "north"
+	t.Cleanup(func() { WitnessOrigin = saved })
+
+	// The peer checks heads the way WitnessHead does
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/witness/heads" {
+			http.NotFound(w, r)
+			return
+		}
+		var h database.WitnessedHead
+		if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := CheckWitnessedHead(h); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(h)
+	}))
+	defer peer.Close()
+	usePeers(t, "north="+publicKeyOf(origin))
+
+	useKeys(t, origin)
+	cp := database.TamperCheckpoint{Seq: 3, PrevHash: GenesisHash, CreatedAt: time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC)}
+	cp.Hash = CheckpointHash(cp)
+	cp.KeyID, cp.Signature = sign(signedCheckpoint, cp.Hash)
+
+	w := NewPeerWitness(peer.URL + "/")
+	receipt, err := w.Witness(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got database.WitnessedHead
+	if err := json.Unmarshal([]byte(receipt), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Origin != "north" || got.CheckpointSeq != cp.Seq || got.Hash != cp.Hash {
+		t.Errorf("receipt = %+v, want checkpoint %d from north", got, cp.Seq)
+	}
+
+	// A peer that doesn't trust our key refuses the head
+	usePeers(t, "north="+publicKeyOf(testSeed("someone else")))
+	if _, err := w.Witness(cp); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("err = %v, want the peer's 403", err)
+	}
+
+	// Without a signing key there is nothing to attest with
+	resetKeys(t)
+	if _, err := w.Witness(cp); err == nil {
+		t.Error("witnessed without a signing key")
+	}
+}
@@ -0,0 +1,108 @@
+package tamper
+
+import (
+	"app/internal/database"
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// TSAWitness gets an RFC 3161 timestamp token over the checkpoint hash from
+// a timestamp authority.
+//
+// Receipt: the base64 DER TimeStampResp. It isn't checked here; verify it
+// with e.g. `openssl ts -verify -digest <checkpoint hash> -in <resp>`
+// against the TSA's certificate.
+type TSAWitness struct {
+	url    string
+	client *http.Client
+}
+
+var oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+
+type tsaMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsaRequest struct {
+	Version        int
+	MessageImprint tsaMessageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type tsaStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type tsaResponse struct {
+	Status         tsaStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+func NewTSAWitness(url string) *TSAWitness {
+	return &TSAWitness{url: url, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (w *TSAWitness) Name() string {
+	return "tsa:" + w.url
+}
+
+func (w *TSAWitness) Witness(cp database.TamperCheckpoint) (string, error) {
+	// The checkpoint hash is already a SHA-256 digest, so it is the imprint
+	digest, err := hex.DecodeString(cp.Hash)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return "", err
+	}
+
+	req, err := asn1.Marshal(tsaRequest{
+		Version: 1,
+		MessageImprint: tsaMessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := w.client.Post(w.url, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("TSA returned %s", resp.Status)
+	}
+
+	var tsr tsaResponse
+	if _, err := asn1.Unmarshal(body, &tsr); err != nil {
+		return "", fmt.Errorf("invalid TimeStampResp: %w", err)
+	}
+	// 0 = granted, 1 = granted with modifications
+	if tsr.Status.Status > 1 {
+		return "", fmt.Errorf("TSA rejected the request (status %d)", tsr.Status.Status)
+	}
+	return base64.StdEncoding.EncodeToString(body), nil
+}
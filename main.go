@@ -3,10 +3,16 @@ package main
 import (
 	"app/internal"
 	"app/internal/database"
+	"app/internal/reconcile"
 	"app/internal/risk"
+	"app/internal/tamper"
 	"app/routes"
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -27,9 +33,71 @@ func loadEnv() {
 
 func main() {
 	loadEnv()
-	database.MongoDBURI = os.Getenv("MONGODB_URI")
-	database.MongoDB()
+
+	// CLI mode: `parkproof <command>`
+	var cmd *command
+	if len(os.Args) > 1 {
+		c, ok := commands[os.Args[1]]
+		if !ok {
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		cmd = &c
+	}
+
+	if cmd == nil || !cmd.offline {
+		database.MongoDBURI = os.Getenv("MONGODB_URI")
+		database.MongoDB()
+	}
+	if err := tamper.LoadSigningKey(os.Getenv("TAMPER_SIGNING_KEY")); err != nil {
+		log.Fatal(err)
+	}
+	if err := tamper.LoadTrustedKeys(os.Getenv("TAMPER_TRUSTED_KEYS")); err != nil {
+		log.Fatal(err)
+	}
+	if err := tamper.LoadWitnesses(os.Getenv("TAMPER_WITNESSES")); err != nil {
+		log.Fatal(err)
+	}
+	if err := tamper.LoadWitnessPeers(os.Getenv("TAMPER_WITNESS_PEERS")); err != nil {
+		log.Fatal(err)
+	}
+	if err := risk.LoadTrafficSource(os.Getenv("RISK_TRAFFIC_SOURCE")); err != nil {
+		log.Fatal(err)
+	}
+	if err := risk.LoadSchedulerConfig(os.Getenv("RISK_SCHEDULER")); err != nil {
+		log.Fatal(err)
+	}
+	if err := risk.LoadRuleConfig(os.Getenv("RISK_RULES")); err != nil {
+		log.Fatal(err)
+	}
+	if path := os.Getenv("RISK_POLICY_FILE"); path != "" {
+		if err := risk.LoadPolicyFile(path); err != nil {
+			log.Fatal(err)
+		}
+		risk.WatchPolicyFile(path)
+	}
+	if !tamper.SigningEnabled() {
+		log.Println("Warning: TAMPER_SIGNING_KEY not set, tamper log heads will not be signed")
+	}
+
+	if cmd != nil {
+		os.Exit(cmd.run(os.Args[2:]))
+	}
+
+	// On SIGINT/SIGTERM, let risk runs record where they stopped and free
+	// the run lock for the other replicas before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down...")
+		risk.StopRuns(30 * time.Second)
+		os.Exit(0)
+	}()
+
 	go internal.Cleaner()
-	risk.StartRiskAnalysisScheduler()
+	risk.StartRiskAnalysisScheduler(ctx)
+	risk.StartHistoryCompactor(ctx)
+	tamper.StartCheckpointScheduler()
+	reconcile.StartReconciliationScheduler()
 	routes.Router()
 }
@@ -68,6 +68,7 @@ export async function GET(
         riskScore: riskScore,
         riskLevel,
         riskReason: risk?.reason ?? null,
+        riskFactors: risk?.factors ?? [],
       },
       { status: 200 }
     );
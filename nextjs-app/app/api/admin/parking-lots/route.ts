@@ -82,6 +82,7 @@ export async function GET(req: NextRequest) {
         riskScore,
         riskLevel,
         riskReason: risk.reason ?? null,
+        riskFactors: risk.factors ?? [],
       };
     });
 
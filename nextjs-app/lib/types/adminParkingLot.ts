@@ -1,5 +1,7 @@
 // lib/types/adminParkingLot.ts
 
+import type { RiskFactor } from "./riskScore";
+
 export type RiskLevel = "HIGH" | "MEDIUM" | "LOW";
 
 export interface AdminParkingLot {
@@ -15,4 +17,5 @@ export interface AdminParkingLot {
   riskScore: number;
   riskLevel: RiskLevel;
   riskReason: string | null;
+  riskFactors: RiskFactor[];
 }
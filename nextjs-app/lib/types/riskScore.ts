@@ -1,5 +1,20 @@
 import { Types } from "mongoose";
 
+// Written by the Go risk analyzer (database.RiskFactor)
+export interface RiskEvidence {
+  kind: "report" | "ticket" | "query" | "session" | "traffic";
+  id: string;
+  link?: string; // Go API path returning the record
+}
+
+export interface RiskFactor {
+  rule: string;
+  points: number;
+  message: string;
+  counts?: Record<string, number>;
+  evidence?: RiskEvidence[];
+}
+
 export interface RiskScore {
   _id?: string;
 
@@ -7,6 +22,7 @@ export interface RiskScore {
   score: number;                 
 
   reason?: string;               
+  factors?: RiskFactor[];
 
   createdAt?: Date;
 }
@@ -22,6 +22,11 @@ const RiskScoreSchema = new Schema<RiskScore>(
       type: String,
       trim: true,
     },
+
+    factors: {
+      type: [Schema.Types.Mixed],
+      default: undefined,
+    },
   },
   {
     timestamps: { createdAt: true, updatedAt: false },
@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 )
 
 type QueryRequest struct {
@@ -21,17 +20,14 @@ func SendQuery(c *fiber.Ctx) error {
 	var data QueryRequest
 	c.BodyParser(&data)
 
-	q := database.Query{
+	q, err := database.CreateQuery(c.UserContext(), database.Query{
 		Query:            data.Query,
 		ToParkingLot:     data.ToParkingLot,
 		ResponseRequired: data.ResponseRequired,
 		Time:             data.Time,
 		WithInTime:       data.WithInTime,
-		Status:           database.QueryStatusOpen,
 		Type:             data.Type,
-		ID:               "query" + uuid.New().String(),
-	}
-	err := database.AddQuery(q)
+	})
 	if err != nil {
 		c.Status(400)
 		return c.JSON(map[string]string{"error": err.Error()})
@@ -42,7 +38,7 @@ func SendQuery(c *fiber.Ctx) error {
 }
 
 func GetQueries(c *fiber.Ctx) error {
-	queries, err := database.GetQueryByParkingLot(c.Query("pid"))
+	queries, err := database.GetQueryByParkingLot(c.UserContext(), c.Query("pid"))
 	if err != nil {
 		c.Status(400)
 		return c.JSON(map[string]string{"error": err.Error()})
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"app/internal/database"
+	"app/internal/reconcile"
+	"app/internal/tamper"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReconcileTamperLogs - Compares the tamper log with sessions and tickets on
+// demand: ?lot=&from=&to= (defaults to all lots over the last 24 hours, and
+// may span at most reconcile.MaxRange)
+func ReconcileTamperLogs(c *fiber.Ctx) error {
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = tamper.ParseRangeTime(v, false); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = tamper.ParseRangeTime(v, true); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be before to"})
+	}
+	if to.Sub(from) > reconcile.MaxRange {
+		return c.Status(400).JSON(fiber.Map{"error": reconcile.ErrRangeTooLong.Error()})
+	}
+
+	report, err := reconcile.Run(c.Query("lot"), from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reconcile"})
+	}
+	return c.JSON(report)
+}
+
+// GetReconciliationReports - Lists the reports saved by the scheduled job
+func GetReconciliationReports(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	reports, err := database.GetReconciliationReports(int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch reports"})
+	}
+	return c.JSON(reports)
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"app/internal/database"
+	"app/internal/risk"
+	"app/internal/tamper"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// GetRiskHistory - Returns a lot's risk score series, oldest first:
+// ?from=&to=&limit= (defaults to the last 30 days). Entries older than the
+// policy's history.rawDays are one per day.
+func GetRiskHistory(c *fiber.Ctx) error {
+	lotID := c.Params("lotId")
+	if _, err := bson.ObjectIDFromHex(lotID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid lot ID"})
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = tamper.ParseRangeTime(v, false); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = tamper.ParseRangeTime(v, true); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be before to"})
+	}
+
+	limit := c.QueryInt("limit", 2000)
+	if limit <= 0 || limit > 10000 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 10000"})
+	}
+
+	history, err := database.GetRiskHistory(c.UserContext(), lotID, from, to, int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch risk history"})
+	}
+
+	level, since := risk.LevelSince(history)
+	resp := fiber.Map{
+		"lotId":   lotID,
+		"from":    from,
+		"to":      to,
+		"history": history,
+	}
+	if level != "" {
+		resp["currentLevel"] = level
+		resp["levelSince"] = since
+	}
+	return c.JSON(resp)
+}
+
+// GetRiskEvidence - Returns a record a risk factor links to
+// (/api/admin/risk/evidence/:kind/:id, kind is report, ticket, query or
+// session)
+func GetRiskEvidence(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var record any
+	var err error
+	switch c.Params("kind") {
+	case "report":
+		record, err = database.GetReportByID(c.UserContext(), id)
+	case "ticket":
+		record, err = database.GetTicketByID(c.UserContext(), id)
+	case "query":
+		var q database.Query
+		if q, err = database.GetQueryByID(id); err == nil && q.RiskRunID != "" {
+			// Hidden from attendants, who get queries in the same shape
+			return c.JSON(fiber.Map{"kind": "query", "id": id, "record": q, "riskRunId": q.RiskRunID})
+		}
+		record = q
+	case "session":
+		record, err = database.GetSessionByID(id)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be report, ticket, query or session"})
+	}
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, bson.ErrInvalidHex) {
+			return c.Status(404).JSON(fiber.Map{"error": "Record not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch record"})
+	}
+	return c.JSON(fiber.Map{"kind": c.Params("kind"), "id": id, "record": record})
+}
+
+// GetRiskRanking - Lots ordered for physical audit:
+// ?area=&level=HIGH,MEDIUM&minPersistenceDays=&top=N&cooldownDays=
+// top=N lists what to inspect today: N lots at MEDIUM or above that weren't
+// audited in the last cooldownDays (default 7)
+func GetRiskRanking(c *fiber.Ctx) error {
+	f, err := rankingFilter(c.Queries())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ranking, err := risk.Rank(c.UserContext(), f, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to rank lots"})
+	}
+	return c.JSON(ranking)
+}
+
+// rankingFilter reads GetRiskRanking's query string
+func rankingFilter(q map[string]string) (risk.RankingFilter, error) {
+	f := risk.RankingFilter{Area: q["area"], AuditCooldown: 7 * 24 * time.Hour}
+	if v := q["top"]; v != "" {
+		top, err := strconv.Atoi(v)
+		if err != nil || top < 0 {
+			return f, errors.New("top must be a non-negative integer")
+		}
+		f.Top = top
+	}
+	if v := q["cooldownDays"]; v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return f, errors.New("cooldownDays must be a non-negative integer")
+		}
+		f.AuditCooldown = time.Duration(days) * 24 * time.Hour
+	}
+	if v := q["level"]; v != "" {
+		for _, l := range strings.Split(strings.ToUpper(v), ",") {
+			if l != "LOW" && l != "MEDIUM" && l != "HIGH" {
+				return f, errors.New("level must be LOW, MEDIUM or HIGH")
+			}
+			f.Levels = append(f.Levels, l)
+		}
+	}
+	if v := q["minPersistenceDays"]; v != "" {
+		days, err := strconv.ParseFloat(v, 64)
+		if err != nil || days < 0 {
+			return f, errors.New("minPersistenceDays must be a non-negative number")
+		}
+		f.MinPersistenceDays = days
+	}
+	return f, nil
+}
+
+// auditClockSkew is how far ahead of the server's clock an auditor's device
+// may be
+const auditClockSkew = 5 * time.Minute
+
+// AddLotAudit - Records a physical audit of a lot
+func AddLotAudit(c *fiber.Ctx) error {
+	lotID, err := bson.ObjectIDFromHex(c.Params("lotId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid lot ID"})
+	}
+
+	var audit database.LotAudit
+	if err := c.BodyParser(&audit); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := checkAudit(&audit, time.Now()); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := database.GetParkingLot(c.UserContext(), lotID.Hex()); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(404).JSON(fiber.Map{"error": "Parking lot not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch parking lot"})
+	}
+	audit.ID = bson.NewObjectID()
+	audit.ParkingLotID = lotID
+
+	if err := database.InsertLotAudit(audit); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save audit"})
+	}
+	return c.Status(201).JSON(audit)
+}
+
+// checkAudit validates an audit recorded at now, which it defaults
+// AuditedAt to
+func checkAudit(audit *database.LotAudit, now time.Time) error {
+	audit.Auditor = strings.TrimSpace(audit.Auditor)
+	if audit.Auditor == "" {
+		return errors.New("auditor is required")
+	}
+	// A future audit would keep the lot out of the daily list until then
+	if audit.AuditedAt.After(now.Add(auditClockSkew)) {
+		return errors.New("auditedAt can't be in the future")
+	}
+	if audit.AuditedAt.IsZero() {
+		audit.AuditedAt = now
+	}
+	return nil
+}
+
+// GetLotAudits - Lists a lot's audits, newest first
+func GetLotAudits(c *fiber.Ctx) error {
+	lotID := c.Params("lotId")
+	if _, err := bson.ObjectIDFromHex(lotID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid lot ID"})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	audits, err := database.GetLotAudits(lotID, int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch audits"})
+	}
+	return c.JSON(audits)
+}
+
+// StartRiskRun - Starts a risk analysis now, of every lot or of the lot in
+// the body: {"parkingLotId": "..."}. Returns the run to poll.
+func StartRiskRun(c *fiber.Ctx) error {
+	var data struct {
+		ParkingLotID string `json:"parkingLotId"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&data); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	run, err := risk.StartRun(c.UserContext(), risk.TriggerManual, data.ParkingLotID)
+	if err != nil {
+		switch {
+		case errors.Is(err, bson.ErrInvalidHex):
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid lot ID"})
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return c.Status(404).JSON(fiber.Map{"error": "Parking lot not found"})
+		case errors.Is(err, risk.ErrRunInProgress):
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, risk.ErrShuttingDown):
+			return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to start risk analysis"})
+	}
+	return c.Status(202).JSON(run)
+}
+
+// GetRiskRuns - Lists risk runs, newest first: ?status=running&limit=
+func GetRiskRuns(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	status := c.Query("status")
+	if status != "" && !slices.Contains(database.RiskRunStatuses, status) {
+		return c.Status(400).JSON(fiber.Map{"error": "status must be one of " + strings.Join(database.RiskRunStatuses, ", ")})
+	}
+
+	runs, err := database.GetRiskRuns(status, int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch risk runs"})
+	}
+	return c.JSON(runs)
+}
+
+// GetRiskRun - Returns one risk run, with its progress while it's going
+func GetRiskRun(c *fiber.Ctx) error {
+	run, err := database.GetRiskRun(c.Params("runId"))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(404).JSON(fiber.Map{"error": "Run not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch risk run"})
+	}
+	return c.JSON(run)
+}
+
+// CancelRiskRun - Stops a run in progress; lots already being scored finish
+func CancelRiskRun(c *fiber.Ctx) error {
+	id := c.Params("runId")
+	if err := risk.CancelRun(id); err != nil {
+		if !errors.Is(err, risk.ErrRunNotActive) {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to cancel risk run"})
+		}
+		if _, getErr := database.GetRiskRun(id); errors.Is(getErr, mongo.ErrNoDocuments) {
+			return c.Status(404).JSON(fiber.Map{"error": "Run not found"})
+		}
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(202).JSON(fiber.Map{"id": id, "status": "cancelling"})
+}
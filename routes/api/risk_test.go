@@ -0,0 +1,73 @@
+package api
+
+import (
+	"app/internal/database"
+	"app/internal/risk"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankingFilter(t *testing.T) {
+	week := 7 * 24 * time.Hour
+	tests := []struct {
+		name    string
+		q       map[string]string
+		want    risk.RankingFilter
+		wantErr bool
+	}{
+		{"defaults", map[string]string{}, risk.RankingFilter{AuditCooldown: week}, false},
+		{
+			"everything",
+			map[string]string{"area": "north", "level": "high,Medium", "minPersistenceDays": "1.5", "top": "5", "cooldownDays": "3"},
+			risk.RankingFilter{Area: "north", Levels: []string{"HIGH", "MEDIUM"}, MinPersistenceDays: 1.5, Top: 5, AuditCooldown: 3 * 24 * time.Hour},
+			false,
+		},
+		{"no cooldown", map[string]string{"top": "3", "cooldownDays": "0"}, risk.RankingFilter{Top: 3}, false},
+		{"unknown level", map[string]string{"level": "HIGH,CRITICAL"}, risk.RankingFilter{}, true},
+		{"negative persistence", map[string]string{"minPersistenceDays": "-1"}, risk.RankingFilter{}, true},
+		{"negative top", map[string]string{"top": "-1"}, risk.RankingFilter{}, true},
+		{"unparseable top", map[string]string{"top": "all"}, risk.RankingFilter{}, true},
+		{"negative cooldown", map[string]string{"cooldownDays": "-7"}, risk.RankingFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := rankingFilter(tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(f, tt.want) {
+				t.Errorf("filter = %+v, want %+v", f, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAudit(t *testing.T) {
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		audit   database.LotAudit
+		wantAt  time.Time
+		wantErr bool
+	}{
+		{"defaults to now", database.LotAudit{Auditor: "ravi"}, now, false},
+		{"in the past", database.LotAudit{Auditor: "ravi", AuditedAt: now.Add(-3 * time.Hour)}, now.Add(-3 * time.Hour), false},
+		{"device clock a little ahead", database.LotAudit{Auditor: "ravi", AuditedAt: now.Add(auditClockSkew)}, now.Add(auditClockSkew), false},
+		{"in the future", database.LotAudit{Auditor: "ravi", AuditedAt: now.Add(auditClockSkew + time.Second)}, time.Time{}, true},
+		{"no auditor", database.LotAudit{}, time.Time{}, true},
+		{"blank auditor", database.LotAudit{Auditor: "  "}, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.audit
+			err := checkAudit(&a, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !a.AuditedAt.Equal(tt.wantAt) {
+				t.Errorf("auditedAt = %v, want %v", a.AuditedAt, tt.wantAt)
+			}
+		})
+	}
+}
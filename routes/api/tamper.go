@@ -2,12 +2,16 @@ package api
 
 import (
 	"app/internal/database"
-	"crypto/sha256"
-	"encoding/hex"
+	"app/internal/tamper"
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"time"
+	"log"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 // AddTamperLog - Adds a new tamper-proof log
@@ -23,40 +27,245 @@ func AddTamperLog(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Missing required fields"})
 	}
 
-	// Get the last log to find the previous hash
-	lastLog, err := database.GetLastTamperLog()
+	// Link to the chain tip and insert
+	req, err := tamper.Append(req)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch last log"})
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save log"})
 	}
 
-	prevHash := "0" // Genesis hash
-	if lastLog != nil {
-		prevHash = lastLog.Hash
+	return c.JSON(fiber.Map{"message": "Log added successfully", "log": req})
+}
+
+const (
+	defaultTamperPageSize = 100
+	maxTamperPageSize     = 1000
+)
+
+// How GetTamperLogs answers
+type tamperListing int
+
+const (
+	listTamperArray  tamperListing = iota // every match as one JSON array
+	listTamperNDJSON                      // every match, one per line
+	listTamperPage                        // one page and the cursor to the next
+)
+
+// GetTamperLogs - Lists logs, oldest first.
+// Filters: ?parkingLotId=&vehicleNo=&action=&from=&to=
+// Without limit or cursor the response is a bare array of every match, as
+// it always was, streamed from the database. With ?limit=&cursor= (cursor
+// is nextCursor from the previous page) it's one page: {logs, nextCursor}.
+// ?order=desc lists newest first; ?format=ndjson streams every match, one
+// record per line, ignoring limit.
+func GetTamperLogs(c *fiber.Ctx) error {
+	f, listing, err := tamperLogQuery(c.Queries())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	switch listing {
+	case listTamperNDJSON:
+		return streamTamperLogs(c, f, false)
+	case listTamperArray:
+		return streamTamperLogs(c, f, true)
 	}
 
-	// Set timestamps and prev hash
-	req.EntryExitTime = time.Now()
-	req.CreatedAt = time.Now()
-	req.PrevHash = prevHash
+	logs, err := database.FindTamperLogs(f)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch logs"})
+	}
 
-	// Calculate Hash: SHA256(VehicleNo + VehicleType + ParkingLotID + EntryExitTime + PrevHash)
-	dataString := fmt.Sprintf("%s%s%s%s%s", req.VehicleNo, req.VehicleType, req.ParkingLotID, req.EntryExitTime.String(), req.PrevHash)
-	hash := sha256.Sum256([]byte(dataString))
-	req.Hash = hex.EncodeToString(hash[:])
+	nextCursor := ""
+	if int64(len(logs)) == f.Limit {
+		nextCursor = logs[len(logs)-1].ID.Hex()
+	}
+	return c.JSON(fiber.Map{"logs": logs, "nextCursor": nextCursor})
+}
 
-	// Insert into DB
-	if err := database.InsertTamperLog(req); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to save log"})
+// tamperLogQuery reads GetTamperLogs' query string into a filter and the way
+// to list its matches
+func tamperLogQuery(q map[string]string) (database.TamperLogFilter, tamperListing, error) {
+	f := database.TamperLogFilter{
+		ParkingLotID: q["parkingLotId"],
+		VehicleNo:    q["vehicleNo"],
+		Action:       q["action"],
+		Descending:   q["order"] == "desc",
+	}
+	if f.Action != "" && f.Action != "ENTRY" && f.Action != "EXIT" {
+		return f, 0, errors.New("action must be ENTRY or EXIT")
 	}
 
-	return c.JSON(fiber.Map{"message": "Log added successfully", "log": req})
+	var err error
+	if from := q["from"]; from != "" {
+		if f.From, err = tamper.ParseRangeTime(from, false); err != nil {
+			return f, 0, err
+		}
+	}
+	if to := q["to"]; to != "" {
+		if f.To, err = tamper.ParseRangeTime(to, true); err != nil {
+			return f, 0, err
+		}
+	}
+	if cursor := q["cursor"]; cursor != "" {
+		if f.After, err = bson.ObjectIDFromHex(cursor); err != nil {
+			return f, 0, errors.New("Invalid cursor")
+		}
+	}
+
+	if q["format"] == "ndjson" {
+		return f, listTamperNDJSON, nil
+	}
+	if q["limit"] == "" && q["cursor"] == "" {
+		return f, listTamperArray, nil
+	}
+
+	limit := defaultTamperPageSize
+	if s := q["limit"]; s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			limit = n
+		}
+	}
+	if limit <= 0 || limit > maxTamperPageSize {
+		return f, 0, fmt.Errorf("limit must be between 1 and %d", maxTamperPageSize)
+	}
+	f.Limit = int64(limit)
+	return f, listTamperPage, nil
 }
 
-// GetTamperLogs - Retrieves all logs
-func GetTamperLogs(c *fiber.Ctx) error {
-	logs, err := database.GetAllTamperLogs()
+// streamTamperLogs writes every match straight from the database cursor,
+// as NDJSON or as one JSON array. Errors after the first byte can't change
+// the status code: NDJSON gets a final {"error": ...} line, and an array is
+// left unterminated so it fails to parse rather than looking complete.
+func streamTamperLogs(c *fiber.Ctx, f database.TamperLogFilter, array bool) error {
+	if array {
+		c.Set("Content-Type", "application/json")
+	} else {
+		c.Set("Content-Type", "application/x-ndjson")
+	}
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		enc := json.NewEncoder(w)
+		if array {
+			w.WriteString("[")
+		}
+		first := true
+		err := database.EachTamperLogMatching(f, func(l database.TamperLog) error {
+			if array && !first {
+				w.WriteString(",")
+			}
+			first = false
+			if err := enc.Encode(l); err != nil {
+				return err
+			}
+			if w.Buffered() > 32*1024 {
+				return w.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			log.Println("Error streaming tamper logs:", err)
+			if !array {
+				enc.Encode(fiber.Map{"error": "Failed to fetch logs"})
+			}
+		} else if array {
+			w.WriteString("]")
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// VerifyTamperLogs - Recomputes the hash chains and checkpoints and reports
+// any breaks. ?lot= limits the audit to one parking lot's chain.
+func VerifyTamperLogs(c *fiber.Ctx) error {
+	var lots []string
+	if lot := c.Query("lot"); lot != "" {
+		lots = append(lots, lot)
+	}
+
+	report, err := tamper.Verify(lots...)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch logs"})
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to verify logs"})
 	}
-	return c.JSON(logs)
+	return c.JSON(report)
+}
+
+// GetTamperCheckpoints - Lists the most recent global checkpoints
+func GetTamperCheckpoints(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	cps, err := database.GetTamperCheckpoints(int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch checkpoints"})
+	}
+	return c.JSON(cps)
+}
+
+// GetTamperLogProof - Inclusion proof of one record in its batch's Merkle root
+func GetTamperLogProof(c *fiber.Ctx) error {
+	id, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid log ID"})
+	}
+
+	proof, err := tamper.Prove(id)
+	if errors.Is(err, tamper.ErrNotBatched) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build proof"})
+	}
+	if proof == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Log not found"})
+	}
+	return c.JSON(proof)
+}
+
+// GetTamperBatches - Lists the most recent published batch roots
+func GetTamperBatches(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	batches, err := database.GetTamperBatches(int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch batches"})
+	}
+	return c.JSON(batches)
+}
+
+// GetTamperPublicKeys - Public keys that checkpoint and batch signatures can
+// be verified against
+func GetTamperPublicKeys(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"keys": tamper.PublicKeys()})
+}
+
+// ExportTamperLogs - Self-contained, offline-verifiable bundle of one lot's
+// records: ?lot=&from=&to=
+func ExportTamperLogs(c *fiber.Ctx) error {
+	lot := c.Query("lot")
+	if lot == "" || c.Query("from") == "" || c.Query("to") == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "lot, from and to are required"})
+	}
+	from, err := tamper.ParseRangeTime(c.Query("from"), false)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	to, err := tamper.ParseRangeTime(c.Query("to"), true)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	bundle, err := tamper.Export(lot, from, to)
+	if errors.Is(err, tamper.ErrBundleTooLarge) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to export logs"})
+	}
+
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=parkproof-%s-%s-%s.json", lot, c.Query("from"), c.Query("to")))
+	return c.JSON(bundle)
 }
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"app/internal/database"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestTamperLogQuery(t *testing.T) {
+	cursor := bson.NewObjectIDFromTimestamp(time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name    string
+		q       map[string]string
+		listing tamperListing
+		limit   int64
+		wantErr bool
+	}{
+		{"bare array without paging", map[string]string{"parkingLotId": "lot"}, listTamperArray, 0, false},
+		{"bare array ignores order", map[string]string{"order": "desc"}, listTamperArray, 0, false},
+		{"limit asks for a page", map[string]string{"limit": "50"}, listTamperPage, 50, false},
+		{"cursor asks for a page", map[string]string{"cursor": cursor.Hex()}, listTamperPage, defaultTamperPageSize, false},
+		{"unparseable limit", map[string]string{"limit": "lots"}, listTamperPage, defaultTamperPageSize, false},
+		{"ndjson ignores limit", map[string]string{"format": "ndjson", "limit": "50"}, listTamperNDJSON, 0, false},
+		{"limit too large", map[string]string{"limit": "1001"}, 0, 0, true},
+		{"limit zero", map[string]string{"limit": "0"}, 0, 0, true},
+		{"bad cursor", map[string]string{"cursor": "nope"}, 0, 0, true},
+		{"bad action", map[string]string{"action": "PARK"}, 0, 0, true},
+		{"bad date", map[string]string{"from": "14/03/2026"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, listing, err := tamperLogQuery(tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if listing != tt.listing || f.Limit != tt.limit {
+				t.Errorf("listing %d with limit %d, want %d with %d", listing, f.Limit, tt.listing, tt.limit)
+			}
+		})
+	}
+}
+
+func TestTamperLogQueryFilter(t *testing.T) {
+	cursor := bson.NewObjectID()
+	f, _, err := tamperLogQuery(map[string]string{
+		"parkingLotId": "lot",
+		"vehicleNo":    "KA01AB1234",
+		"action":       "ENTRY",
+		"from":         "2026-03-14",
+		"to":           "2026-03-14",
+		"cursor":       cursor.Hex(),
+		"order":        "desc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := database.TamperLogFilter{
+		ParkingLotID: "lot",
+		VehicleNo:    "KA01AB1234",
+		Action:       "ENTRY",
+		From:         time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC),
+		To:           time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC), // a bare end date covers the day
+		After:        cursor,
+		Descending:   true,
+		Limit:        defaultTamperPageSize,
+	}
+	if f != want {
+		t.Errorf("filter = %+v, want %+v", f, want)
+	}
+}
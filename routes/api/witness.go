@@ -0,0 +1,55 @@
+package api
+
+import (
+	"app/internal/database"
+	"app/internal/tamper"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WitnessHead - Stores a checkpoint another ParkProof instance wants
+// witnessed. Only configured peers' attested heads are accepted.
+func WitnessHead(c *fiber.Ctx) error {
+	var req database.WitnessedHead
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Origin == "" || req.CheckpointSeq <= 0 || req.Hash == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Missing required fields"})
+	}
+	if err := tamper.CheckWitnessedHead(req); err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	req.ID = bson.NewObjectID()
+	req.ReceivedAt = time.Now()
+	head, err := database.SaveWitnessedHead(req)
+	if errors.Is(err, database.ErrEquivocation) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "witnessed": head})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save head"})
+	}
+	return c.JSON(head)
+}
+
+// GetWitnessedHeads - Lists the heads witnessed for ?origin=
+func GetWitnessedHeads(c *fiber.Ctx) error {
+	origin := c.Query("origin")
+	if origin == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "origin is required"})
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 500 {
+		return c.Status(400).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	heads, err := database.GetWitnessedHeads(origin, int64(limit))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch heads"})
+	}
+	return c.JSON(heads)
+}
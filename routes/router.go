@@ -45,6 +45,31 @@ func Router() {
 	// Tamper Proof System Routes
 	app.Post("/api/tamper-logs", api.AddTamperLog)
 	app.Get("/api/tamper-logs", api.GetTamperLogs)
+	app.Get("/api/tamper-logs/verify", api.VerifyTamperLogs)
+	app.Get("/api/tamper-logs/checkpoints", api.GetTamperCheckpoints)
+	app.Get("/api/tamper-logs/batches", api.GetTamperBatches)
+	app.Get("/api/tamper-logs/export", api.ExportTamperLogs)
+	app.Get("/api/tamper-logs/:id/proof", api.GetTamperLogProof)
+	app.Get("/.well-known/parkproof-tamper-keys", api.GetTamperPublicKeys)
+
+	// Reconciliation Routes (tamper log vs sessions/tickets)
+	app.Get("/api/admin/reconciliation", api.ReconcileTamperLogs)
+	app.Get("/api/admin/reconciliation/reports", api.GetReconciliationReports)
+
+	// Risk Routes
+	app.Get("/api/admin/risk/ranking", api.GetRiskRanking)
+	app.Post("/api/admin/risk/run", api.StartRiskRun) // all lots, or {"parkingLotId"}
+	app.Get("/api/admin/risk/runs", api.GetRiskRuns)
+	app.Get("/api/admin/risk/runs/:runId", api.GetRiskRun)
+	app.Post("/api/admin/risk/runs/:runId/cancel", api.CancelRiskRun)
+	app.Get("/api/admin/risk/:lotId/history", api.GetRiskHistory)
+	app.Post("/api/admin/risk/:lotId/audits", api.AddLotAudit)
+	app.Get("/api/admin/risk/:lotId/audits", api.GetLotAudits)
+	app.Get("/api/admin/risk/evidence/:kind/:id", api.GetRiskEvidence)
+
+	// Witness Routes (other instances anchoring their checkpoints here)
+	app.Post("/api/witness/heads", api.WitnessHead)
+	app.Get("/api/witness/heads", api.GetWitnessedHeads)
 
 	log.Fatal(app.Listen(":8000"))
 }